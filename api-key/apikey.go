@@ -1,12 +1,19 @@
 package apikey
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
 )
 
 // GenerateApiKey returns a random API key represented as a 64-character
 // hexadecimal string.
+//
+// Deprecated: merchant keys should be created with GenerateKey, which allows
+// storing only a hash of the secret.
 func GenerateApiKey() (string, error) {
 	key := make([]byte, 32)
 	_, err := rand.Read(key)
@@ -15,3 +22,16 @@ func GenerateApiKey() (string, error) {
 	}
 	return hex.EncodeToString(key), nil
 }
+
+// MigrateLegacyKeys replaces the keys created by GenerateApiKey that are still
+// stored in plain text in merchants.api_key with their hash, and returns the
+// number of migrated merchants. Merchants keep using the same key: HashKey
+// hashes it the same way. It is safe to run repeatedly and must run before
+// lookups use HashKey, because plain keys no longer match afterwards.
+func MigrateLegacyKeys(ctx context.Context, queries *db.Queries) (int64, error) {
+	migrated, err := queries.HashLegacyMerchantApiKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash legacy api keys: %w", err)
+	}
+	return migrated, nil
+}
@@ -1,9 +1,13 @@
 package apikey
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +22,78 @@ func TestGenerateApiKey(t *testing.T) {
 	_, err := hex.DecodeString(apiKey)
 	assert.NoError(t, err, "API key should be valid hex")
 }
+
+// TestGenerateKey verifies that a generated merchant key survives a round trip
+// through String and ParseKey and that only its hash matches VerifyKey.
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key.Prefix, KeyPrefix))
+	assert.Len(t, key.Prefix, len(KeyPrefix)+16, "the prefix must carry 64 random bits")
+
+	parsed, err := ParseKey(key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	hash := key.Hash()
+	assert.True(t, strings.HasPrefix(hash, key.Prefix+"."))
+	assert.NotContains(t, hash, key.Secret)
+
+	hashed, err := HashKey(key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, hash, hashed)
+
+	assert.True(t, VerifyKey(key.String(), hash))
+	assert.False(t, VerifyKey(hash, hash), "the stored hash must not be usable as a key")
+
+	other, _ := GenerateKey()
+	assert.False(t, VerifyKey(other.String(), hash))
+}
+
+// TestParseKeyInvalid verifies that malformed keys are rejected.
+func TestParseKeyInvalid(t *testing.T) {
+	legacy, _ := GenerateApiKey()
+
+	for _, raw := range []string{
+		"",
+		legacy,
+		"mk_0011.zz",
+		"pk_00112233." + legacy,
+		"mk_00112233" + legacy,
+	} {
+		_, err := ParseKey(raw)
+		assert.ErrorIs(t, err, ErrInvalidKey, raw)
+	}
+}
+
+// TestHashKeyLegacy verifies that keys created by GenerateApiKey hash to the
+// value stored by the HashLegacyMerchantApiKeys query, regardless of case.
+func TestHashKeyLegacy(t *testing.T) {
+	legacy, err := GenerateApiKey()
+	assert.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(legacy))
+	want := LegacyHashPrefix + hex.EncodeToString(sum[:])
+
+	hash, err := HashKey(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, want, hash)
+
+	hash, err = HashKey(strings.ToUpper(legacy))
+	assert.NoError(t, err)
+	assert.Equal(t, want, hash)
+
+	assert.True(t, VerifyKey(legacy, want))
+	_, err = HashKey(want)
+	assert.ErrorIs(t, err, ErrInvalidKey, "the stored hash must not be usable as a key")
+}
+
+// TestIsPrefixTaken verifies that only unique violations of a prefix index ask
+// for a new key.
+func TestIsPrefixTaken(t *testing.T) {
+	assert.True(t, IsPrefixTaken(&pq.Error{Code: "23505", Constraint: "merchants_api_key_prefix_key"}))
+	assert.False(t, IsPrefixTaken(&pq.Error{Code: "23505", Constraint: "merchants_name_key"}))
+	assert.False(t, IsPrefixTaken(&pq.Error{Code: "23503", Constraint: "merchants_api_key_prefix_key"}))
+	assert.False(t, IsPrefixTaken(errors.New("connection refused")))
+	assert.False(t, IsPrefixTaken(nil))
+}
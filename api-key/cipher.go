@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinCipherSecretLength is the shortest secret NewKeyCipher accepts.
+	MinCipherSecretLength = 32
+
+	sealedPrefix      = "v1:"
+	cipherSecretLabel = "merchant-signing-key-encryption-v1"
+)
+
+var (
+	// ErrInvalidCipherSecret is returned by NewKeyCipher for a secret shorter
+	// than MinCipherSecretLength.
+	ErrInvalidCipherSecret = errors.New("signing key cipher secret too short")
+
+	// ErrInvalidSealedKey is returned when a stored signing key cannot be
+	// decrypted, because it was stored in plain text, sealed for another key or
+	// encrypted with another secret.
+	ErrInvalidSealedKey = errors.New("invalid sealed signing key")
+)
+
+// KeyCipher encrypts the request signing keys stored in
+// merchant_api_keys.signing_key with AES-256-GCM.
+//
+// A stored signing key is as good as the API key for signing requests, so it
+// must not be readable by whoever can read the table. The cipher is keyed from a
+// secret held in the server configuration, never in the database, and each
+// sealed value is bound to the prefix of its key so rows cannot be swapped.
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher creates a KeyCipher from a configuration secret of at least
+// MinCipherSecretLength bytes. The AES key is derived from the secret, so it
+// may be any string with enough entropy.
+func NewKeyCipher(secret []byte) (*KeyCipher, error) {
+	if len(secret) < MinCipherSecretLength {
+		return nil, fmt.Errorf("%w: %d bytes, need %d", ErrInvalidCipherSecret, len(secret), MinCipherSecretLength)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(cipherSecretLabel))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyCipher{aead: aead}, nil
+}
+
+// Seal encrypts the signing key of the key with the given prefix and returns
+// the value to store, in the form "v1:<hex of nonce and ciphertext>".
+func (c *KeyCipher) Seal(prefix string, signingKey []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, signingKey, []byte(prefix))
+	return sealedPrefix + hex.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal for the key with the given prefix.
+func (c *KeyCipher) Open(prefix, sealed string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return nil, ErrInvalidSealedKey
+	}
+
+	data, err := hex.DecodeString(encoded)
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return nil, ErrInvalidSealedKey
+	}
+
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	signingKey, err := c.aead.Open(nil, nonce, ciphertext, []byte(prefix))
+	if err != nil {
+		return nil, ErrInvalidSealedKey
+	}
+	return signingKey, nil
+}
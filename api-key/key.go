@@ -0,0 +1,152 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// KeyPrefix starts the public part of every merchant API key, which makes
+	// leaked keys easy to recognise in logs and by secret scanners.
+	KeyPrefix = "mk_"
+
+	// LegacyHashPrefix starts the stored hash of a key created by GenerateApiKey,
+	// see MigrateLegacyKeys.
+	LegacyHashPrefix = "lk_"
+
+	// prefixBytes keeps generated prefixes unique in practice; the unique index
+	// on the prefix catches the rare collision, see IsPrefixTaken.
+	prefixBytes = 8
+	secretBytes = 32
+
+	signingKeyLabel = "merchant-request-signing-v1"
+)
+
+// ErrInvalidKey is returned when a string is not a well-formed merchant API key.
+var ErrInvalidKey = errors.New("invalid api key")
+
+// Key is a merchant API key made of a public prefix and a secret.
+//
+// The full key, as returned by String, is shown to the merchant once. Only the
+// value returned by Hash is stored in merchants.api_key, so a database leak does
+// not expose usable keys.
+type Key struct {
+	Prefix string
+	Secret string
+}
+
+// GenerateKey returns a new random merchant API key.
+func GenerateKey() (*Key, error) {
+	prefix := make([]byte, prefixBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Prefix: KeyPrefix + hex.EncodeToString(prefix),
+		Secret: hex.EncodeToString(secret),
+	}, nil
+}
+
+// ParseKey parses a full merchant API key as returned by Key.String.
+func ParseKey(raw string) (*Key, error) {
+	prefix, secret, found := strings.Cut(raw, ".")
+	if !found || !IsValidPrefix(prefix) || !isHex(secret, secretBytes) {
+		return nil, ErrInvalidKey
+	}
+
+	return &Key{Prefix: prefix, Secret: secret}, nil
+}
+
+// IsValidPrefix reports whether s has the form of a key prefix: KeyPrefix
+// followed by 16 hex characters.
+func IsValidPrefix(s string) bool {
+	return strings.HasPrefix(s, KeyPrefix) && isHex(strings.TrimPrefix(s, KeyPrefix), prefixBytes)
+}
+
+// String returns the full key in the form "<prefix>.<secret>".
+func (k *Key) String() string {
+	return k.Prefix + "." + k.Secret
+}
+
+// Hash returns the value stored for the key, in the form "<prefix>.<sha256 of secret>".
+// The secret carries 256 bits of entropy, so a fast hash is enough and lets the
+// key be looked up with an equality match.
+func (k *Key) Hash() string {
+	sum := sha256.Sum256([]byte(k.Secret))
+	return k.Prefix + "." + hex.EncodeToString(sum[:])
+}
+
+// SigningKey returns the key requests are signed with, derived from the secret.
+// The gateway cannot derive it from the hash, so it is stored when the key is
+// issued. Whoever holds it can sign requests for the merchant, so it is only
+// stored encrypted with a KeyCipher.
+func (k *Key) SigningKey() []byte {
+	mac := hmac.New(sha256.New, []byte(k.Secret))
+	mac.Write([]byte(signingKeyLabel))
+	return mac.Sum(nil)
+}
+
+// HashKey parses a full merchant API key and returns its stored hash, ready to
+// be passed to GetMerchantByApiKey. Keys created by GenerateApiKey are accepted
+// too and hashed as MigrateLegacyKeys stores them.
+func HashKey(raw string) (string, error) {
+	if isHex(raw, secretBytes) {
+		return hashLegacyKey(raw), nil
+	}
+
+	key, err := ParseKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return key.Hash(), nil
+}
+
+// VerifyKey reports whether the full key matches the stored hash. The comparison
+// runs in constant time.
+func VerifyKey(raw, hash string) bool {
+	computed, err := HashKey(raw)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// prefixIndex is the unique index on the prefixes in merchants.api_key, see the
+// README. Keys in merchant_api_keys are regenerated by Service instead.
+const prefixIndex = "merchants_api_key_prefix_key"
+
+// IsPrefixTaken reports whether err is the unique violation returned when a
+// generated prefix is already stored in merchants.api_key. The key should then
+// be generated again.
+func IsPrefixTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == prefixIndex
+}
+
+// hashLegacyKey returns the stored hash of a key created by GenerateApiKey. It
+// matches the hash computed by the HashLegacyMerchantApiKeys query.
+func hashLegacyKey(raw string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(raw)))
+	return LegacyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != 2*n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,54 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Scope limits what a merchant API key may be used for.
+type Scope string
+
+const (
+	// ScopeRead allows reading transactions and balances.
+	ScopeRead Scope = "read"
+
+	// ScopePayments allows creating payments.
+	ScopePayments Scope = "payments"
+
+	// ScopeRefunds allows refunding payments.
+	ScopeRefunds Scope = "refunds"
+)
+
+// ErrInvalidScope is returned when a key is created with an unknown scope or without scopes.
+var ErrInvalidScope = errors.New("invalid api key scope")
+
+// AllScopes returns every scope, as granted to legacy keys stored in merchants.api_key.
+func AllScopes() []Scope {
+	return []Scope{ScopeRead, ScopePayments, ScopeRefunds}
+}
+
+// ParseScopes converts scope names, e.g. from a request body or from
+// merchant_api_keys.scopes, to scopes. Unknown names are rejected with
+// ErrInvalidScope.
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(name)
+		if !slices.Contains(AllScopes(), scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func scopeNames(scopes []Scope) []string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return names
+}
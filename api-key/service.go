@@ -0,0 +1,479 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrKeyNotFound is returned when a key does not exist or belongs to another merchant.
+	ErrKeyNotFound = errors.New("api key not found")
+
+	// ErrKeyRevoked is returned when a revoked key is used or rotated.
+	ErrKeyRevoked = errors.New("api key revoked")
+
+	// ErrKeyExpired is returned when an expired key is used or rotated.
+	ErrKeyExpired = errors.New("api key expired")
+
+	// ErrNoSigningKey is returned when a key that has no signing key is used to
+	// sign a request.
+	ErrNoSigningKey = errors.New("api key cannot sign requests")
+)
+
+const (
+	// touchInterval is how stale last_used_at may get before a request updates
+	// it, so that busy keys do not cause a write on every request.
+	touchInterval = time.Minute
+
+	// createAttempts is how often create generates a key whose prefix is taken.
+	createAttempts = 3
+)
+
+// MerchantKey is a stored merchant API key. The secret is never kept; it is only
+// returned once in IssuedKey.
+type MerchantKey struct {
+	ID         int        `json:"id"`
+	MerchantID int        `json:"merchant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []Scope    `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Legacy is set for the key stored in merchants.api_key, which has every scope.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// HasScope reports whether the key was granted the scope.
+func (k *MerchantKey) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// IssuedKey is a newly created key together with the full key string, which
+// must be shown to the merchant now because it cannot be recovered later.
+type IssuedKey struct {
+	*MerchantKey
+	Key string `json:"key"`
+}
+
+// CreateKeyRequest describes a key to create.
+type CreateKeyRequest struct {
+	Name   string
+	Scopes []Scope
+	// TTL is the lifetime of the key, or zero for keys that do not expire.
+	TTL time.Duration
+}
+
+// Service manages the named, scoped API keys of merchants stored in
+// merchant_api_keys. A merchant may hold several keys, so a key can be rotated
+// while the previous one keeps working for an overlap window.
+//
+// The key in merchants.api_key, from before merchants could hold several keys,
+// is rotated by hand: Create a key with the scopes the integration needs, switch
+// the integration over, then retire the old key with RevokeLegacy.
+type Service struct {
+	db      *sql.DB
+	queries *db.Queries
+	cipher  *KeyCipher
+	logger  logger.LoggerInterface
+	now     func() time.Time
+}
+
+// NewService creates a new Service.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - cipher: The cipher the stored signing keys are encrypted with (*KeyCipher)
+//   - logger: The logger used to report key changes (logger.LoggerInterface)
+//
+// Returns:
+//   - *Service: The initialized service
+func NewService(conn *sql.DB, queries *db.Queries, cipher *KeyCipher, logger logger.LoggerInterface) *Service {
+	return &Service{
+		db:      conn,
+		queries: queries,
+		cipher:  cipher,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Create generates a new key for the merchant. The returned IssuedKey holds the
+// full key, which is not stored.
+func (s *Service) Create(ctx context.Context, merchantID int, req CreateKeyRequest) (*IssuedKey, error) {
+	issued, err := s.create(ctx, s.queries, merchantID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Merchant api key created",
+		zap.Int("merchant.id", merchantID),
+		zap.Int("api_key.id", issued.ID),
+		zap.String("api_key.prefix", issued.Prefix),
+	)
+	return issued, nil
+}
+
+// List returns the keys of the merchant that are neither revoked nor expired,
+// newest first. Keys in a rotation overlap are listed until they expire.
+func (s *Service) List(ctx context.Context, merchantID int) ([]*MerchantKey, error) {
+	rows, err := s.queries.GetMerchantApiKeys(ctx, int32(merchantID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api keys: %w", err)
+	}
+
+	keys := make([]*MerchantKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, toMerchantKey(row))
+	}
+	return keys, nil
+}
+
+// Revoke disables a key of the merchant immediately. ErrKeyNotFound is returned
+// when the merchant has no such key or it is already revoked.
+func (s *Service) Revoke(ctx context.Context, merchantID, keyID int) error {
+	revoked, err := s.queries.RevokeMerchantApiKey(ctx, db.RevokeMerchantApiKeyParams{
+		ApiKeyID:   int32(keyID),
+		MerchantID: int32(merchantID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if revoked == 0 {
+		return ErrKeyNotFound
+	}
+
+	s.logger.Info("Merchant api key revoked",
+		zap.Int("merchant.id", merchantID),
+		zap.Int("api_key.id", keyID),
+	)
+	return nil
+}
+
+// RevokeLegacy disables the key of the merchant stored in merchants.api_key,
+// once its integration uses a key from Create. ErrKeyNotFound is returned when
+// the merchant is unknown or the key is already revoked.
+func (s *Service) RevokeLegacy(ctx context.Context, merchantID int) error {
+	revoked, err := s.queries.RevokeLegacyMerchantApiKey(ctx, int32(merchantID))
+	if err != nil {
+		return fmt.Errorf("failed to revoke legacy api key: %w", err)
+	}
+	if revoked == 0 {
+		return ErrKeyNotFound
+	}
+
+	s.logger.Info("Legacy merchant api key revoked", zap.Int("merchant.id", merchantID))
+	return nil
+}
+
+// Rotate replaces a key of the merchant with a new key of the same name and
+// scopes. The old key keeps working for overlap, giving integrations time to
+// switch, or is revoked at once when overlap is zero. A key with an expiry is
+// replaced by one with the same lifetime.
+func (s *Service) Rotate(ctx context.Context, merchantID, keyID int, overlap time.Duration) (*IssuedKey, error) {
+	var issued *IssuedKey
+
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		old, err := q.GetMerchantApiKey(ctx, db.GetMerchantApiKeyParams{
+			ApiKeyID:   int32(keyID),
+			MerchantID: int32(merchantID),
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrKeyNotFound
+			}
+			return fmt.Errorf("failed to get api key: %w", err)
+		}
+		if err := s.checkActive(old); err != nil {
+			return err
+		}
+
+		scopes, err := ParseScopes(old.Scopes)
+		if err != nil {
+			return err
+		}
+		req := CreateKeyRequest{Name: old.Name, Scopes: scopes}
+		if old.ExpiresAt.Valid {
+			req.TTL = old.ExpiresAt.Time.Sub(old.CreatedAt)
+		}
+
+		issued, err = s.create(ctx, q, merchantID, req)
+		if err != nil {
+			return err
+		}
+
+		var updated int64
+		if overlap > 0 {
+			updated, err = q.ExpireMerchantApiKey(ctx, db.ExpireMerchantApiKeyParams{
+				ApiKeyID:   old.ApiKeyID,
+				MerchantID: old.MerchantID,
+				ExpiresAt:  s.now().Add(overlap),
+			})
+		} else {
+			updated, err = q.RevokeMerchantApiKey(ctx, db.RevokeMerchantApiKeyParams{
+				ApiKeyID:   old.ApiKeyID,
+				MerchantID: old.MerchantID,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retire api key: %w", err)
+		}
+		if updated == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Merchant api key rotated",
+		zap.Int("merchant.id", merchantID),
+		zap.Int("api_key.id", keyID),
+		zap.Int("api_key.new_id", issued.ID),
+		zap.Duration("overlap", overlap),
+	)
+	return issued, nil
+}
+
+// Authenticate finds the merchant and the key for a full API key as sent in the
+// X-Api-Key header.
+//
+// Keys that are not in merchant_api_keys are looked up in merchants.api_key, so
+// keys issued before multiple keys existed, including those created by
+// GenerateApiKey, keep working with every scope until RevokeLegacy retires
+// them. Malformed or unknown keys return ErrInvalidKey, revoked and expired keys
+// ErrKeyRevoked and ErrKeyExpired.
+func (s *Service) Authenticate(ctx context.Context, raw string) (*db.Merchant, *MerchantKey, error) {
+	hash, err := HashKey(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ParseKey(raw)
+	if err != nil {
+		// A key created by GenerateApiKey, which has no prefix.
+		return s.authenticateLegacy(ctx, hash, "")
+	}
+
+	row, err := s.queries.GetMerchantApiKeyByPrefix(ctx, key.Prefix)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.authenticateLegacy(ctx, hash, key.Prefix)
+		}
+		return nil, nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if !VerifyKey(raw, row.KeyHash) {
+		return nil, nil, ErrInvalidKey
+	}
+	if err := s.checkActive(row); err != nil {
+		return nil, nil, err
+	}
+
+	merchant, err := s.merchant(ctx, row)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merchant, toMerchantKey(row), nil
+}
+
+// SigningKey finds the merchant, the key and the request signing key for the
+// key ID of a signed request.
+//
+// The ID must have the form of a key prefix and is looked up in
+// merchant_api_keys, then in merchants.api_key. Malformed or unknown IDs return
+// ErrInvalidKey, revoked and expired keys ErrKeyRevoked and ErrKeyExpired. Keys
+// without a stored signing key, which includes the key in merchants.api_key,
+// return ErrNoSigningKey; the merchant has to use a key from Create or Rotate.
+// The stored signing key is decrypted with the KeyCipher of the service.
+func (s *Service) SigningKey(ctx context.Context, keyID string) (*db.Merchant, *MerchantKey, []byte, error) {
+	if !IsValidPrefix(keyID) {
+		return nil, nil, nil, ErrInvalidKey
+	}
+
+	row, err := s.queries.GetMerchantApiKeyByPrefix(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil, s.legacySigningKey(ctx, keyID)
+		}
+		return nil, nil, nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if err := s.checkActive(row); err != nil {
+		return nil, nil, nil, err
+	}
+	if !row.SigningKey.Valid {
+		return nil, nil, nil, ErrNoSigningKey
+	}
+	signingKey, err := s.cipher.Open(row.Prefix, row.SigningKey.String)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+	}
+
+	merchant, err := s.merchant(ctx, row)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return merchant, toMerchantKey(row), signingKey, nil
+}
+
+// merchant returns the merchant of a key that was just used, and records the use.
+func (s *Service) merchant(ctx context.Context, row *db.MerchantApiKey) (*db.Merchant, error) {
+	merchant, err := s.queries.GetMerchantByID(ctx, row.MerchantID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidKey
+		}
+		return nil, fmt.Errorf("failed to get merchant: %w", err)
+	}
+
+	if !row.LastUsedAt.Valid || s.now().Sub(row.LastUsedAt.Time) >= touchInterval {
+		if err := s.queries.TouchMerchantApiKey(ctx, row.ApiKeyID); err != nil {
+			s.logger.Error("Failed to record api key use",
+				zap.Int("api_key.id", int(row.ApiKeyID)),
+				zap.Error(err),
+			)
+		}
+	}
+	return merchant, nil
+}
+
+// legacySigningKey tells a key in merchants.api_key, which has no signing key,
+// apart from an unknown key ID.
+func (s *Service) legacySigningKey(ctx context.Context, keyID string) error {
+	if _, err := s.queries.GetMerchantByApiKeyPrefix(ctx, keyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidKey
+		}
+		return fmt.Errorf("failed to get merchant: %w", err)
+	}
+	return ErrNoSigningKey
+}
+
+func (s *Service) authenticateLegacy(ctx context.Context, hash, prefix string) (*db.Merchant, *MerchantKey, error) {
+	merchant, err := s.queries.GetMerchantByApiKey(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrInvalidKey
+		}
+		return nil, nil, fmt.Errorf("failed to get merchant: %w", err)
+	}
+
+	return merchant, &MerchantKey{
+		MerchantID: int(merchant.MerchantID),
+		Name:       "legacy",
+		Prefix:     prefix,
+		Scopes:     AllScopes(),
+		CreatedAt:  merchant.CreatedAt.Time,
+		Legacy:     true,
+	}, nil
+}
+
+func (s *Service) create(ctx context.Context, q *db.Queries, merchantID int, req CreateKeyRequest) (*IssuedKey, error) {
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	if _, err := ParseScopes(scopeNames(req.Scopes)); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "default"
+	}
+
+	var expiresAt sql.NullTime
+	if req.TTL > 0 {
+		expiresAt = sql.NullTime{Time: s.now().Add(req.TTL), Valid: true}
+	}
+
+	for attempt := 1; ; attempt++ {
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate api key: %w", err)
+		}
+		signingKey, err := s.cipher.Seal(key.Prefix, key.SigningKey())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+		}
+
+		row, err := q.CreateMerchantApiKey(ctx, db.CreateMerchantApiKeyParams{
+			MerchantID: int32(merchantID),
+			Name:       name,
+			Prefix:     key.Prefix,
+			KeyHash:    key.Hash(),
+			Scopes:     scopeNames(req.Scopes),
+			ExpiresAt:  expiresAt,
+			SigningKey: sql.NullString{String: signingKey, Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) && attempt < createAttempts {
+			// The prefix is taken.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create api key: %w", err)
+		}
+
+		return &IssuedKey{MerchantKey: toMerchantKey(row), Key: key.String()}, nil
+	}
+}
+
+func (s *Service) checkActive(row *db.MerchantApiKey) error {
+	if row.RevokedAt.Valid {
+		return ErrKeyRevoked
+	}
+	if row.ExpiresAt.Valid && !row.ExpiresAt.Time.After(s.now()) {
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+func (s *Service) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func toMerchantKey(row *db.MerchantApiKey) *MerchantKey {
+	key := &MerchantKey{
+		ID:         int(row.ApiKeyID),
+		MerchantID: int(row.MerchantID),
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Scopes:     make([]Scope, 0, len(row.Scopes)),
+		CreatedAt:  row.CreatedAt,
+	}
+	for _, name := range row.Scopes {
+		key.Scopes = append(key.Scopes, Scope(name))
+	}
+	if row.ExpiresAt.Valid {
+		key.ExpiresAt = &row.ExpiresAt.Time
+	}
+	if row.LastUsedAt.Valid {
+		key.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return key
+}
@@ -0,0 +1,423 @@
+package apikey
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var (
+	apiKeyColumns   = []string{"api_key_id", "merchant_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at", "signing_key"}
+	merchantColumns = []string{"merchant_id", "merchant_no", "name", "api_key", "user_id", "status", "created_at", "updated_at", "deleted_at"}
+)
+
+// testCipher encrypts the signing keys of the test services.
+var testCipher = mustKeyCipher("0123456789abcdef0123456789abcdef")
+
+func mustKeyCipher(secret string) *KeyCipher {
+	c, err := NewKeyCipher([]byte(secret))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// signingKeyArg matches the sealed signing key stored with a new key.
+type signingKeyArg struct{}
+
+func (signingKeyArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, sealedPrefix) {
+		return false
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, sealedPrefix))
+	// nonce, 32 byte signing key and tag
+	return err == nil && len(b) == 12+32+16
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock, time.Time) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewService(conn, db.New(conn), testCipher, &logger.Logger{Log: zap.NewNop()})
+	svc.now = func() time.Time { return now }
+	return svc, mock, now
+}
+
+func merchantRow() *sqlmock.Rows {
+	return sqlmock.NewRows(merchantColumns).
+		AddRow(3, uuid.New(), "Shop", "", 1, "active", nil, nil, nil)
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"read", "payments", "read"})
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeRead, ScopePayments}, scopes)
+
+	_, err = ParseScopes([]string{"read", "admin"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestService_Create(t *testing.T) {
+	svc, mock, now := newTestService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO merchant_api_keys")).
+		WithArgs(int32(3), "production", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"read","refunds"}`, now.Add(24*time.Hour), signingKeyArg{}).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", "mk_00000000", "hash", "{read,refunds}", now.Add(24*time.Hour), nil, nil, now, nil))
+
+	issued, err := svc.Create(context.Background(), 3, CreateKeyRequest{
+		Name:   "production",
+		Scopes: []Scope{ScopeRead, ScopeRefunds},
+		TTL:    24 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	_, err = ParseKey(issued.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeRead, ScopeRefunds}, issued.Scopes)
+	assert.True(t, issued.HasScope(ScopeRefunds))
+	assert.False(t, issued.HasScope(ScopePayments))
+	require.NotNil(t, issued.ExpiresAt)
+
+	_, err = svc.Create(context.Background(), 3, CreateKeyRequest{Name: "empty"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_Authenticate(t *testing.T) {
+	svc, mock, now := newTestService(t)
+	ctx := context.Background()
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", key.Prefix, key.Hash(), "{payments}", nil, now.Add(-time.Hour), nil, now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM merchants")).
+		WithArgs(int32(3)).
+		WillReturnRows(merchantRow())
+	mock.ExpectExec(regexp.QuoteMeta("SET last_used_at = current_timestamp")).
+		WithArgs(int32(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	merchant, mk, err := svc.Authenticate(ctx, key.String())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), merchant.MerchantID)
+	assert.Equal(t, 1, mk.ID)
+	assert.True(t, mk.HasScope(ScopePayments))
+
+	// A key used moments ago is not touched again.
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", key.Prefix, key.Hash(), "{payments}", nil, now.Add(-time.Second), nil, now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM merchants")).
+		WithArgs(int32(3)).
+		WillReturnRows(merchantRow())
+
+	_, _, err = svc.Authenticate(ctx, key.String())
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_AuthenticateRejected(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	other, err := GenerateKey()
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		row     []driver.Value
+		wantErr error
+	}{
+		{
+			name:    "wrong secret",
+			row:     []driver.Value{1, 3, "production", key.Prefix, other.Hash(), "{read}", nil, nil, nil, now, nil},
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name:    "revoked",
+			row:     []driver.Value{1, 3, "production", key.Prefix, key.Hash(), "{read}", nil, nil, now.Add(-time.Minute), now, nil},
+			wantErr: ErrKeyRevoked,
+		},
+		{
+			name:    "expired",
+			row:     []driver.Value{1, 3, "production", key.Prefix, key.Hash(), "{read}", now.Add(-time.Minute), nil, nil, now, nil},
+			wantErr: ErrKeyExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, mock, _ := newTestService(t)
+
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+				WithArgs(key.Prefix).
+				WillReturnRows(sqlmock.NewRows(apiKeyColumns).AddRow(tt.row...))
+
+			_, _, err := svc.Authenticate(context.Background(), key.String())
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestService_AuthenticateLegacy(t *testing.T) {
+	svc, mock, _ := newTestService(t)
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE api_key = $1")).
+		WithArgs(key.Hash()).
+		WillReturnRows(merchantRow())
+
+	merchant, mk, err := svc.Authenticate(context.Background(), key.String())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), merchant.MerchantID)
+	assert.True(t, mk.Legacy)
+	assert.Equal(t, AllScopes(), mk.Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_SigningKey(t *testing.T) {
+	svc, mock, now := newTestService(t)
+	ctx := context.Background()
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	signingKey, err := testCipher.Seal(key.Prefix, key.SigningKey())
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", key.Prefix, key.Hash(), "{payments}", nil, now, nil, now, signingKey))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM merchants")).
+		WithArgs(int32(3)).
+		WillReturnRows(merchantRow())
+
+	merchant, mk, got, err := svc.SigningKey(ctx, key.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), merchant.MerchantID)
+	assert.Equal(t, 1, mk.ID)
+	assert.Equal(t, key.SigningKey(), got)
+	assert.NotEqual(t, key.Hash(), string(got), "the hash must never be the signing key")
+
+	// A signing key stored in plain text is not accepted.
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", key.Prefix, key.Hash(), "{payments}", nil, now, nil, now, hex.EncodeToString(key.SigningKey())))
+
+	_, _, _, err = svc.SigningKey(ctx, key.Prefix)
+	assert.ErrorIs(t, err, ErrInvalidSealedKey)
+
+	// Keys issued before request signing have no signing key.
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", key.Prefix, key.Hash(), "{payments}", nil, now, nil, now, nil))
+
+	_, _, _, err = svc.SigningKey(ctx, key.Prefix)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	// So has the key in merchants.api_key, which is looked up by equality.
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE split_part(api_key, '.', 1) = $1::TEXT")).
+		WithArgs(key.Prefix).
+		WillReturnRows(merchantRow())
+
+	_, _, _, err = svc.SigningKey(ctx, key.Prefix)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE prefix = $1")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE split_part(api_key, '.', 1) = $1::TEXT")).
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows(merchantColumns))
+
+	_, _, _, err = svc.SigningKey(ctx, key.Prefix)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// IDs that are not a key prefix never reach the database.
+	for _, keyID := range []string{"mk_%", "mk__", key.Prefix + "0", key.String()} {
+		_, _, _, err = svc.SigningKey(ctx, keyID)
+		assert.ErrorIs(t, err, ErrInvalidKey, keyID)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyCipher(t *testing.T) {
+	_, err := NewKeyCipher([]byte("too short"))
+	assert.ErrorIs(t, err, ErrInvalidCipherSecret)
+
+	signingKey := []byte("0123456789abcdef0123456789abcdef")
+	sealed, err := testCipher.Seal("mk_0011223344556677", signingKey)
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, hex.EncodeToString(signingKey))
+
+	opened, err := testCipher.Open("mk_0011223344556677", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, signingKey, opened)
+
+	// A sealed value only opens for its own key and with the same secret.
+	_, err = testCipher.Open("mk_8899aabbccddeeff", sealed)
+	assert.ErrorIs(t, err, ErrInvalidSealedKey)
+
+	other := mustKeyCipher("fedcba9876543210fedcba9876543210")
+	_, err = other.Open("mk_0011223344556677", sealed)
+	assert.ErrorIs(t, err, ErrInvalidSealedKey)
+
+	_, err = testCipher.Open("mk_0011223344556677", hex.EncodeToString(signingKey))
+	assert.ErrorIs(t, err, ErrInvalidSealedKey)
+}
+
+func TestService_CreateRetriesTakenPrefix(t *testing.T) {
+	svc, mock, now := newTestService(t)
+
+	// ON CONFLICT DO NOTHING returns no row for a taken prefix.
+	mock.ExpectQuery(regexp.QuoteMeta("ON CONFLICT (prefix) DO NOTHING")).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("ON CONFLICT (prefix) DO NOTHING")).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "default", "mk_1111111111111111", "hash", "{read}", nil, nil, nil, now, nil))
+
+	issued, err := svc.Create(context.Background(), 3, CreateKeyRequest{Scopes: []Scope{ScopeRead}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, issued.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_AuthenticateGeneratedApiKey(t *testing.T) {
+	svc, mock, _ := newTestService(t)
+
+	legacy, err := GenerateApiKey()
+	require.NoError(t, err)
+	hash, err := HashKey(legacy)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE api_key = $1")).
+		WithArgs(hash).
+		WillReturnRows(merchantRow())
+
+	merchant, mk, err := svc.Authenticate(context.Background(), legacy)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), merchant.MerchantID)
+	assert.True(t, mk.Legacy)
+	assert.Empty(t, mk.Prefix)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_RevokeLegacy(t *testing.T) {
+	svc, mock, _ := newTestService(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET api_key = 'revoked:' || api_key")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET api_key = 'revoked:' || api_key")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, svc.RevokeLegacy(context.Background(), 3))
+	assert.ErrorIs(t, svc.RevokeLegacy(context.Background(), 3), ErrKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_Rotate(t *testing.T) {
+	svc, mock, now := newTestService(t)
+	created := now.Add(-10 * 24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE api_key_id = $1\n  AND merchant_id = $2")).
+		WithArgs(int32(1), int32(3)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(1, 3, "production", "mk_00000000", "hash", "{read,payments}", created.Add(30*24*time.Hour), nil, nil, created, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO merchant_api_keys")).
+		WithArgs(int32(3), "production", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"read","payments"}`, now.Add(30*24*time.Hour), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(2, 3, "production", "mk_11111111", "hash", "{read,payments}", now.Add(30*24*time.Hour), nil, nil, now, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET expires_at = LEAST(COALESCE(expires_at, $3), $3)")).
+		WithArgs(int32(1), int32(3), now.Add(time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	issued, err := svc.Rotate(context.Background(), 3, 1, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, issued.ID)
+	assert.Equal(t, "production", issued.Name)
+	assert.NotEmpty(t, issued.Key)
+
+	// Without overlap the old key is revoked at once.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE api_key_id = $1\n  AND merchant_id = $2")).
+		WithArgs(int32(2), int32(3)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(2, 3, "production", "mk_11111111", "hash", "{read}", nil, nil, nil, now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO merchant_api_keys")).
+		WithArgs(int32(3), "production", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"read"}`, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(3, 3, "production", "mk_22222222", "hash", "{read}", nil, nil, nil, now, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET revoked_at = current_timestamp")).
+		WithArgs(int32(2), int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err = svc.Rotate(context.Background(), 3, 2, 0)
+	require.NoError(t, err)
+
+	// Revoked keys cannot be rotated.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE api_key_id = $1\n  AND merchant_id = $2")).
+		WithArgs(int32(2), int32(3)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(2, 3, "production", "mk_11111111", "hash", "{read}", nil, nil, now, now, nil))
+	mock.ExpectRollback()
+
+	_, err = svc.Rotate(context.Background(), 3, 2, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_Revoke(t *testing.T) {
+	svc, mock, _ := newTestService(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET revoked_at = current_timestamp")).
+		WithArgs(int32(1), int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET revoked_at = current_timestamp")).
+		WithArgs(int32(1), int32(4)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, svc.Revoke(context.Background(), 3, 1))
+	assert.ErrorIs(t, svc.Revoke(context.Background(), 4, 1), ErrKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
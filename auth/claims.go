@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrMissingSubject is returned when a token has no subject claim.
+	ErrMissingSubject = errors.New("token has no subject")
+
+	// ErrInvalidAudience is returned when a token is not issued for any of the accepted audiences.
+	ErrInvalidAudience = errors.New("token has invalid audience")
+)
+
+// Claims are the claims carried by tokens issued by a Manager. The subject holds
+// the user ID, the remaining fields let services authorize a request without
+// querying user_roles again.
+//
+// IssuedAtNanos repeats the issue time in Unix nanoseconds, because iat only
+// has second precision and a per-user cut-off must also catch tokens issued
+// earlier in the same second.
+type Claims struct {
+	Type          TokenType `json:"typ,omitempty"`
+	Roles         []string  `json:"roles,omitempty"`
+	MerchantID    int       `json:"merchant_id,omitempty"`
+	SessionID     string    `json:"sid,omitempty"`
+	Scopes        []string  `json:"scopes,omitempty"`
+	IssuedAtNanos int64     `json:"iat_ns,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewClaims returns claims for the given user ID with the given audience.
+// Issuer, issue time and expiry are filled in by the Manager when the token is generated.
+func NewClaims(userId int, audience ...string) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  strconv.Itoa(userId),
+			Audience: audience,
+		},
+	}
+}
+
+// UserID returns the subject of the claims parsed as a user ID.
+func (c *Claims) UserID() (int, error) {
+	if c.Subject == "" {
+		return 0, ErrMissingSubject
+	}
+
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject %q: %w", c.Subject, err)
+	}
+	return id, nil
+}
+
+// issueTime returns the issue time at the precision of iat_ns, falling back to
+// iat, or the zero time when the claims have neither.
+func (c *Claims) issueTime() time.Time {
+	if c.IssuedAtNanos > 0 {
+		return time.Unix(0, c.IssuedAtNanos)
+	}
+	if c.IssuedAt != nil {
+		return c.IssuedAt.Time
+	}
+	return time.Time{}
+}
+
+// HasRole reports whether the claims carry the given role name.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope reports whether the claims carry the given scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// RoleNames returns the names of the given roles, as returned by GetUserRoles,
+// ready to be put into Claims.Roles.
+func RoleNames(roles []*db.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.RoleName)
+	}
+	return names
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleNames(t *testing.T) {
+	roles := []*db.Role{{RoleID: 1, RoleName: "ROLE_ADMIN"}, {RoleID: 2, RoleName: "ROLE_MERCHANT"}}
+
+	claims := NewClaims(1)
+	claims.Roles = RoleNames(roles)
+
+	assert.Equal(t, []string{"ROLE_ADMIN", "ROLE_MERCHANT"}, claims.Roles)
+	assert.True(t, claims.HasRole("ROLE_MERCHANT"))
+	assert.False(t, claims.HasRole("ROLE_USER"))
+}
+
+func TestClaims_UserID(t *testing.T) {
+	_, err := (&Claims{}).UserID()
+	assert.True(t, errors.Is(err, ErrMissingSubject))
+
+	claims := NewClaims(0)
+	claims.Subject = "not-a-number"
+	_, err = claims.UserID()
+	assert.Error(t, err)
+}
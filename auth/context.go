@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type claimsContextKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying the given claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored in ctx by ContextWithClaims.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrSigningNotSupported is returned by token managers that can only verify tokens.
+var ErrSigningNotSupported = errors.New("token signing not supported")
+
+// JWK is a single public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWKS builds a JWKS document from the public keys of the key set.
+// HMAC keys are never published.
+func NewJWKS(keys *KeySet) (*JWKS, error) {
+	doc := &JWKS{Keys: []JWK{}}
+
+	for _, key := range keys.Keys() {
+		public := key.Public()
+		if public == nil {
+			continue
+		}
+
+		jwk, err := newJWK(key.ID, key.Method.Alg(), public)
+		if err != nil {
+			return nil, err
+		}
+		doc.Keys = append(doc.Keys, jwk)
+	}
+
+	return doc, nil
+}
+
+// JWKS returns the JWKS document with the public keys of the Manager.
+func (m *Manager) JWKS() (*JWKS, error) {
+	return NewJWKS(m.keys)
+}
+
+// NewJWKSHandler returns an http.Handler that serves the public keys of the
+// Manager as a JWKS document, typically mounted at /.well-known/jwks.json.
+//
+// The document is built on every request so rotated keys are published immediately.
+func NewJWKSHandler(m *Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		doc, err := m.JWKS()
+		if err != nil {
+			http.Error(w, "failed to build jwks", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(doc)
+	})
+}
+
+func newJWK(kid, alg string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{Kid: kid, Use: "sig", Alg: alg}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeSegment(pub.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeSegment(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeSegment(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeSegment(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	return jwk, nil
+}
+
+// SigningKey converts the JWK into a verify-only signing key.
+func (j JWK) SigningKey() (*SigningKey, error) {
+	var public crypto.PublicKey
+
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeSegment(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(j.E)
+		if err != nil {
+			return nil, err
+		}
+		public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeSegment(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		public = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeSegment(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key")
+		}
+		public = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+
+	key, err := NewVerificationKey(j.Kid, public)
+	if err != nil {
+		return nil, err
+	}
+	if j.Alg != "" && j.Alg != key.Method.Alg() {
+		return nil, fmt.Errorf("jwk %q: alg %s does not match key type", j.Kid, j.Alg)
+	}
+
+	return key, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// JWKSConfig represents the configuration for a JWKSValidator.
+type JWKSConfig struct {
+	// URL is the location of the JWKS document.
+	URL string
+	// Client is the HTTP client used to fetch the document. Defaults to a client with a 10s timeout.
+	Client *http.Client
+	// RefreshInterval is how long a fetched document is used before it is fetched again. Defaults to 15 minutes.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits how often an unknown kid can trigger a refetch. Defaults to 1 minute.
+	MinRefreshInterval time.Duration
+	// Issuer, when set, is the only issuer accepted.
+	Issuer string
+	// Audience, when set, lists the accepted audiences.
+	Audience []string
+	// Revocations, when set, is consulted for revoked tokens.
+	Revocations RevocationStore
+	// Leeway allows for clock skew with the issuer.
+	Leeway time.Duration
+}
+
+// JWKSValidator verifies tokens with public keys fetched from a remote JWKS
+// document. Keys are cached and refreshed periodically, and a token signed with
+// an unknown kid triggers an early refresh so rotations are picked up quickly.
+//
+// JWKSValidator implements TokenManager but cannot sign tokens.
+type JWKSValidator struct {
+	cfg JWKSConfig
+	claimsValidator
+
+	mu        sync.RWMutex
+	keys      map[string]*SigningKey
+	fetchedAt time.Time
+	checkedAt time.Time
+	refreshMu sync.Mutex
+}
+
+// NewJWKSValidator creates a validator that fetches keys from cfg.URL. Keys are
+// fetched lazily on the first validation, call Refresh to fetch them up front.
+func NewJWKSValidator(cfg JWKSConfig) (*JWKSValidator, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("empty jwks url")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 15 * time.Minute
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+
+	return &JWKSValidator{
+		cfg: cfg,
+		claimsValidator: claimsValidator{
+			issuer:      cfg.Issuer,
+			audience:    cfg.Audience,
+			leeway:      cfg.Leeway,
+			revocations: cfg.Revocations,
+		},
+		keys: make(map[string]*SigningKey),
+	}, nil
+}
+
+// GenerateToken always fails with ErrSigningNotSupported.
+func (v *JWKSValidator) GenerateToken(claims *Claims) (string, error) {
+	return "", ErrSigningNotSupported
+}
+
+// ValidateToken validates a JWT token against the remote key set and returns its
+// claims if the validation is successful. Issuer and audience are checked the
+// same way as by Manager.ValidateToken.
+func (v *JWKSValidator) ValidateToken(accessToken string) (*Claims, error) {
+	return v.ValidateTokenContext(context.Background(), accessToken)
+}
+
+// ValidateTokenContext is like ValidateToken but uses ctx for the revocation lookup.
+func (v *JWKSValidator) ValidateTokenContext(ctx context.Context, accessToken string) (*Claims, error) {
+	return v.parse(ctx, accessToken, v.keyFunc, TokenTypeAccess, v.audience)
+}
+
+// Refresh fetches the JWKS document and replaces the cached keys.
+func (v *JWKSValidator) Refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	return v.fetch(ctx)
+}
+
+func (v *JWKSValidator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := v.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+func (v *JWKSValidator) lookup(kid string) (*SigningKey, error) {
+	key, fetchedAt, checkedAt := v.cached(kid)
+	if key != nil && time.Since(fetchedAt) <= v.cfg.RefreshInterval {
+		return key, nil
+	}
+
+	var fetchErr error
+	if time.Since(checkedAt) > v.cfg.MinRefreshInterval {
+		v.refreshMu.Lock()
+		// Another goroutine may have refreshed while we waited for the lock.
+		if _, _, latest := v.cached(kid); latest.Equal(checkedAt) {
+			fetchErr = v.fetch(context.Background())
+		}
+		v.refreshMu.Unlock()
+
+		key, _, _ = v.cached(kid)
+	}
+
+	if key == nil {
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// cached returns the key with the given kid, or the only cached key when the
+// token carries no kid, along with the time of the last successful fetch and
+// of the last fetch attempt.
+func (v *JWKSValidator) cached(kid string) (*SigningKey, time.Time, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, v.fetchedAt, v.checkedAt
+		}
+	}
+	return v.keys[kid], v.fetchedAt, v.checkedAt
+}
+
+func (v *JWKSValidator) fetch(ctx context.Context) error {
+	v.mu.Lock()
+	v.checkedAt = time.Now()
+	v.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build jwks request: %w", err)
+	}
+
+	resp, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]*SigningKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.SigningKey()
+		if err != nil {
+			// Skip keys we do not understand instead of rejecting the whole set.
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ TokenManager = (*JWKSValidator)(nil)
+
+func TestJWKSHandler(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	es256, err := NewECDSAKey("ec-1", ecKey)
+	require.NoError(t, err)
+	eddsa, err := NewEd25519Key("ed-1", edKey)
+	require.NoError(t, err)
+	hmac, err := NewHMACKey("hmac-1", []byte(secretKey))
+	require.NoError(t, err)
+
+	keys, err := NewKeySet(newRSAKey(t, "rsa-1"), es256, eddsa, hmac)
+	require.NoError(t, err)
+	mgr, err := NewManagerWithKeySet(keys)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	NewJWKSHandler(mgr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var doc JWKS
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&doc))
+	require.Len(t, doc.Keys, 3, "hmac keys must not be published")
+
+	for _, jwk := range doc.Keys {
+		key, err := jwk.SigningKey()
+		require.NoError(t, err)
+
+		original, ok := keys.Lookup(jwk.Kid)
+		require.True(t, ok)
+		assert.Equal(t, original.Method, key.Method)
+		assert.Equal(t, original.Public(), key.Public())
+	}
+
+	rec = httptest.NewRecorder()
+	NewJWKSHandler(mgr).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestJWKSValidator_ValidateToken(t *testing.T) {
+	keys, err := NewKeySet(newRSAKey(t, "rsa-1"))
+	require.NoError(t, err)
+	mgr, err := NewManagerWithKeySet(keys)
+	require.NoError(t, err)
+
+	var fetches int32
+	jwks := NewJWKSHandler(mgr)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		jwks.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	validator, err := NewJWKSValidator(JWKSConfig{URL: srv.URL, MinRefreshInterval: time.Nanosecond})
+	require.NoError(t, err)
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(7, "gateway"))
+	require.NoError(t, err)
+
+	claims, err := validator.ValidateToken(tokenStr)
+	require.NoError(t, err)
+	assert.Equal(t, "7", claims.Subject)
+
+	_, err = validator.ValidateToken(tokenStr)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "keys should be served from cache")
+
+	require.NoError(t, keys.Rotate(newRSAKey(t, "rsa-2")))
+	rotated, err := mgr.GenerateToken(NewClaims(8, "gateway"))
+	require.NoError(t, err)
+
+	claims, err = validator.ValidateToken(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "8", claims.Subject)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches), "unknown kid should trigger a refresh")
+
+	_, err = validator.GenerateToken(NewClaims(1, "gateway"))
+	assert.True(t, errors.Is(err, ErrSigningNotSupported))
+}
+
+func TestJWKSValidator_UnknownKeyIsRateLimited(t *testing.T) {
+	keys, err := NewKeySet(newRSAKey(t, "rsa-1"))
+	require.NoError(t, err)
+	mgr, err := NewManagerWithKeySet(keys)
+	require.NoError(t, err)
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: []JWK{}})
+	}))
+	defer srv.Close()
+
+	validator, err := NewJWKSValidator(JWKSConfig{URL: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, validator.Refresh(context.Background()))
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(7, "gateway"))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = validator.ValidateToken(tokenStr)
+		assert.True(t, errors.Is(err, ErrUnknownKey))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
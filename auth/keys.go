@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrUnknownKey is returned when a token references a kid that is not in the key set.
+	ErrUnknownKey = errors.New("unknown signing key")
+
+	// ErrVerifyOnlyKey is returned when a key without private material is used for signing.
+	ErrVerifyOnlyKey = errors.New("signing key has no private key")
+)
+
+// SigningKey is a single key identified by its kid. A key built from a private key
+// can both sign and verify tokens, a key built from a public key can only verify them.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates an HS256 key from a shared secret.
+func NewHMACKey(id string, secret []byte) (*SigningKey, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret key")
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+// NewRSAKey creates an RS256 key from an RSA private key.
+func NewRSAKey(id string, key *rsa.PrivateKey) (*SigningKey, error) {
+	if key == nil {
+		return nil, errors.New("nil rsa private key")
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodRS256,
+		signKey:   key,
+		verifyKey: &key.PublicKey,
+	}, nil
+}
+
+// NewECDSAKey creates an ECDSA key from a private key. The signing method
+// (ES256, ES384 or ES512) is chosen from the curve of the key.
+func NewECDSAKey(id string, key *ecdsa.PrivateKey) (*SigningKey, error) {
+	if key == nil {
+		return nil, errors.New("nil ecdsa private key")
+	}
+
+	method, err := ecdsaMethod(key.Curve)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    method,
+		signKey:   key,
+		verifyKey: &key.PublicKey,
+	}, nil
+}
+
+// NewEd25519Key creates an EdDSA key from an Ed25519 private key.
+func NewEd25519Key(id string, key ed25519.PrivateKey) (*SigningKey, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodEdDSA,
+		signKey:   key,
+		verifyKey: key.Public(),
+	}, nil
+}
+
+// NewVerificationKey creates a verify-only key from a public key. It is used for
+// retired keys whose private part has been destroyed and for keys published by
+// another service.
+func NewVerificationKey(id string, public crypto.PublicKey) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		m, err := ecdsaMethod(pub.Curve)
+		if err != nil {
+			return nil, err
+		}
+		method = m
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    method,
+		verifyKey: public,
+	}, nil
+}
+
+// ParsePrivateKeyPEM creates a signing key from a PEM encoded PKCS#8, PKCS#1 or
+// SEC 1 private key. The key type decides the signing method.
+func ParsePrivateKeyPEM(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode pem block")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(id, k)
+	case *ecdsa.PrivateKey:
+		return NewECDSAKey(id, k)
+	case ed25519.PrivateKey:
+		return NewEd25519Key(id, k)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// Public returns the public half of an asymmetric key, or nil for HMAC keys.
+func (k *SigningKey) Public() crypto.PublicKey {
+	if _, ok := k.Method.(*jwt.SigningMethodHMAC); ok {
+		return nil
+	}
+	return k.verifyKey
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, errors.New("unsupported ecdsa curve")
+	}
+}
+
+// KeySet holds the keys of a Manager indexed by kid. New tokens are signed with
+// the active key, while every key in the set is accepted for verification so
+// tokens signed before a rotation stay valid until they expire.
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	active string
+}
+
+// NewKeySet creates a key set that signs with active and also verifies tokens
+// signed by any of the previous keys.
+func NewKeySet(active *SigningKey, previous ...*SigningKey) (*KeySet, error) {
+	s := &KeySet{keys: make(map[string]*SigningKey)}
+
+	for _, key := range previous {
+		if err := s.Add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Rotate(active); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Add registers a key for verification without making it the active key.
+func (s *KeySet) Add(key *SigningKey) error {
+	if key == nil {
+		return errors.New("nil signing key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	s.keys[key.ID] = key
+
+	return nil
+}
+
+// Rotate adds key to the set and makes it the active signing key. The
+// previously active key stays in the set for verification.
+func (s *KeySet) Rotate(key *SigningKey) error {
+	if key == nil {
+		return errors.New("nil signing key")
+	}
+	if !key.CanSign() {
+		return ErrVerifyOnlyKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.keys[key.ID]; exists && existing != key {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	s.keys[key.ID] = key
+	s.active = key.ID
+
+	return nil
+}
+
+// Remove drops a retired key from the set. The active key cannot be removed.
+func (s *KeySet) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == s.active {
+		return errors.New("cannot remove the active signing key")
+	}
+	delete(s.keys, id)
+
+	return nil
+}
+
+// Active returns the key used to sign new tokens.
+func (s *KeySet) Active() *SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keys[s.active]
+}
+
+// Lookup returns the key with the given kid.
+func (s *KeySet) Lookup(id string) (*SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// Keys returns every key in the set ordered by kid.
+func (s *KeySet) Keys() []*SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
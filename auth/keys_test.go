@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSAKey(t *testing.T, id string) *SigningKey {
+	t.Helper()
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := NewRSAKey(id, pk)
+	require.NoError(t, err)
+	return key
+}
+
+func TestManager_AsymmetricKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	es256, err := NewECDSAKey("ec-1", ecKey)
+	require.NoError(t, err)
+	eddsa, err := NewEd25519Key("ed-1", edKey)
+	require.NoError(t, err)
+
+	for _, key := range []*SigningKey{newRSAKey(t, "rsa-1"), es256, eddsa} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			keys, err := NewKeySet(key)
+			require.NoError(t, err)
+
+			mgr, err := NewManagerWithKeySet(keys)
+			require.NoError(t, err)
+
+			tokenStr, err := mgr.GenerateToken(NewClaims(42, "gateway"))
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(tokenStr, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, key.Method.Alg(), parsed.Header["alg"])
+
+			claims, err := mgr.ValidateToken(tokenStr)
+			assert.NoError(t, err)
+			assert.Equal(t, "42", claims.Subject)
+		})
+	}
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	oldKey := newRSAKey(t, "2025-01")
+	keys, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+
+	mgr, err := NewManagerWithKeySet(keys)
+	require.NoError(t, err)
+
+	oldToken, err := mgr.GenerateToken(NewClaims(1, "gateway"))
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Rotate(newRSAKey(t, "2025-02")))
+
+	newToken, err := mgr.GenerateToken(NewClaims(2, "gateway"))
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-02", parsed.Header["kid"])
+
+	claims, err := mgr.ValidateToken(oldToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", claims.Subject)
+
+	require.NoError(t, keys.Remove("2025-01"))
+
+	_, err = mgr.ValidateToken(oldToken)
+	assert.True(t, errors.Is(err, ErrUnknownKey))
+	assert.Error(t, keys.Remove("2025-02"))
+}
+
+func TestManager_RejectsAlgorithmConfusion(t *testing.T) {
+	key := newRSAKey(t, "rsa-1")
+	keys, err := NewKeySet(key)
+	require.NoError(t, err)
+
+	mgr, err := NewManagerWithKeySet(keys)
+	require.NoError(t, err)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   "1",
+	})
+	forged.Header["kid"] = "rsa-1"
+	tokenStr, err := forged.SignedString(pubPEM)
+	require.NoError(t, err)
+
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.Error(t, err)
+}
+
+func TestManager_VerifyOnlyKey(t *testing.T) {
+	signer := newRSAKey(t, "rsa-1")
+	verifier, err := NewVerificationKey("rsa-1", signer.Public())
+	require.NoError(t, err)
+	assert.False(t, verifier.CanSign())
+
+	_, err = NewKeySet(verifier)
+	assert.True(t, errors.Is(err, ErrVerifyOnlyKey))
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+
+	key, err := ParsePrivateKeyPEM("ec-1", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodES384, key.Method)
+
+	_, err = ParsePrivateKeyPEM("bad", []byte("not a pem"))
+	assert.Error(t, err)
+}
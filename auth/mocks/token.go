@@ -12,6 +12,7 @@ package mock_auth
 import (
 	reflect "reflect"
 
+	auth "github.com/MamangRust/monolith-payment-gateway-pkg/auth"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -40,25 +41,25 @@ func (m *MockTokenManager) EXPECT() *MockTokenManagerMockRecorder {
 }
 
 // GenerateToken mocks base method.
-func (m *MockTokenManager) GenerateToken(userId int, audience string) (string, error) {
+func (m *MockTokenManager) GenerateToken(claims *auth.Claims) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GenerateToken", userId, audience)
+	ret := m.ctrl.Call(m, "GenerateToken", claims)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GenerateToken indicates an expected call of GenerateToken.
-func (mr *MockTokenManagerMockRecorder) GenerateToken(userId, audience any) *gomock.Call {
+func (mr *MockTokenManagerMockRecorder) GenerateToken(claims any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockTokenManager)(nil).GenerateToken), userId, audience)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockTokenManager)(nil).GenerateToken), claims)
 }
 
 // ValidateToken mocks base method.
-func (m *MockTokenManager) ValidateToken(tokenString string) (string, error) {
+func (m *MockTokenManager) ValidateToken(tokenString string) (*auth.Claims, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ValidateToken", tokenString)
-	ret0, _ := ret[0].(string)
+	ret0, _ := ret[0].(*auth.Claims)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
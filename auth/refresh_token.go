@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenExpired is returned when a refresh token is past its expiration.
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented
+	// again. Every refresh token of the user is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// TokenPair is an access token together with the refresh token that can renew it.
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	SessionID             string    `json:"session_id,omitempty"`
+}
+
+// Device describes the client a user logs in from. It is recorded with the session.
+type Device struct {
+	UserAgent string
+	IPAddress string
+}
+
+// RefreshTokenService issues opaque refresh tokens and rotates them on every use.
+//
+// Only the SHA-256 hash of a refresh token is stored in refresh_tokens. A rotated
+// token is revoked rather than deleted, so presenting it again is detected as reuse
+// and revokes the whole token family of the user.
+//
+// Every login opens a session in sessions. Its ID is carried as sid in the access
+// tokens and stored with the refresh tokens, so rotations stay in the same session
+// and SessionService can end it.
+type RefreshTokenService struct {
+	db      *sql.DB
+	queries *db.Queries
+	tokens  TokenManager
+	revoker SessionRevoker
+	ttl     time.Duration
+	logger  logger.LoggerInterface
+}
+
+// NewRefreshTokenService creates a new RefreshTokenService.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - tokens: The token manager that signs access tokens (TokenManager)
+//   - revoker: Revokes the access tokens of the sessions ended on token reuse, or nil to let them expire (SessionRevoker)
+//   - ttl: The lifetime of refresh tokens (time.Duration)
+//   - logger: The logger used to report token reuse (logger.LoggerInterface)
+//
+// Returns:
+//   - *RefreshTokenService: The initialized service
+func NewRefreshTokenService(conn *sql.DB, queries *db.Queries, tokens TokenManager, revoker SessionRevoker, ttl time.Duration, logger logger.LoggerInterface) *RefreshTokenService {
+	return &RefreshTokenService{
+		db:      conn,
+		queries: queries,
+		tokens:  tokens,
+		revoker: revoker,
+		ttl:     ttl,
+		logger:  logger,
+	}
+}
+
+// Issue opens a session for the device, signs an access token for the given
+// claims and stores a new refresh token for the same user. It is used on login.
+func (s *RefreshTokenService) Issue(ctx context.Context, claims *Claims, device Device) (*TokenPair, error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	c := *claims
+	c.SessionID = uuid.NewString()
+
+	var pair *TokenPair
+	err = s.withTx(ctx, func(q *db.Queries) error {
+		if _, err := q.CreateSession(ctx, db.CreateSessionParams{
+			SessionID: c.SessionID,
+			UserID:    int32(userID),
+			UserAgent: device.UserAgent,
+			IpAddress: device.IPAddress,
+			ExpiresAt: time.Now().Add(s.ttl),
+		}); err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+
+		pair, err = s.issue(ctx, q, userID, &c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Rotate exchanges a refresh token for a new access/refresh pair in one transaction.
+//
+// The presented token is revoked and a new one is stored in the same session, whose
+// last-seen time is updated. The access token carries the roles currently assigned
+// to the user, and the merchant and scopes stored with the presented token.
+// ErrSessionRevoked is returned when the session has been ended.
+//
+// When the presented token was already rotated, every refresh token of the user is
+// deleted, every session is ended and ErrRefreshTokenReused is returned, so a stolen
+// token and its legitimate successor both stop working. The access tokens of the
+// ended sessions are revoked through the revoker once the transaction commits.
+func (s *RefreshTokenService) Rotate(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var (
+		pair     *TokenPair
+		reusedBy int32
+		sessions []string
+	)
+
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		stored, err := q.FindRefreshTokenByTokenForUpdate(ctx, HashRefreshToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("failed to find refresh token: %w", err)
+		}
+
+		if stored.DeletedAt.Valid {
+			if err := q.DeleteRefreshTokenByUserId(ctx, stored.UserID); err != nil {
+				return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+			}
+			sessions, err = q.RevokeUserSessions(ctx, db.RevokeUserSessionsParams{UserID: stored.UserID})
+			if err != nil {
+				return fmt.Errorf("failed to revoke sessions: %w", err)
+			}
+			reusedBy = stored.UserID
+			return nil
+		}
+
+		if time.Now().After(stored.Expiration) {
+			return ErrRefreshTokenExpired
+		}
+
+		if err := q.RevokeRefreshToken(ctx, stored.Token); err != nil {
+			return fmt.Errorf("failed to revoke refresh token: %w", err)
+		}
+
+		roles, err := q.GetUserRoles(ctx, stored.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get user roles: %w", err)
+		}
+
+		claims := NewClaims(int(stored.UserID))
+		claims.Roles = RoleNames(roles)
+		claims.SessionID = stored.SessionID.String
+		claims.MerchantID = int(stored.MerchantID.Int32)
+		claims.Scopes = stored.Scopes
+
+		pair, err = s.issue(ctx, q, int(stored.UserID), claims)
+		if err != nil || claims.SessionID == "" {
+			return err
+		}
+
+		touched, err := q.TouchSession(ctx, db.TouchSessionParams{
+			SessionID: claims.SessionID,
+			ExpiresAt: pair.RefreshTokenExpiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update session: %w", err)
+		}
+		if touched == 0 {
+			return ErrSessionRevoked
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reusedBy != 0 {
+		s.logger.Error("Refresh token reuse detected, revoked all refresh tokens of user",
+			zap.Int32("user_id", reusedBy),
+		)
+		if s.revoker != nil {
+			for _, sessionID := range sessions {
+				if err := s.revoker.RevokeSession(ctx, sessionID); err != nil {
+					return nil, fmt.Errorf("%w: failed to revoke access tokens: %w", ErrRefreshTokenReused, err)
+				}
+			}
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return pair, nil
+}
+
+// Revoke revokes a single refresh token, typically on logout.
+func (s *RefreshTokenService) Revoke(ctx context.Context, refreshToken string) error {
+	if err := s.queries.RevokeRefreshToken(ctx, HashRefreshToken(refreshToken)); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAll deletes every refresh token of the user.
+func (s *RefreshTokenService) RevokeAll(ctx context.Context, userID int) error {
+	if err := s.queries.DeleteRefreshTokenByUserId(ctx, int32(userID)); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *RefreshTokenService) issue(ctx context.Context, q *db.Queries, userID int, claims *Claims) (*TokenPair, error) {
+	accessToken, err := s.tokens.GenerateToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	expiration := time.Now().Add(s.ttl)
+	if _, err := q.CreateRefreshToken(ctx, db.CreateRefreshTokenParams{
+		UserID:     int32(userID),
+		Token:      HashRefreshToken(refreshToken),
+		Expiration: expiration,
+		SessionID:  sql.NullString{String: claims.SessionID, Valid: claims.SessionID != ""},
+		MerchantID: sql.NullInt32{Int32: int32(claims.MerchantID), Valid: claims.MerchantID != 0},
+		Scopes:     claims.Scopes,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	s.logger.Debug("Issued refresh token", zap.Int("user_id", userID))
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: expiration,
+		SessionID:             claims.SessionID,
+	}, nil
+}
+
+func (s *RefreshTokenService) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GenerateRefreshToken returns a random opaque refresh token.
+func GenerateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken returns the hex encoded SHA-256 hash under which a refresh token is stored.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var refreshTokenColumns = []string{"refresh_token_id", "user_id", "token", "expiration", "created_at", "updated_at", "deleted_at", "session_id", "merchant_id", "scopes"}
+
+func newRefreshTokenService(t *testing.T) (*RefreshTokenService, sqlmock.Sqlmock, *Manager) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	mgr, err := NewManager(secretKey, WithRevocationStore(NewInMemoryRevocationStore()))
+	require.NoError(t, err)
+
+	svc := NewRefreshTokenService(conn, db.New(conn), mgr, mgr, 24*time.Hour, &logger.Logger{Log: zap.NewNop()})
+	return svc, mock, mgr
+}
+
+func TestRefreshTokenService_Rotate(t *testing.T) {
+	svc, mock, mgr := newRefreshTokenService(t)
+
+	oldToken := "old-refresh-token"
+	oldHash := HashRefreshToken(oldToken)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM refresh_tokens\nWHERE token = $1\nFOR UPDATE")).
+		WithArgs(oldHash).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, oldHash, time.Now().Add(time.Hour), nil, nil, nil, "session-1", nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE refresh_tokens\nSET deleted_at = current_timestamp")).
+		WithArgs(oldHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("JOIN\n    user_roles ur")).
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"role_id", "role_name", "created_at", "updated_at", "deleted_at"}).
+			AddRow(1, "ROLE_ADMIN", nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO refresh_tokens")).
+		WithArgs(int32(5), sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{String: "session-1", Valid: true}, sql.NullInt32{}, pq.Array([]string(nil))).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(2, 5, "new", time.Now().Add(time.Hour), nil, nil, nil, "session-1", nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions\nSET last_seen_at = current_timestamp")).
+		WithArgs("session-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pair, err := svc.Rotate(context.Background(), oldToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldToken, pair.RefreshToken)
+	assert.Equal(t, "session-1", pair.SessionID)
+
+	claims, err := mgr.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "5", claims.Subject)
+	assert.Equal(t, []string{"ROLE_ADMIN"}, claims.Roles)
+	assert.Equal(t, "session-1", claims.SessionID)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenService_Rotate_KeepsMerchantAndScopes(t *testing.T) {
+	svc, mock, mgr := newRefreshTokenService(t)
+
+	oldToken := "merchant-refresh-token"
+	oldHash := HashRefreshToken(oldToken)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs(oldHash).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, oldHash, time.Now().Add(time.Hour), nil, nil, nil, "session-1", 3, "{payments:read,payments:write}"))
+	mock.ExpectExec(regexp.QuoteMeta("SET deleted_at = current_timestamp")).
+		WithArgs(oldHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("JOIN\n    user_roles ur")).
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"role_id", "role_name", "created_at", "updated_at", "deleted_at"}).
+			AddRow(2, "ROLE_MERCHANT", nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO refresh_tokens")).
+		WithArgs(int32(5), sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{String: "session-1", Valid: true},
+			sql.NullInt32{Int32: 3, Valid: true}, pq.Array([]string{"payments:read", "payments:write"})).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(2, 5, "new", time.Now().Add(time.Hour), nil, nil, nil, "session-1", 3, "{payments:read,payments:write}"))
+	mock.ExpectExec(regexp.QuoteMeta("SET last_seen_at = current_timestamp")).
+		WithArgs("session-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pair, err := svc.Rotate(context.Background(), oldToken)
+	require.NoError(t, err)
+
+	claims, err := mgr.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 3, claims.MerchantID)
+	assert.Equal(t, []string{"payments:read", "payments:write"}, claims.Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenService_Rotate_ReuseRevokesFamily(t *testing.T) {
+	svc, mock, mgr := newRefreshTokenService(t)
+	ctx := context.Background()
+
+	// An access token the attacker obtained with the stolen refresh token.
+	claims := NewClaims(5)
+	claims.SessionID = "session-1"
+	accessToken, err := mgr.GenerateToken(claims)
+	require.NoError(t, err)
+	_, err = mgr.ValidateTokenContext(ctx, accessToken)
+	require.NoError(t, err)
+
+	reused := "rotated-refresh-token"
+	hash := HashRefreshToken(reused)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, hash, time.Now().Add(time.Hour), nil, nil, time.Now(), nil, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM refresh_tokens\nWHERE user_id = $1")).
+		WithArgs(int32(5)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE sessions\nSET revoked_at = current_timestamp\nWHERE user_id = $1")).
+		WithArgs(int32(5), "").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow("session-1"))
+	mock.ExpectCommit()
+
+	_, err = svc.Rotate(ctx, reused)
+	assert.True(t, errors.Is(err, ErrRefreshTokenReused))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = mgr.ValidateTokenContext(ctx, accessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestRefreshTokenService_Rotate_Invalid(t *testing.T) {
+	svc, mock, _ := newRefreshTokenService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := svc.Rotate(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, "hash", time.Now().Add(-time.Hour), nil, nil, nil, nil, nil, nil))
+	mock.ExpectRollback()
+
+	_, err = svc.Rotate(context.Background(), "expired")
+	assert.True(t, errors.Is(err, ErrRefreshTokenExpired))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenService_Issue(t *testing.T) {
+	svc, mock, mgr := newRefreshTokenService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO sessions")).
+		WithArgs(sqlmock.AnyArg(), int32(9), "Mozilla/5.0", "10.0.0.1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("sid", 9, "Mozilla/5.0", "10.0.0.1", time.Now(), time.Now(), time.Now().Add(time.Hour), nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO refresh_tokens")).
+		WithArgs(int32(9), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullInt32{Int32: 3, Valid: true}, pq.Array([]string{"payments:read"})).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 9, "hash", time.Now().Add(time.Hour), nil, nil, nil, "sid", nil, nil))
+	mock.ExpectCommit()
+
+	claims := NewClaims(9)
+	claims.MerchantID = 3
+	claims.Scopes = []string{"payments:read"}
+	pair, err := svc.Issue(context.Background(), claims, Device{UserAgent: "Mozilla/5.0", IPAddress: "10.0.0.1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.SessionID)
+	assert.Len(t, HashRefreshToken(pair.RefreshToken), 64)
+
+	claims, err = mgr.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, pair.SessionID, claims.SessionID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenService_Rotate_RevokedSession(t *testing.T) {
+	svc, mock, _ := newRefreshTokenService(t)
+
+	token := "refresh-token"
+	hash := HashRefreshToken(token)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, hash, time.Now().Add(time.Hour), nil, nil, nil, "session-1", nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET deleted_at = current_timestamp")).
+		WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("JOIN\n    user_roles ur")).
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"role_id", "role_name", "created_at", "updated_at", "deleted_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO refresh_tokens")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(2, 5, "new", time.Now().Add(time.Hour), nil, nil, nil, "session-1", nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions\nSET last_seen_at = current_timestamp")).
+		WithArgs("session-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err := svc.Rotate(context.Background(), token)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
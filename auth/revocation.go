@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTokenRevoked is returned when a token has been revoked before its expiry.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// RevocationStore records revoked tokens by jti, revoked sessions by sid, and
+// per-user cut-off times before which every token of the user is considered revoked.
+type RevocationStore interface {
+	// Revoke marks the token with the given jti as revoked until it expires.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsRevoked reports whether the token with the given jti has been revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeUserBefore revokes every token of the user issued before the given time.
+	RevokeUserBefore(ctx context.Context, userID int, before time.Time) error
+	// RevokedBefore returns the cut-off time set for the user, or the zero time.
+	RevokedBefore(ctx context.Context, userID int) (time.Time, error)
+	// RevokeSession revokes every token carrying the given sid until the given time,
+	// which must be after the expiry of the last access token issued for the session.
+	RevokeSession(ctx context.Context, sessionID string, until time.Time) error
+	// IsSessionRevoked reports whether the session with the given sid has been revoked.
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// checkRevoked returns ErrTokenRevoked when the claims have been revoked in the store.
+//
+// The user cut-off is compared with the nanosecond issue time of the token, so a
+// token issued earlier in the same second is revoked while one issued right after
+// the cut-off, such as the fresh token of a password change, is kept. Tokens
+// without iat_ns only carry whole seconds and are revoked up to the cut-off.
+func checkRevoked(ctx context.Context, store RevocationStore, claims *Claims) error {
+	if claims.ID != "" {
+		revoked, err := store.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := store.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return fmt.Errorf("failed to check session revocation: %w", err)
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return err
+	}
+
+	before, err := store.RevokedBefore(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if before.IsZero() {
+		return nil
+	}
+
+	issued := claims.issueTime()
+	if issued.IsZero() || issued.Before(before) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// InMemoryRevocationStore is a RevocationStore kept in process memory. It is meant
+// for tests and single instance deployments.
+type InMemoryRevocationStore struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	sessions map[string]time.Time
+	users    map[int]time.Time
+}
+
+// NewInMemoryRevocationStore creates an empty InMemoryRevocationStore.
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	return &InMemoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		sessions: make(map[string]time.Time),
+		users:    make(map[int]time.Time),
+	}
+}
+
+// Revoke marks the token with the given jti as revoked until it expires.
+func (s *InMemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purgeExpired(s.tokens)
+	s.tokens[jti] = expiresAt
+
+	return nil
+}
+
+// IsRevoked reports whether the token with the given jti has been revoked.
+func (s *InMemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.tokens[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// RevokeUserBefore revokes every token of the user issued before the given time.
+func (s *InMemoryRevocationStore) RevokeUserBefore(ctx context.Context, userID int, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if before.After(s.users[userID]) {
+		s.users[userID] = before
+	}
+	return nil
+}
+
+// RevokedBefore returns the cut-off time set for the user, or the zero time.
+func (s *InMemoryRevocationStore) RevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.users[userID], nil
+}
+
+// RevokeSession revokes every token carrying the given sid until the given time.
+func (s *InMemoryRevocationStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purgeExpired(s.sessions)
+	s.sessions[sessionID] = until
+
+	return nil
+}
+
+// IsSessionRevoked reports whether the session with the given sid has been revoked.
+func (s *InMemoryRevocationStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.sessions[sessionID]
+	return ok && time.Now().Before(until), nil
+}
+
+// purgeExpired removes the entries whose time has passed.
+func purgeExpired(entries map[string]time.Time) {
+	now := time.Now()
+	for id, exp := range entries {
+		if now.After(exp) {
+			delete(entries, id)
+		}
+	}
+}
+
+// RedisRevocationStore is a RevocationStore backed by Redis, shared by every
+// instance that validates tokens.
+//
+// Revoked jtis are kept until the token expires. User cut-offs are kept for
+// userTTL, which must be at least the lifetime of the longest lived token.
+type RedisRevocationStore struct {
+	client  redis.UniversalClient
+	prefix  string
+	userTTL time.Duration
+}
+
+// NewRedisRevocationStore creates a RedisRevocationStore. The client is usually the
+// Client of a redisclient connection.
+func NewRedisRevocationStore(client redis.UniversalClient, userTTL time.Duration) *RedisRevocationStore {
+	return &RedisRevocationStore{
+		client:  client,
+		prefix:  "auth:revoked:",
+		userTTL: userTTL,
+	}
+}
+
+// Revoke marks the token with the given jti as revoked until it expires.
+func (s *RedisRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, s.prefix+"jti:"+jti, 1, ttl).Err()
+}
+
+// IsRevoked reports whether the token with the given jti has been revoked.
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+"jti:"+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// raiseCutoff sets KEYS[1] to ARGV[1] with a TTL of ARGV[2] milliseconds unless
+// it already holds a later time. The Unix nanoseconds are compared as decimal
+// strings, as Lua numbers cannot hold them exactly.
+var raiseCutoff = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current and (#current > #ARGV[1] or (#current == #ARGV[1] and current >= ARGV[1])) then
+	return 0
+end
+if ARGV[2] == '0' then
+	redis.call('SET', KEYS[1], ARGV[1])
+else
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// RevokeUserBefore revokes every token of the user issued before the given time.
+// The cut-off only moves forward: an earlier time than the current one is
+// ignored, as with InMemoryRevocationStore.
+func (s *RedisRevocationStore) RevokeUserBefore(ctx context.Context, userID int, before time.Time) error {
+	nanos := before.UnixNano()
+	if nanos <= 0 {
+		return nil
+	}
+	return raiseCutoff.Run(ctx, s.client, []string{s.userKey(userID)},
+		strconv.FormatInt(nanos, 10), s.userTTL.Milliseconds()).Err()
+}
+
+// RevokedBefore returns the cut-off time set for the user, or the zero time.
+func (s *RedisRevocationStore) RevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	nanos, err := s.client.Get(ctx, s.userKey(userID)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// RevokeSession revokes every token carrying the given sid until the given time.
+func (s *RedisRevocationStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, s.prefix+"session:"+sessionID, 1, ttl).Err()
+}
+
+// IsSessionRevoked reports whether the session with the given sid has been revoked.
+func (s *RedisRevocationStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+"session:"+sessionID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *RedisRevocationStore) userKey(userID int) string {
+	return s.prefix + "user:" + strconv.Itoa(userID)
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRevocation(t *testing.T, store RevocationStore) {
+	ctx := context.Background()
+	mgr, err := NewManager(secretKey, WithRevocationStore(store))
+	require.NoError(t, err)
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(10))
+	require.NoError(t, err)
+	other, err := mgr.GenerateToken(NewClaims(10))
+	require.NoError(t, err)
+
+	claims, err := mgr.ValidateTokenContext(ctx, tokenStr)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+
+	require.NoError(t, mgr.Revoke(ctx, claims))
+
+	_, err = mgr.ValidateTokenContext(ctx, tokenStr)
+	assert.True(t, errors.Is(err, ErrTokenRevoked))
+
+	_, err = mgr.ValidateTokenContext(ctx, other)
+	assert.NoError(t, err, "revoking one jti must not affect other tokens")
+
+	cutoff := time.Now().Add(2 * time.Second)
+	require.NoError(t, mgr.RevokeUserTokens(ctx, 10, cutoff))
+
+	require.NoError(t, store.RevokeUserBefore(ctx, 10, cutoff.Add(-time.Hour)))
+	before, err := store.RevokedBefore(ctx, 10)
+	require.NoError(t, err)
+	assert.True(t, cutoff.Equal(before), "an earlier cut-off must not move it backwards")
+
+	_, err = mgr.ValidateTokenContext(ctx, other)
+	assert.True(t, errors.Is(err, ErrTokenRevoked))
+
+	stranger, err := mgr.GenerateToken(NewClaims(11))
+	require.NoError(t, err)
+	_, err = mgr.ValidateTokenContext(ctx, stranger)
+	assert.NoError(t, err)
+
+	sessionClaims := NewClaims(11)
+	sessionClaims.SessionID = "session-1"
+	inSession, err := mgr.GenerateToken(sessionClaims)
+	require.NoError(t, err)
+
+	require.NoError(t, mgr.RevokeSession(ctx, "session-1"))
+
+	_, err = mgr.ValidateTokenContext(ctx, inSession)
+	assert.True(t, errors.Is(err, ErrTokenRevoked))
+	_, err = mgr.ValidateTokenContext(ctx, stranger)
+	assert.NoError(t, err, "revoking a session must not affect tokens outside it")
+}
+
+func TestRevocation_InMemory(t *testing.T) {
+	testRevocation(t, NewInMemoryRevocationStore())
+}
+
+func TestRevocation_Redis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	testRevocation(t, NewRedisRevocationStore(client, 24*time.Hour))
+}
+
+func TestRevocation_TokenIssuedAfterCutoffIsValid(t *testing.T) {
+	ctx := context.Background()
+	mgr, err := NewManager(secretKey, WithRevocationStore(NewInMemoryRevocationStore()))
+	require.NoError(t, err)
+
+	require.NoError(t, mgr.RevokeUserTokens(ctx, 10, time.Now()))
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(10))
+	require.NoError(t, err)
+
+	_, err = mgr.ValidateTokenContext(ctx, tokenStr)
+	assert.NoError(t, err)
+}
+
+func TestRevocation_TokenIssuedInSameSecondIsRevoked(t *testing.T) {
+	ctx := context.Background()
+	mgr, err := NewManager(secretKey, WithRevocationStore(NewInMemoryRevocationStore()))
+	require.NoError(t, err)
+
+	// Retry until issue and revocation fall in the same second.
+	for {
+		issued := time.Now()
+		tokenStr, err := mgr.GenerateToken(NewClaims(10))
+		require.NoError(t, err)
+
+		cutoff := time.Now()
+		require.NoError(t, mgr.RevokeUserTokens(ctx, 10, cutoff))
+		if issued.Unix() != cutoff.Unix() {
+			continue
+		}
+
+		_, err = mgr.ValidateTokenContext(ctx, tokenStr)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+
+		fresh, err := mgr.GenerateToken(NewClaims(10))
+		require.NoError(t, err)
+		_, err = mgr.ValidateTokenContext(ctx, fresh)
+		assert.NoError(t, err)
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrSessionNotFound is returned when a session does not exist, belongs to
+	// another user or has already been ended.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionRevoked is returned when a refresh token of an ended session is rotated.
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// SessionRevoker revokes the access tokens issued for a session. *Manager
+// implements it when it was created WithRevocationStore.
+type SessionRevoker interface {
+	RevokeSession(ctx context.Context, sessionID string) error
+}
+
+// Session is a login of a user on one device, as shown in the list of active sessions.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionService lists and ends the sessions opened by RefreshTokenService.
+//
+// Ending a session marks it revoked, revokes its refresh tokens and, through the
+// SessionRevoker, the access tokens carrying its sid. The last-seen time of a
+// session is updated whenever its refresh token is rotated.
+type SessionService struct {
+	db      *sql.DB
+	queries *db.Queries
+	revoker SessionRevoker
+	logger  logger.LoggerInterface
+}
+
+// NewSessionService creates a new SessionService.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - revoker: Revokes the access tokens of ended sessions, or nil to let them expire (SessionRevoker)
+//   - logger: The logger used to report ended sessions (logger.LoggerInterface)
+//
+// Returns:
+//   - *SessionService: The initialized service
+func NewSessionService(conn *sql.DB, queries *db.Queries, revoker SessionRevoker, logger logger.LoggerInterface) *SessionService {
+	return &SessionService{
+		db:      conn,
+		queries: queries,
+		revoker: revoker,
+		logger:  logger,
+	}
+}
+
+// List returns the active sessions of the user, most recently used first. The
+// session with currentSessionID, usually the sid of the calling token, is marked Current.
+func (s *SessionService) List(ctx context.Context, userID int, currentSessionID string) ([]*Session, error) {
+	rows, err := s.queries.GetUserSessions(ctx, int32(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, &Session{
+			ID:         row.SessionID,
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+			CreatedAt:  row.CreatedAt,
+			LastSeenAt: row.LastSeenAt,
+			ExpiresAt:  row.ExpiresAt,
+			Current:    row.SessionID == currentSessionID,
+		})
+	}
+
+	return sessions, nil
+}
+
+// Revoke ends one session of the user, for example on logout or when the user
+// removes a device. ErrSessionNotFound is returned when the user has no such
+// active session.
+func (s *SessionService) Revoke(ctx context.Context, userID int, sessionID string) error {
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		revoked, err := q.RevokeSession(ctx, db.RevokeSessionParams{
+			SessionID: sessionID,
+			UserID:    int32(userID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+		if revoked == 0 {
+			return ErrSessionNotFound
+		}
+
+		return s.revokeRefreshTokens(ctx, q, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.revokeAccessTokens(ctx, userID, []string{sessionID})
+}
+
+// RevokeAll ends every session of the user except exceptSessionID, which may be
+// empty to end all of them. It returns the number of ended sessions.
+func (s *SessionService) RevokeAll(ctx context.Context, userID int, exceptSessionID string) (int, error) {
+	var revoked []string
+
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		var err error
+		revoked, err = q.RevokeUserSessions(ctx, db.RevokeUserSessionsParams{
+			UserID:    int32(userID),
+			SessionID: exceptSessionID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+
+		for _, sessionID := range revoked {
+			if err := s.revokeRefreshTokens(ctx, q, sessionID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.revokeAccessTokens(ctx, userID, revoked); err != nil {
+		return 0, err
+	}
+
+	return len(revoked), nil
+}
+
+func (s *SessionService) revokeRefreshTokens(ctx context.Context, q *db.Queries, sessionID string) error {
+	if err := q.RevokeSessionRefreshTokens(ctx, sql.NullString{String: sessionID, Valid: true}); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionService) revokeAccessTokens(ctx context.Context, userID int, sessionIDs []string) error {
+	for _, sessionID := range sessionIDs {
+		if s.revoker != nil {
+			if err := s.revoker.RevokeSession(ctx, sessionID); err != nil {
+				return fmt.Errorf("failed to revoke access tokens: %w", err)
+			}
+		}
+
+		s.logger.Info("Session revoked",
+			zap.Int("user_id", userID),
+			zap.String("session_id", sessionID),
+		)
+	}
+	return nil
+}
+
+func (s *SessionService) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
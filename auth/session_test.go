@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var sessionColumns = []string{"session_id", "user_id", "user_agent", "ip_address", "created_at", "last_seen_at", "expires_at", "revoked_at"}
+
+func newSessionService(t *testing.T) (*SessionService, sqlmock.Sqlmock, *Manager) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	mgr, err := NewManager(secretKey, WithRevocationStore(NewInMemoryRevocationStore()))
+	require.NoError(t, err)
+
+	svc := NewSessionService(conn, db.New(conn), mgr, &logger.Logger{Log: zap.NewNop()})
+	return svc, mock, mgr
+}
+
+func TestSessionService_List(t *testing.T) {
+	svc, mock, _ := newSessionService(t)
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sessions\nWHERE user_id = $1")).
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("phone", 5, "Android", "10.0.0.2", now, now, now.Add(time.Hour), nil).
+			AddRow("laptop", 5, "Firefox", "10.0.0.1", now, now.Add(-time.Hour), now.Add(time.Hour), nil))
+
+	sessions, err := svc.List(context.Background(), 5, "laptop")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "phone", sessions[0].ID)
+	assert.Equal(t, "10.0.0.2", sessions[0].IPAddress)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionService_Revoke(t *testing.T) {
+	svc, mock, mgr := newSessionService(t)
+	ctx := context.Background()
+
+	claims := NewClaims(5)
+	claims.SessionID = "phone"
+	token, err := mgr.GenerateToken(claims)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions\nSET revoked_at = current_timestamp\nWHERE session_id = $1")).
+		WithArgs("phone", int32(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("WHERE session_id = $1 AND deleted_at IS NULL")).
+		WithArgs(sql.NullString{String: "phone", Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, svc.Revoke(ctx, 5, "phone"))
+
+	_, err = mgr.ValidateTokenContext(ctx, token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// Sessions of other users, or already revoked ones, are not found.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SET revoked_at = current_timestamp")).
+		WithArgs("phone", int32(6)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, svc.Revoke(ctx, 6, "phone"), ErrSessionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionService_RevokeAll(t *testing.T) {
+	svc, mock, mgr := newSessionService(t)
+	ctx := context.Background()
+
+	tokens := map[string]string{}
+	for _, sid := range []string{"laptop", "phone", "tablet"} {
+		claims := NewClaims(5)
+		claims.SessionID = sid
+		token, err := mgr.GenerateToken(claims)
+		require.NoError(t, err)
+		tokens[sid] = token
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("AND session_id <> $2")).
+		WithArgs(int32(5), "laptop").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow("phone").AddRow("tablet"))
+	for _, sid := range []string{"phone", "tablet"} {
+		mock.ExpectExec(regexp.QuoteMeta("WHERE session_id = $1 AND deleted_at IS NULL")).
+			WithArgs(sql.NullString{String: sid, Valid: true}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	n, err := svc.RevokeAll(ctx, 5, "laptop")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = mgr.ValidateTokenContext(ctx, tokens["laptop"])
+	assert.NoError(t, err)
+	_, err = mgr.ValidateTokenContext(ctx, tokens["phone"])
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = mgr.ValidateTokenContext(ctx, tokens["tablet"])
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,12 +1,14 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // ErrTokenExpired is an error that is returned when a JWT token is expired.
@@ -14,70 +16,299 @@ var ErrTokenExpired = errors.New("token expired")
 
 //go:generate mockgen -source=token.go -destination=mocks/token.go
 type TokenManager interface {
-	GenerateToken(userId int, audience string) (string, error)
-	ValidateToken(tokenString string) (string, error)
+	GenerateToken(claims *Claims) (string, error)
+	ValidateToken(tokenString string) (*Claims, error)
 }
 
+// defaultKeyID is the kid given to the HMAC key created by NewManager.
+const defaultKeyID = "default"
+
 type Manager struct {
-	secretKey []byte
+	keys      *KeySet
+	types     map[TokenType]tokenTypeConfig
+	notBefore time.Duration
+	claimsValidator
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithIssuer sets the issuer written into generated tokens. When set, validation
+// rejects tokens issued by anyone else.
+func WithIssuer(issuer string) Option {
+	return func(m *Manager) {
+		m.issuer = issuer
+	}
+}
+
+// WithAudience sets the audiences accepted during validation. The first audience
+// is also used for generated tokens whose claims carry no audience.
+func WithAudience(audience ...string) Option {
+	return func(m *Manager) {
+		m.audience = audience
+	}
+}
+
+// WithRevocationStore makes validation reject tokens revoked in the given store.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(m *Manager) {
+		m.revocations = store
+	}
 }
 
 // NewManager creates a new Manager instance with the given secret key.
 //
 // The secret key is expected to be a non-empty string. If the secret key is
-// empty, an error is returned.
-func NewManager(secretKey string) (*Manager, error) {
+// empty, an error is returned. Tokens are signed with HS256.
+func NewManager(secretKey string, opts ...Option) (*Manager, error) {
 	if secretKey == "" {
 		return nil, errors.New("empty secret key")
 	}
-	return &Manager{secretKey: []byte(secretKey)}, nil
+
+	key, err := NewHMACKey(defaultKeyID, []byte(secretKey))
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := NewKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewManagerWithKeySet(keys, opts...)
+}
+
+// NewManagerWithKeySet creates a new Manager that signs tokens with the active
+// key of the given key set and verifies them with the key named by the kid
+// header of each token.
+//
+// Rotating the key set while the Manager is in use is safe: tokens signed with
+// a previous key keep validating for as long as that key stays in the set.
+func NewManagerWithKeySet(keys *KeySet, opts ...Option) (*Manager, error) {
+	if keys == nil || keys.Active() == nil {
+		return nil, errors.New("key set has no active key")
+	}
+
+	m := &Manager{keys: keys, types: defaultTokenTypes()}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
+}
+
+// KeySet returns the key set used by the Manager.
+func (m *Manager) KeySet() *KeySet {
+	return m.keys
 }
 
-// GenerateToken generates a new JWT token for the given user ID and audience.
+// GenerateToken generates a new JWT token carrying the given claims.
 //
-// The token is valid for 12 hours from the time it is generated.
-// The subject claim is set to the given user ID.
-// The audience claim is set to the given audience.
-// The token is signed with the secret key set on the Manager during initialization.
+// The subject claim must hold the user ID, see NewClaims.
+// The token type is taken from the claims and defaults to an access token.
+// The issued-at claim is set to the current time, and the not-before claim is set
+// when the Manager was created WithNotBefore.
+// A random jti is set unless the claims already carry one, so the token can be revoked.
+// The token is valid for the lifetime of its type (12 hours for access tokens) unless
+// the claims already carry an expiry.
+// The issuer is taken from the Manager when the claims do not set it. Types with
+// their own audience always get that audience, access tokens without a configured
+// audience fall back to the first audience given WithAudience.
+// The token is signed with the active key of the Manager and carries its kid in the header.
 //
 // If the token cannot be generated, an error is returned.
-func (m *Manager) GenerateToken(userId int, audience string) (string, error) {
+func (m *Manager) GenerateToken(claims *Claims) (string, error) {
+	if claims == nil || claims.Subject == "" {
+		return "", ErrMissingSubject
+	}
+
+	tokenType := claims.Type
+	if tokenType == "" {
+		tokenType = TokenTypeAccess
+	}
+	cfg, ok := m.types[tokenType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidTokenType, tokenType)
+	}
+
+	key := m.keys.Active()
+	if !key.CanSign() {
+		return "", ErrVerifyOnlyKey
+	}
+
 	nowTime := time.Now()
-	expireTime := nowTime.Add(12 * time.Hour)
+	expireTime := nowTime.Add(cfg.ttl)
+
+	c := *claims
+	c.Type = tokenType
+	c.IssuedAt = jwt.NewNumericDate(nowTime)
+	c.IssuedAtNanos = nowTime.UnixNano()
+	if m.notBefore > 0 && c.NotBefore == nil {
+		c.NotBefore = jwt.NewNumericDate(nowTime.Add(m.notBefore))
+	}
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	if c.ExpiresAt == nil {
+		c.ExpiresAt = jwt.NewNumericDate(expireTime)
+	}
+	if c.Issuer == "" {
+		c.Issuer = m.issuer
+	}
+	if cfg.audience != "" {
+		c.Audience = jwt.ClaimStrings{cfg.audience}
+	} else if len(c.Audience) == 0 && len(m.audience) > 0 {
+		c.Audience = jwt.ClaimStrings{m.audience[0]}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(expireTime),
-		Subject:   strconv.Itoa(userId),
-		Audience:  []string{audience},
-	})
+	token := jwt.NewWithClaims(key.Method, &c)
+	token.Header["kid"] = key.ID
 
-	return token.SignedString([]byte(m.secretKey))
+	return token.SignedString(key.signKey)
 }
 
-// ValidateToken validates a JWT token and returns the user ID string if the validation is successful.
+// ValidateToken validates an access token and returns its claims if the validation is successful.
+// The verification key is picked from the kid header of the token; tokens without a kid are
+// verified with the active key. The alg header must match the algorithm of the selected key.
+// The token must carry a subject and an expiry, and must match the issuer and audiences
+// configured on the Manager. Tokens of any other type are rejected with ErrInvalidTokenType.
 // If the token is invalid or expired, an error is returned.
-// The error is wrapped with jwt.ErrTokenExpired if the token is expired.
-// The error is wrapped with jwt.ErrTokenExpired if the token is expired.
-func (m *Manager) ValidateToken(accessToken string) (string, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (i interface{}, err error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// The error is wrapped with ErrTokenExpired if the token is expired.
+func (m *Manager) ValidateToken(accessToken string) (*Claims, error) {
+	return m.ValidateTokenContext(context.Background(), accessToken)
+}
+
+// ValidateTokenContext is like ValidateToken but uses ctx for the revocation lookup.
+// When the Manager has a revocation store, ErrTokenRevoked is returned for tokens
+// revoked by jti or issued before the cut-off time of their user.
+func (m *Manager) ValidateTokenContext(ctx context.Context, accessToken string) (*Claims, error) {
+	return m.ValidateTypedToken(ctx, TokenTypeAccess, accessToken)
+}
+
+// ValidateTypedToken validates a token of the given type, for example a password
+// reset token, and returns its claims. The token must carry the type and the
+// audience configured for that type.
+func (m *Manager) ValidateTypedToken(ctx context.Context, tokenType TokenType, tokenString string) (*Claims, error) {
+	cfg, ok := m.types[tokenType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTokenType, tokenType)
+	}
+
+	audience := m.audience
+	if cfg.audience != "" {
+		audience = []string{cfg.audience}
+	}
+
+	return m.parse(ctx, tokenString, m.keyFunc, tokenType, audience)
+}
+
+// Revoke revokes the token described by the claims until it expires.
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	if m.revocations == nil {
+		return errors.New("no revocation store configured")
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token has no jti or expiry")
+	}
+	return m.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeUserTokens revokes every token of the user issued before the given time.
+// It is used on password changes and on logout from all devices.
+func (m *Manager) RevokeUserTokens(ctx context.Context, userID int, before time.Time) error {
+	if m.revocations == nil {
+		return errors.New("no revocation store configured")
+	}
+	return m.revocations.RevokeUserBefore(ctx, userID, before)
+}
+
+// RevokeSession revokes every access token issued for the session. The session is
+// kept revoked for the access token lifetime, after which its tokens have expired anyway.
+func (m *Manager) RevokeSession(ctx context.Context, sessionID string) error {
+	if m.revocations == nil {
+		return errors.New("no revocation store configured")
+	}
+	return m.revocations.RevokeSession(ctx, sessionID, time.Now().Add(m.types[TokenTypeAccess].ttl))
+}
+
+// claimsValidator holds the issuer, audience, clock skew and revocation checks shared
+// by the Manager and the JWKSValidator.
+type claimsValidator struct {
+	issuer      string
+	audience    []string
+	leeway      time.Duration
+	revocations RevocationStore
+}
+
+// parse verifies the token with keyFunc, checks the registered claims and makes
+// sure the token is of the expected type and issued for one of the audiences.
+// Tokens without a type are treated as access tokens.
+func (v claimsValidator) parse(ctx context.Context, tokenString string, keyFunc jwt.Keyfunc, tokenType TokenType, audience []string) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(v.leeway)}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, keyFunc, opts...); err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
 		}
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
 
-		return []byte(m.secretKey), nil
-	})
+	if claims.Subject == "" {
+		return nil, ErrMissingSubject
+	}
 
+	if got := claims.Type; got != tokenType && !(got == "" && tokenType == TokenTypeAccess) {
+		return nil, ErrInvalidTokenType
+	}
+
+	if len(audience) > 0 && !slices.ContainsFunc(audience, func(aud string) bool {
+		return slices.Contains(claims.Audience, aud)
+	}) {
+		return nil, ErrInvalidAudience
+	}
+
+	if v.revocations != nil {
+		if err := checkRevoked(ctx, v.revocations, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// keyFunc selects the verification key for a token from its kid header.
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	key, err := lookupKey(m.keys, token)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", ErrTokenExpired
+		return nil, err
+	}
+	return key.verifyKey, nil
+}
+
+// lookupKey finds the key named by the kid header of the token and makes sure the
+// token was signed with the same algorithm as the key, so a public key can never be
+// used as an HMAC secret.
+func lookupKey(keys *KeySet, token *jwt.Token) (*SigningKey, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var key *SigningKey
+	if kid == "" {
+		key = keys.Active()
+	} else {
+		found, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
 		}
-		return "", fmt.Errorf("failed to parse token: %w", err)
+		key = found
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("error get user claims from token")
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
 
-	return claims["sub"].(string), nil
+	return key, nil
 }
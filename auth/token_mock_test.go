@@ -0,0 +1,27 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MamangRust/monolith-payment-gateway-pkg/auth"
+	mock_auth "github.com/MamangRust/monolith-payment-gateway-pkg/auth/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestValidateToken_Expired_WithMock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMgr := mock_auth.NewMockTokenManager(ctrl)
+
+	mockMgr.EXPECT().
+		ValidateToken(gomock.Any()).
+		Return(nil, auth.ErrTokenExpired)
+
+	claims, err := mockMgr.ValidateToken("expired.jwt.token")
+	assert.Error(t, err)
+	assert.Nil(t, claims)
+	assert.True(t, errors.Is(err, auth.ErrTokenExpired))
+}
@@ -5,10 +5,8 @@ import (
 	"testing"
 	"time"
 
-	mock_auth "github.com/MamangRust/monolith-payment-gateway-pkg/auth/mocks"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
-	"go.uber.org/mock/gomock"
 )
 
 const secretKey = "mySecretKey"
@@ -17,20 +15,83 @@ func TestGenerateToken_Success(t *testing.T) {
 	mgr, err := NewManager(secretKey)
 	assert.NoError(t, err)
 
-	tokenStr, err := mgr.GenerateToken(123, "gateway")
+	tokenStr, err := mgr.GenerateToken(NewClaims(123, "gateway"))
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenStr)
 }
 
+func TestGenerateToken_MissingSubject(t *testing.T) {
+	mgr, _ := NewManager(secretKey)
+
+	_, err := mgr.GenerateToken(&Claims{})
+	assert.True(t, errors.Is(err, ErrMissingSubject))
+}
+
 func TestValidateToken_Success(t *testing.T) {
 	mgr, _ := NewManager(secretKey)
 
-	tokenStr, err := mgr.GenerateToken(456, "apigateway")
+	claims := NewClaims(456, "apigateway")
+	claims.Roles = []string{"ROLE_ADMIN", "ROLE_MERCHANT"}
+	claims.MerchantID = 12
+	claims.SessionID = "session-1"
+	claims.Scopes = []string{"topup:read"}
+
+	tokenStr, err := mgr.GenerateToken(claims)
+	assert.NoError(t, err)
+
+	got, err := mgr.ValidateToken(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "456", got.Subject)
+	assert.Equal(t, []string{"ROLE_ADMIN", "ROLE_MERCHANT"}, got.Roles)
+	assert.Equal(t, 12, got.MerchantID)
+	assert.Equal(t, "session-1", got.SessionID)
+	assert.True(t, got.HasScope("topup:read"))
+	assert.NotNil(t, got.IssuedAt)
+
+	userID, err := got.UserID()
+	assert.NoError(t, err)
+	assert.Equal(t, 456, userID)
+}
+
+func TestValidateToken_IssuerAndAudience(t *testing.T) {
+	mgr, _ := NewManager(secretKey, WithIssuer("auth-service"), WithAudience("apigateway", "merchant"))
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(1))
+	assert.NoError(t, err)
+
+	got, err := mgr.ValidateToken(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "auth-service", got.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"apigateway"}, got.Audience)
+
+	tokenStr, err = mgr.GenerateToken(NewClaims(1, "merchant"))
+	assert.NoError(t, err)
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.NoError(t, err)
+
+	tokenStr, err = mgr.GenerateToken(NewClaims(1, "other"))
+	assert.NoError(t, err)
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.True(t, errors.Is(err, ErrInvalidAudience))
+
+	other, _ := NewManager(secretKey, WithIssuer("someone-else"))
+	tokenStr, err = other.GenerateToken(NewClaims(1, "apigateway"))
 	assert.NoError(t, err)
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.Error(t, err)
+}
 
-	userID, err := mgr.ValidateToken(tokenStr)
+func TestValidateToken_MissingSubject(t *testing.T) {
+	mgr, _ := NewManager(secretKey)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	tokenStr, err := token.SignedString([]byte(secretKey))
 	assert.NoError(t, err)
-	assert.Equal(t, "456", userID)
+
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.True(t, errors.Is(err, ErrMissingSubject))
 }
 
 func TestValidateToken_InvalidToken(t *testing.T) {
@@ -56,25 +117,9 @@ func TestValidateToken_Expired(t *testing.T) {
 	tokenStr, err := token.SignedString([]byte(secretKey))
 	assert.NoError(t, err)
 
-	userID, err := mgr.ValidateToken(tokenStr)
-
-	assert.Error(t, err)
-	assert.Equal(t, "", userID)
-	assert.True(t, errors.Is(err, ErrTokenExpired))
-}
-
-func TestValidateToken_Expired_WithMock(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockMgr := mock_auth.NewMockTokenManager(ctrl)
-
-	mockMgr.EXPECT().
-		ValidateToken(gomock.Any()).
-		Return("", ErrTokenExpired)
+	claims, err := mgr.ValidateToken(tokenStr)
 
-	userID, err := mockMgr.ValidateToken("expired.jwt.token")
 	assert.Error(t, err)
-	assert.Equal(t, "", userID)
+	assert.Nil(t, claims)
 	assert.True(t, errors.Is(err, ErrTokenExpired))
 }
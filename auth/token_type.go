@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidTokenType is returned when a token of one type is presented where another is expected.
+var ErrInvalidTokenType = errors.New("token has invalid type")
+
+// TokenType distinguishes the purposes a Manager issues tokens for. Every type has
+// its own audience and lifetime, so a token of one type cannot be replayed as another.
+type TokenType string
+
+const (
+	TokenTypeAccess            TokenType = "access"
+	TokenTypeRefresh           TokenType = "refresh"
+	TokenTypeEmailVerification TokenType = "email_verification"
+	TokenTypePasswordReset     TokenType = "password_reset"
+)
+
+// tokenTypeConfig is the audience and lifetime of one token type.
+type tokenTypeConfig struct {
+	audience string
+	ttl      time.Duration
+}
+
+// defaultTokenTypes returns the built-in token types. Access tokens have no audience
+// of their own so WithAudience keeps deciding it.
+func defaultTokenTypes() map[TokenType]tokenTypeConfig {
+	return map[TokenType]tokenTypeConfig{
+		TokenTypeAccess:            {ttl: 12 * time.Hour},
+		TokenTypeRefresh:           {audience: "refresh", ttl: 7 * 24 * time.Hour},
+		TokenTypeEmailVerification: {audience: "email-verification", ttl: 24 * time.Hour},
+		TokenTypePasswordReset:     {audience: "password-reset", ttl: time.Hour},
+	}
+}
+
+// WithAccessTokenTTL sets the lifetime of access tokens. The default is 12 hours.
+func WithAccessTokenTTL(ttl time.Duration) Option {
+	return WithTokenTTL(TokenTypeAccess, ttl)
+}
+
+// WithTokenTTL sets the lifetime of tokens of the given type.
+func WithTokenTTL(tokenType TokenType, ttl time.Duration) Option {
+	return func(m *Manager) {
+		cfg := m.types[tokenType]
+		cfg.ttl = ttl
+		m.types[tokenType] = cfg
+	}
+}
+
+// WithTokenAudience sets the audience of tokens of the given type. Tokens of that
+// type are only accepted when they carry this audience.
+func WithTokenAudience(tokenType TokenType, audience string) Option {
+	return func(m *Manager) {
+		cfg := m.types[tokenType]
+		cfg.audience = audience
+		m.types[tokenType] = cfg
+	}
+}
+
+// WithNotBefore delays the start of validity of generated tokens by d.
+func WithNotBefore(d time.Duration) Option {
+	return func(m *Manager) {
+		m.notBefore = d
+	}
+}
+
+// WithLeeway allows for clock skew between the issuer and the validator when
+// checking expiry, not-before and issued-at times.
+func WithLeeway(d time.Duration) Option {
+	return func(m *Manager) {
+		m.leeway = d
+	}
+}
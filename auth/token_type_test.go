@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenTypes_CannotBeReplayed(t *testing.T) {
+	ctx := context.Background()
+	mgr, err := NewManager(secretKey, WithAudience("apigateway"))
+	require.NoError(t, err)
+
+	claims := NewClaims(3)
+	claims.Type = TokenTypePasswordReset
+	resetToken, err := mgr.GenerateToken(claims)
+	require.NoError(t, err)
+
+	got, err := mgr.ValidateTypedToken(ctx, TokenTypePasswordReset, resetToken)
+	require.NoError(t, err)
+	assert.Equal(t, TokenTypePasswordReset, got.Type)
+	assert.Equal(t, jwt.ClaimStrings{"password-reset"}, got.Audience)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), got.ExpiresAt.Time, 5*time.Second)
+
+	_, err = mgr.ValidateToken(resetToken)
+	assert.True(t, errors.Is(err, ErrInvalidTokenType))
+
+	_, err = mgr.ValidateTypedToken(ctx, TokenTypeEmailVerification, resetToken)
+	assert.True(t, errors.Is(err, ErrInvalidTokenType))
+
+	accessToken, err := mgr.GenerateToken(NewClaims(3))
+	require.NoError(t, err)
+
+	_, err = mgr.ValidateTypedToken(ctx, TokenTypePasswordReset, accessToken)
+	assert.True(t, errors.Is(err, ErrInvalidTokenType))
+
+	_, err = mgr.ValidateTypedToken(ctx, TokenType("unknown"), accessToken)
+	assert.True(t, errors.Is(err, ErrInvalidTokenType))
+}
+
+func TestTokenTypes_Lifetimes(t *testing.T) {
+	mgr, err := NewManager(secretKey,
+		WithAccessTokenTTL(15*time.Minute),
+		WithTokenTTL(TokenTypeEmailVerification, 48*time.Hour),
+		WithTokenAudience(TokenTypeEmailVerification, "verify"),
+	)
+	require.NoError(t, err)
+
+	accessToken, err := mgr.GenerateToken(NewClaims(1))
+	require.NoError(t, err)
+	got, err := mgr.ValidateToken(accessToken)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), got.ExpiresAt.Time, 5*time.Second)
+
+	claims := NewClaims(1)
+	claims.Type = TokenTypeEmailVerification
+	verifyToken, err := mgr.GenerateToken(claims)
+	require.NoError(t, err)
+	got, err = mgr.ValidateTypedToken(context.Background(), TokenTypeEmailVerification, verifyToken)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.ClaimStrings{"verify"}, got.Audience)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), got.ExpiresAt.Time, 5*time.Second)
+}
+
+func TestTokenTypes_NotBeforeAndLeeway(t *testing.T) {
+	mgr, err := NewManager(secretKey, WithNotBefore(time.Hour))
+	require.NoError(t, err)
+
+	tokenStr, err := mgr.GenerateToken(NewClaims(1))
+	require.NoError(t, err)
+
+	_, err = mgr.ValidateToken(tokenStr)
+	assert.True(t, errors.Is(err, jwt.ErrTokenNotValidYet))
+
+	lenient, err := NewManager(secretKey, WithLeeway(2*time.Minute))
+	require.NoError(t, err)
+
+	claims := NewClaims(1)
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	tokenStr, err = lenient.GenerateToken(claims)
+	require.NoError(t, err)
+
+	_, err = lenient.ValidateToken(tokenStr)
+	assert.NoError(t, err)
+
+	strict, _ := NewManager(secretKey)
+	_, err = strict.ValidateToken(tokenStr)
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+}
@@ -90,7 +90,7 @@ WHERE
 -- GetMerchantByApiKey: Retrieves a merchant by its API key
 -- Purpose: Authenticate or lookup a merchant using its API key
 -- Parameters:
---   $1: api_key - API key of the merchant
+--   $1: api_key - Stored hash of the merchant API key (apikey.Key.Hash)
 -- Returns:
 --   Complete merchant record
 -- Business Logic:
@@ -98,6 +98,48 @@ WHERE
 -- name: GetMerchantByApiKey :one
 SELECT * FROM merchants WHERE api_key = $1 AND deleted_at IS NULL;
 
+-- GetMerchantByApiKeyPrefix: Retrieves a merchant by the public prefix of its API key
+-- Purpose: Find the merchant of a signed request, which carries only the key prefix
+-- Parameters:
+--   $1: prefix - Public prefix of the merchant API key (apikey.Key.Prefix)
+-- Returns:
+--   Complete merchant record
+-- Business Logic:
+--   - Excludes soft-deleted merchants (deleted_at IS NULL)
+--   - Compares the part of the stored api_key hash before the first dot for equality,
+--     which the unique index merchants_api_key_prefix_key serves
+-- name: GetMerchantByApiKeyPrefix :one
+SELECT * FROM merchants WHERE split_part(api_key, '.', 1) = @prefix::TEXT AND deleted_at IS NULL;
+
+-- HashLegacyMerchantApiKeys: Replaces plain legacy API keys with their hash
+-- Purpose: Migrate keys created by apikey.GenerateApiKey, which were stored in plain text
+-- Returns: The number of migrated merchants
+-- Business Logic:
+--   - Only touches api_key values of 64 hex characters, so it can run repeatedly
+--   - Stores 'lk_' followed by the SHA-256 of the lower-cased key (apikey.HashKey)
+--   - Sets updated_at to the current timestamp
+-- name: HashLegacyMerchantApiKeys :execrows
+UPDATE merchants
+SET api_key = 'lk_' || encode(sha256(convert_to(lower(api_key), 'UTF8')), 'hex'),
+    updated_at = current_timestamp
+WHERE api_key ~ '^[0-9a-fA-F]{64}$';
+
+-- RevokeLegacyMerchantApiKey: Disables the API key stored in merchants.api_key
+-- Purpose: Retire a legacy key once the merchant switched to keys in merchant_api_keys
+-- Parameters:
+--   $1: merchant_id - ID of the merchant
+-- Returns: The number of updated rows, 0 when the merchant is unknown or its key is already revoked
+-- Business Logic:
+--   - Prepends 'revoked:' to the stored hash, which no key hashes to, so the value stays unique
+--   - Sets updated_at to the current timestamp
+-- name: RevokeLegacyMerchantApiKey :execrows
+UPDATE merchants
+SET api_key = 'revoked:' || api_key,
+    updated_at = current_timestamp
+WHERE merchant_id = $1
+  AND deleted_at IS NULL
+  AND api_key NOT LIKE 'revoked:%';
+
 -- GetMerchantByName: Retrieves a merchant by its name
 -- Purpose: Find merchant data based on exact name match
 -- Parameters:
@@ -1194,7 +1236,7 @@ LIMIT $3 OFFSET $4;
 -- Purpose: Insert a new merchant record into the database
 -- Parameters:
 --   $1: name - The name of the merchant
---   $2: api_key - Unique API key for the merchant
+--   $2: api_key - Hash of the merchant API key, never the plain key
 --   $3: user_id - ID of the user associated with the merchant
 --   $4: status - Current status of the merchant (e.g., active, inactive)
 -- Returns:
@@ -0,0 +1,96 @@
+-- CreateMerchantApiKey: Stores a new API key of a merchant
+-- Purpose: Issue an additional or rotated key without touching the other keys
+-- Parameters:
+--   $1: merchant_id - ID of the merchant owning the key
+--   $2: name - Name chosen by the merchant, e.g. "production"
+--   $3: prefix - Public prefix of the key (apikey.Key.Prefix)
+--   $4: key_hash - Stored hash of the key (apikey.Key.Hash)
+--   $5: scopes - Scopes granted to the key
+--   $6: expires_at - Expiration of the key, or NULL for keys that do not expire
+--   $7: signing_key - Request signing key derived from the secret (apikey.Key.SigningKey), encrypted with apikey.KeyCipher
+-- Returns: The created key record, or no row when the prefix is taken
+-- Business Logic:
+--   - Sets created_at to the current timestamp
+--   - Leaves the stored key alone when the prefix is taken, also inside a transaction,
+--     so the caller can generate another key
+-- name: CreateMerchantApiKey :one
+INSERT INTO merchant_api_keys (merchant_id, name, prefix, key_hash, scopes, expires_at, signing_key, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, current_timestamp)
+ON CONFLICT (prefix) DO NOTHING
+RETURNING api_key_id, merchant_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at, signing_key;
+
+-- GetMerchantApiKeyByPrefix: Retrieves an API key by its public prefix
+-- Purpose: Authenticate a request carrying a merchant API key
+-- Parameters:
+--   $1: prefix - Public prefix of the key
+-- Returns: The key record, including revoked and expired keys
+-- name: GetMerchantApiKeyByPrefix :one
+SELECT api_key_id, merchant_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at, signing_key
+FROM merchant_api_keys
+WHERE prefix = $1;
+
+-- GetMerchantApiKey: Retrieves an API key of a merchant
+-- Purpose: Load the key being rotated
+-- Parameters:
+--   $1: api_key_id - ID of the key
+--   $2: merchant_id - ID of the merchant owning the key
+-- Returns: The key record, including revoked and expired keys
+-- name: GetMerchantApiKey :one
+SELECT api_key_id, merchant_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at, signing_key
+FROM merchant_api_keys
+WHERE api_key_id = $1
+  AND merchant_id = $2;
+
+-- GetMerchantApiKeys: Lists the usable API keys of a merchant
+-- Purpose: Show merchants their keys
+-- Parameters:
+--   $1: merchant_id - ID of the merchant
+-- Returns: The keys that are neither revoked nor expired, newest first
+-- Business Logic:
+--   - Keys in a rotation overlap are listed until they expire
+-- name: GetMerchantApiKeys :many
+SELECT api_key_id, merchant_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at, signing_key
+FROM merchant_api_keys
+WHERE merchant_id = $1
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > current_timestamp)
+ORDER BY created_at DESC;
+
+-- TouchMerchantApiKey: Records the use of an API key
+-- Purpose: Let merchants see which keys are still in use before revoking them
+-- Parameters:
+--   $1: api_key_id - ID of the key
+-- name: TouchMerchantApiKey :exec
+UPDATE merchant_api_keys
+SET last_used_at = current_timestamp
+WHERE api_key_id = $1;
+
+-- ExpireMerchantApiKey: Shortens the lifetime of an API key
+-- Purpose: Keep a rotated key working during the overlap window
+-- Parameters:
+--   $1: api_key_id - ID of the key
+--   $2: merchant_id - ID of the merchant owning the key
+--   $3: expires_at - New expiration of the key
+-- Returns: The number of updated rows, 0 when the key is unknown, revoked or expired
+-- Business Logic:
+--   - Never extends a key that already expires before $3
+-- name: ExpireMerchantApiKey :execrows
+UPDATE merchant_api_keys
+SET expires_at = LEAST(COALESCE(expires_at, $3), $3)
+WHERE api_key_id = $1
+  AND merchant_id = $2
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > current_timestamp);
+
+-- RevokeMerchantApiKey: Revokes an API key immediately
+-- Purpose: Disable a leaked or unused key
+-- Parameters:
+--   $1: api_key_id - ID of the key
+--   $2: merchant_id - ID of the merchant owning the key
+-- Returns: The number of updated rows, 0 when the key is unknown or already revoked
+-- name: RevokeMerchantApiKey :execrows
+UPDATE merchant_api_keys
+SET revoked_at = current_timestamp
+WHERE api_key_id = $1
+  AND merchant_id = $2
+  AND revoked_at IS NULL;
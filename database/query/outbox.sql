@@ -0,0 +1,86 @@
+-- CreateOutboxEvent: Records a domain event to be published to Kafka
+-- Purpose: Store an event in the same transaction as the business write it describes
+-- Parameters:
+--   $1: topic - Kafka topic the event is published to
+--   $2: event_key - Kafka message key, e.g. the transaction number
+--   $3: payload - Encoded event
+--   $4: traceparent - W3C trace context of the write, or NULL
+--   $5: tracestate - W3C trace state of the write, or NULL
+-- Returns: The created event record
+-- Business Logic:
+--   - The event becomes available to the relay immediately
+--   - Sets created_at to the current timestamp
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox_events (topic, event_key, payload, traceparent, tracestate, available_at, created_at)
+VALUES ($1, $2, $3, $4, $5, current_timestamp, current_timestamp)
+RETURNING outbox_id, topic, event_key, payload, attempts, last_error, available_at, sent_at, created_at, traceparent, tracestate;
+
+-- GetPendingOutboxEvents: Locks the next events to publish
+-- Purpose: Let the relay claim a batch of unsent events
+-- Parameters:
+--   $1: limit - Maximum number of events to claim
+-- Returns: Unsent events whose retry time has come, oldest first
+-- Business Logic:
+--   - Rows stay locked until the surrounding transaction ends
+--   - Rows locked by another relay are skipped, so several relays can run at once
+--   - Events are left out while an earlier unsent event with the same topic and
+--     key is waiting for a retry or locked by another relay, so they are
+--     published in order
+-- name: GetPendingOutboxEvents :many
+WITH claimed AS (
+    SELECT outbox_id
+    FROM outbox_events
+    WHERE sent_at IS NULL
+      AND available_at <= current_timestamp
+    ORDER BY outbox_id
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+SELECT outbox_id, topic, event_key, payload, attempts, last_error, available_at, sent_at, created_at, traceparent, tracestate
+FROM outbox_events e
+WHERE e.outbox_id IN (SELECT outbox_id FROM claimed)
+  AND NOT EXISTS (
+      SELECT 1
+      FROM outbox_events earlier
+      WHERE earlier.topic = e.topic
+        AND earlier.event_key = e.event_key
+        AND earlier.sent_at IS NULL
+        AND earlier.outbox_id < e.outbox_id
+        AND earlier.outbox_id NOT IN (SELECT outbox_id FROM claimed)
+  )
+ORDER BY e.outbox_id;
+
+-- MarkOutboxEventSent: Marks an event as published
+-- Purpose: Keep the relay from publishing the event again
+-- Parameters:
+--   $1: outbox_id - ID of the event
+-- name: MarkOutboxEventSent :exec
+UPDATE outbox_events
+SET sent_at = current_timestamp,
+    last_error = NULL
+WHERE outbox_id = $1;
+
+-- MarkOutboxEventFailed: Records a failed publish attempt
+-- Purpose: Retry the event later with backoff
+-- Parameters:
+--   $1: outbox_id - ID of the event
+--   $2: last_error - Error returned by Kafka
+--   $3: available_at - Time of the next attempt
+-- Business Logic:
+--   - Increments attempts
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox_events
+SET attempts = attempts + 1,
+    last_error = $2,
+    available_at = $3
+WHERE outbox_id = $1;
+
+-- DeleteSentOutboxEvents: Removes published events
+-- Purpose: Keep the outbox table small
+-- Parameters:
+--   $1: sent_at - Events published before this time are deleted
+-- Returns: The number of deleted rows
+-- name: DeleteSentOutboxEvents :execrows
+DELETE FROM outbox_events
+WHERE sent_at IS NOT NULL
+  AND sent_at < $1;
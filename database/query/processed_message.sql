@@ -0,0 +1,37 @@
+-- IsMessageProcessed: Checks whether a consumer group already handled a message
+-- Purpose: Skip Kafka messages that are redelivered, e.g. after a rebalance
+-- Parameters:
+--   $1: consumer_group - Kafka consumer group
+--   $2: message_key - Idempotency key of the message
+-- Returns: true when the message was processed
+-- name: IsMessageProcessed :one
+SELECT EXISTS (
+    SELECT 1
+    FROM processed_messages
+    WHERE consumer_group = $1
+      AND message_key = $2
+);
+
+-- CreateProcessedMessage: Records that a consumer group handled a message
+-- Purpose: Claim a message before handling it, so later deliveries are skipped
+-- Parameters:
+--   $1: consumer_group - Kafka consumer group
+--   $2: message_key - Idempotency key of the message
+-- Returns: 1 when the message was recorded, 0 when it was already recorded
+-- Business Logic:
+--   - Does nothing when the message is already recorded
+--   - Waits for a concurrent transaction recording the same message to finish
+--   - Sets processed_at to the current timestamp
+-- name: CreateProcessedMessage :execrows
+INSERT INTO processed_messages (consumer_group, message_key, processed_at)
+VALUES ($1, $2, current_timestamp)
+ON CONFLICT (consumer_group, message_key) DO NOTHING;
+
+-- DeleteProcessedMessages: Removes old processed message records
+-- Purpose: Keep the processed_messages table small
+-- Parameters:
+--   $1: processed_at - Records older than this time are deleted
+-- Returns: The number of deleted rows
+-- name: DeleteProcessedMessages :execrows
+DELETE FROM processed_messages
+WHERE processed_at < $1;
@@ -4,15 +4,19 @@
 --   $1: user_id - ID of the user this token belongs to
 --   $2: token - The actual refresh token string
 --   $3: expiration - Expiration timestamp of the token
+--   $4: session_id - ID of the session the token belongs to
+--   $5: merchant_id - Merchant the access tokens are issued for, or NULL
+--   $6: scopes - Scopes granted to the access tokens
 -- Returns: The created refresh token record (excluding sensitive fields if any)
 -- Business Logic:
 --   - Sets both created_at and updated_at to current timestamp
 --   - Used in JWT refresh token rotation
 --   - Typically created during login/auth flows
+--   - merchant_id and scopes are copied to the next token on rotation
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (user_id, token, expiration, created_at, updated_at)
-VALUES ($1, $2, $3, current_timestamp, current_timestamp)
-RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at;
+INSERT INTO refresh_tokens (user_id, token, expiration, session_id, merchant_id, scopes, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, current_timestamp, current_timestamp)
+RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes;
 
 -- FindRefreshTokenByToken: Retrieves active refresh token by token string
 -- Purpose: Validate and lookup refresh token
@@ -24,10 +28,25 @@ RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at,
 --   - Used during token refresh operations
 --   - Helps prevent token reuse
 -- name: FindRefreshTokenByToken :one
-SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at
+SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
 FROM refresh_tokens
 WHERE token = $1 AND deleted_at IS NULL;
 
+-- FindRefreshTokenByTokenForUpdate: Retrieves a refresh token by token string and locks it
+-- Purpose: Validate a refresh token during rotation and detect reuse
+-- Parameters:
+--   $1: token - The refresh token string to find
+-- Returns: The refresh token record, including revoked tokens
+-- Business Logic:
+--   - Also returns revoked (deleted_at IS NOT NULL) tokens so reuse can be detected
+--   - Locks the row until the end of the transaction
+--   - Prevents two concurrent rotations of the same token
+-- name: FindRefreshTokenByTokenForUpdate :one
+SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
+FROM refresh_tokens
+WHERE token = $1
+FOR UPDATE;
+
 -- FindRefreshTokenByUserId: Retrieves latest active refresh token for user
 -- Purpose: Get current valid refresh token for a user
 -- Parameters:
@@ -46,7 +65,10 @@ SELECT
     expiration,
     created_at,
     updated_at,
-    deleted_at
+    deleted_at,
+    session_id,
+    merchant_id,
+    scopes
 FROM
     refresh_tokens
 WHERE
@@ -72,6 +94,19 @@ SET token = $2, expiration = $3, updated_at = current_timestamp
 WHERE user_id = $1 AND deleted_at IS NULL
 RETURNING *;
 
+-- RevokeRefreshToken: Marks a refresh token as revoked
+-- Purpose: Retire a refresh token after it has been rotated or logged out
+-- Parameters:
+--   $1: token - The token string to revoke
+-- Business Logic:
+--   - Soft deletes the token by setting deleted_at
+--   - Keeps the row so later reuse of the token can be detected
+--   - Only affects active tokens
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET deleted_at = current_timestamp, updated_at = current_timestamp
+WHERE token = $1 AND deleted_at IS NULL;
+
 -- DeleteRefreshToken: Permanently deletes a refresh token
 -- Purpose: Invalidate a specific refresh token
 -- Parameters:
@@ -95,3 +130,16 @@ WHERE token = $1;
 -- name: DeleteRefreshTokenByUserId :exec
 DELETE FROM refresh_tokens
 WHERE user_id = $1;
+
+
+-- RevokeSessionRefreshTokens: Revokes the refresh tokens of a session
+-- Purpose: End a session so it can no longer be refreshed
+-- Parameters:
+--   $1: session_id - ID of the session
+-- Business Logic:
+--   - Soft deletes the tokens so later reuse is still detected
+--   - Only affects active tokens
+-- name: RevokeSessionRefreshTokens :exec
+UPDATE refresh_tokens
+SET deleted_at = current_timestamp, updated_at = current_timestamp
+WHERE session_id = $1 AND deleted_at IS NULL;
@@ -10,3 +10,35 @@ WHERE user_id = $1;
 -- name: GetResetToken :one
 SELECT * FROM reset_tokens
 WHERE token = $1;
+
+-- GetResetTokenByUserID: Retrieves and locks the pending reset token of a user
+-- Purpose: Check a reset code entered together with the email address
+-- Parameters:
+--   $1: user_id - ID of the user resetting the password
+-- Returns: The reset token record, with the hash of the code in token
+-- Business Logic:
+--   - Locks the row until the transaction ends so concurrent attempts are counted one by one
+-- name: GetResetTokenByUserID :one
+SELECT * FROM reset_tokens
+WHERE user_id = $1
+FOR UPDATE;
+
+-- IncrementResetTokenAttempts: Records a wrong reset code
+-- Purpose: Enforce the attempt limit of a reset token
+-- Parameters:
+--   $1: id - ID of the reset token
+-- Returns: The number of failed attempts so far
+-- name: IncrementResetTokenAttempts :one
+UPDATE reset_tokens
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- ConsumeResetToken: Deletes a reset token once it was used
+-- Purpose: Make reset tokens single use
+-- Parameters:
+--   $1: id - ID of the reset token
+-- Returns: The number of deleted rows, 0 when the token was already consumed
+-- name: ConsumeResetToken :execrows
+DELETE FROM reset_tokens
+WHERE id = $1;
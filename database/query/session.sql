@@ -0,0 +1,80 @@
+-- CreateSession: Records a new login session
+-- Purpose: Track the device a user logged in from
+-- Parameters:
+--   $1: session_id - Random ID of the session, carried as sid in access tokens
+--   $2: user_id - ID of the user logging in
+--   $3: user_agent - User-Agent header of the login request
+--   $4: ip_address - Client IP of the login request
+--   $5: expires_at - Expiration of the refresh token issued with the session
+-- Returns: The created session record
+-- Business Logic:
+--   - Sets created_at and last_seen_at to the current timestamp
+-- name: CreateSession :one
+INSERT INTO sessions (session_id, user_id, user_agent, ip_address, expires_at, created_at, last_seen_at)
+VALUES ($1, $2, $3, $4, $5, current_timestamp, current_timestamp)
+RETURNING session_id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at;
+
+-- GetSession: Retrieves a session by ID
+-- Purpose: Check a session during token refresh
+-- Parameters:
+--   $1: session_id - ID of the session
+-- Returns: The session record, including revoked sessions
+-- name: GetSession :one
+SELECT session_id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+FROM sessions
+WHERE session_id = $1;
+
+-- GetUserSessions: Lists the active sessions of a user
+-- Purpose: Show users the devices they are logged in on
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: The active sessions, most recently used first
+-- Business Logic:
+--   - Excludes revoked and expired sessions
+-- name: GetUserSessions :many
+SELECT session_id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+FROM sessions
+WHERE user_id = $1
+  AND revoked_at IS NULL
+  AND expires_at > current_timestamp
+ORDER BY last_seen_at DESC;
+
+-- TouchSession: Records activity on a session
+-- Purpose: Keep last_seen_at and the expiry current when tokens are refreshed
+-- Parameters:
+--   $1: session_id - ID of the session
+--   $2: expires_at - Expiration of the newly issued refresh token
+-- Returns: The number of updated rows, 0 when the session was revoked
+-- name: TouchSession :execrows
+UPDATE sessions
+SET last_seen_at = current_timestamp,
+    expires_at = $2
+WHERE session_id = $1
+  AND revoked_at IS NULL;
+
+-- RevokeSession: Ends a session of a user
+-- Purpose: Remote logout of one device
+-- Parameters:
+--   $1: session_id - ID of the session
+--   $2: user_id - ID of the user owning the session
+-- Returns: The number of updated rows, 0 when the session is unknown, owned by someone else or already revoked
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = current_timestamp
+WHERE session_id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL;
+
+-- RevokeUserSessions: Ends every session of a user except one
+-- Purpose: Logout from all devices
+-- Parameters:
+--   $1: user_id - ID of the user
+--   $2: session_id - Session to keep, or an empty string to end all of them
+-- Returns: The IDs of the revoked sessions
+-- name: RevokeUserSessions :many
+UPDATE sessions
+SET revoked_at = current_timestamp
+WHERE user_id = $1
+  AND session_id <> $2
+  AND revoked_at IS NULL
+RETURNING session_id;
@@ -261,6 +261,51 @@ WHERE
     RETURNING *;
 
 
+-- UpdateUserVerificationCode: Replaces the verification code of a user
+-- Purpose: Issue a new email verification code
+-- Parameters:
+--   $1: user_id - ID of the user
+--   $2: verification_code - SHA-256 hash of the code sent by email
+--   $3: verification_expires_at - Time after which the code is rejected
+-- Returns: None
+-- Business Logic:
+--   - Only the hash is stored, so a leaked row cannot be used to verify the account
+--   - Replaces any earlier code of the user
+-- name: UpdateUserVerificationCode :exec
+UPDATE users
+SET
+    verification_code = $2,
+    verification_expires_at = $3,
+    updated_at = current_timestamp
+WHERE
+    user_id = $1
+    AND deleted_at IS NULL;
+
+
+-- VerifyUserByCode: Marks the user owning a verification code as verified
+-- Purpose: Consume an email verification code
+-- Parameters:
+--   $1: verification_code - SHA-256 hash of the code from the email
+--   $2: verification_expires_at - The current time
+-- Returns: The verified user record
+-- Business Logic:
+--   - Clears the code in the same statement so it can only be used once
+--   - Ignores empty and expired codes, codes without an expiry and deleted users
+-- name: VerifyUserByCode :one
+UPDATE users
+SET
+    is_verified = true,
+    verification_code = '',
+    verification_expires_at = NULL,
+    updated_at = current_timestamp
+WHERE
+    verification_code = $1
+    AND verification_code <> ''
+    AND verification_expires_at > $2
+    AND deleted_at IS NULL
+    RETURNING *;
+
+
 -- TrashUser: Soft-deletes a user account
 -- Purpose: Deactivate user without permanent deletion
 -- Parameters:
@@ -0,0 +1,108 @@
+-- CreateUserTwoFactor: Stores a new TOTP secret for a user
+-- Purpose: Start two-factor enrollment
+-- Parameters:
+--   $1: user_id - ID of the user enrolling
+--   $2: secret - Base32 encoded TOTP secret
+-- Returns: The two-factor record of the user, or no row when the enrollment is confirmed
+-- Business Logic:
+--   - Replaces the secret of an earlier enrollment that was never confirmed
+--   - Resets last_used_step so the new secret must be confirmed
+--   - Leaves a confirmed enrollment alone, so enabled two-factor authentication
+--     cannot be reset without disabling it first
+-- name: CreateUserTwoFactor :one
+INSERT INTO user_two_factors (user_id, secret, last_used_step, created_at, updated_at)
+VALUES ($1, $2, 0, current_timestamp, current_timestamp)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+    last_used_step = 0,
+    updated_at = current_timestamp
+WHERE user_two_factors.confirmed_at IS NULL
+RETURNING user_id, secret, confirmed_at, last_used_step, created_at, updated_at;
+
+-- GetUserTwoFactor: Retrieves the two-factor record of a user
+-- Purpose: Check whether a user has two-factor authentication and verify codes
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: The two-factor record of the user
+-- name: GetUserTwoFactor :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at, updated_at
+FROM user_two_factors
+WHERE user_id = $1;
+
+-- ConfirmUserTwoFactor: Marks the enrollment of a user as confirmed
+-- Purpose: Enable two-factor authentication once the user entered a valid code
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: None
+-- name: ConfirmUserTwoFactor :exec
+UPDATE user_two_factors
+SET confirmed_at = current_timestamp,
+    updated_at = current_timestamp
+WHERE user_id = $1;
+
+-- UpdateUserTwoFactorStep: Records the time step of an accepted TOTP code
+-- Purpose: Prevent a TOTP code from being used twice
+-- Parameters:
+--   $1: user_id - ID of the user
+--   $2: last_used_step - Time step of the accepted code
+-- Returns: Number of updated rows, 0 if the step was already used
+-- Business Logic:
+--   - Only moves last_used_step forward, so a code can never be replayed
+--     even by concurrent logins
+-- name: UpdateUserTwoFactorStep :execrows
+UPDATE user_two_factors
+SET last_used_step = $2,
+    updated_at = current_timestamp
+WHERE user_id = $1
+  AND last_used_step < $2;
+
+-- DeleteUserTwoFactor: Removes the two-factor record of a user
+-- Purpose: Disable two-factor authentication
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: None
+-- name: DeleteUserTwoFactor :exec
+DELETE FROM user_two_factors
+WHERE user_id = $1;
+
+-- CreateRecoveryCode: Stores the hash of a recovery code
+-- Purpose: Let users sign in when they lost their authenticator
+-- Parameters:
+--   $1: user_id - ID of the user
+--   $2: code_hash - Hash of the recovery code, never the code itself
+-- Returns: None
+-- name: CreateRecoveryCode :exec
+INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+VALUES ($1, $2, current_timestamp);
+
+-- GetUnusedRecoveryCodes: Retrieves the recovery codes of a user that were not used yet
+-- Purpose: Verify a recovery code entered at login
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: All unused recovery code records of the user
+-- name: GetUnusedRecoveryCodes :many
+SELECT recovery_code_id, user_id, code_hash, used_at, created_at
+FROM user_recovery_codes
+WHERE user_id = $1
+  AND used_at IS NULL
+ORDER BY recovery_code_id;
+
+-- UseRecoveryCode: Marks a recovery code as used
+-- Purpose: Make recovery codes one-time
+-- Parameters:
+--   $1: recovery_code_id - ID of the recovery code
+-- Returns: Number of updated rows, 0 if the code was already used
+-- name: UseRecoveryCode :execrows
+UPDATE user_recovery_codes
+SET used_at = current_timestamp
+WHERE recovery_code_id = $1
+  AND used_at IS NULL;
+
+-- DeleteRecoveryCodes: Removes every recovery code of a user
+-- Purpose: Replace recovery codes or disable two-factor authentication
+-- Parameters:
+--   $1: user_id - ID of the user
+-- Returns: None
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM user_recovery_codes
+WHERE user_id = $1;
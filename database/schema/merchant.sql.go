@@ -45,7 +45,7 @@ type CreateMerchantParams struct {
 // Parameters:
 //
 //	$1: name - The name of the merchant
-//	$2: api_key - Unique API key for the merchant
+//	$2: api_key - Hash of the merchant API key, never the plain key
 //	$3: user_id - ID of the user associated with the merchant
 //	$4: status - Current status of the merchant (e.g., active, inactive)
 //
@@ -532,7 +532,7 @@ SELECT merchant_id, merchant_no, name, api_key, user_id, status, created_at, upd
 // Purpose: Authenticate or lookup a merchant using its API key
 // Parameters:
 //
-//	$1: api_key - API key of the merchant
+//	$1: api_key - Stored hash of the merchant API key (apikey.Key.Hash)
 //
 // Returns:
 //
@@ -557,6 +557,41 @@ func (q *Queries) GetMerchantByApiKey(ctx context.Context, apiKey string) (*Merc
 	return &i, err
 }
 
+const getMerchantByApiKeyPrefix = `-- name: GetMerchantByApiKeyPrefix :one
+SELECT merchant_id, merchant_no, name, api_key, user_id, status, created_at, updated_at, deleted_at FROM merchants WHERE split_part(api_key, '.', 1) = $1::TEXT AND deleted_at IS NULL
+`
+
+// GetMerchantByApiKeyPrefix: Retrieves a merchant by the public prefix of its API key
+// Purpose: Find the merchant of a signed request, which carries only the key prefix
+// Parameters:
+//
+//	$1: prefix - Public prefix of the merchant API key (apikey.Key.Prefix)
+//
+// Returns:
+//
+//	Complete merchant record
+//
+// Business Logic:
+//   - Excludes soft-deleted merchants (deleted_at IS NULL)
+//   - Compares the part of the stored api_key hash before the first dot for equality,
+//     which the unique index merchants_api_key_prefix_key serves
+func (q *Queries) GetMerchantByApiKeyPrefix(ctx context.Context, prefix string) (*Merchant, error) {
+	row := q.db.QueryRowContext(ctx, getMerchantByApiKeyPrefix, prefix)
+	var i Merchant
+	err := row.Scan(
+		&i.MerchantID,
+		&i.MerchantNo,
+		&i.Name,
+		&i.ApiKey,
+		&i.UserID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return &i, err
+}
+
 const getMerchantByID = `-- name: GetMerchantByID :one
 SELECT merchant_id, merchant_no, name, api_key, user_id, status, created_at, updated_at, deleted_at
 FROM merchants
@@ -2400,6 +2435,28 @@ func (q *Queries) GetYearlyTotalAmountMerchant(ctx context.Context, dollar_1 int
 	return items, nil
 }
 
+const hashLegacyMerchantApiKeys = `-- name: HashLegacyMerchantApiKeys :execrows
+UPDATE merchants
+SET api_key = 'lk_' || encode(sha256(convert_to(lower(api_key), 'UTF8')), 'hex'),
+    updated_at = current_timestamp
+WHERE api_key ~ '^[0-9a-fA-F]{64}$'
+`
+
+// HashLegacyMerchantApiKeys: Replaces plain legacy API keys with their hash
+// Purpose: Migrate keys created by apikey.GenerateApiKey, which were stored in plain text
+// Returns: The number of migrated merchants
+// Business Logic:
+//   - Only touches api_key values of 64 hex characters, so it can run repeatedly
+//   - Stores 'lk_' followed by the SHA-256 of the lower-cased key (apikey.HashKey)
+//   - Sets updated_at to the current timestamp
+func (q *Queries) HashLegacyMerchantApiKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hashLegacyMerchantApiKeys)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const restoreAllMerchants = `-- name: RestoreAllMerchants :exec
 UPDATE merchants
 SET
@@ -2454,6 +2511,33 @@ func (q *Queries) RestoreMerchant(ctx context.Context, merchantID int32) (*Merch
 	return &i, err
 }
 
+const revokeLegacyMerchantApiKey = `-- name: RevokeLegacyMerchantApiKey :execrows
+UPDATE merchants
+SET api_key = 'revoked:' || api_key,
+    updated_at = current_timestamp
+WHERE merchant_id = $1
+  AND deleted_at IS NULL
+  AND api_key NOT LIKE 'revoked:%'
+`
+
+// RevokeLegacyMerchantApiKey: Disables the API key stored in merchants.api_key
+// Purpose: Retire a legacy key once the merchant switched to keys in merchant_api_keys
+// Parameters:
+//
+//	$1: merchant_id - ID of the merchant
+//
+// Returns: The number of updated rows, 0 when the merchant is unknown or its key is already revoked
+// Business Logic:
+//   - Prepends 'revoked:' to the stored hash, which no key hashes to, so the value stays unique
+//   - Sets updated_at to the current timestamp
+func (q *Queries) RevokeLegacyMerchantApiKey(ctx context.Context, merchantID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeLegacyMerchantApiKey, merchantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const trashMerchant = `-- name: TrashMerchant :one
 UPDATE merchants
 SET
@@ -36,6 +36,20 @@ type Merchant struct {
 	DeletedAt  sql.NullTime `json:"deleted_at"`
 }
 
+type MerchantApiKey struct {
+	ApiKeyID   int32          `json:"api_key_id"`
+	MerchantID int32          `json:"merchant_id"`
+	Name       string         `json:"name"`
+	Prefix     string         `json:"prefix"`
+	KeyHash    string         `json:"key_hash"`
+	Scopes     []string       `json:"scopes"`
+	ExpiresAt  sql.NullTime   `json:"expires_at"`
+	LastUsedAt sql.NullTime   `json:"last_used_at"`
+	RevokedAt  sql.NullTime   `json:"revoked_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	SigningKey sql.NullString `json:"signing_key"`
+}
+
 type MerchantDocument struct {
 	DocumentID   int32          `json:"document_id"`
 	MerchantID   int32          `json:"merchant_id"`
@@ -49,14 +63,37 @@ type MerchantDocument struct {
 	DeletedAt    sql.NullTime   `json:"deleted_at"`
 }
 
+type OutboxEvent struct {
+	OutboxID    int64          `json:"outbox_id"`
+	Topic       string         `json:"topic"`
+	EventKey    string         `json:"event_key"`
+	Payload     []byte         `json:"payload"`
+	Attempts    int32          `json:"attempts"`
+	LastError   sql.NullString `json:"last_error"`
+	AvailableAt time.Time      `json:"available_at"`
+	SentAt      sql.NullTime   `json:"sent_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Traceparent sql.NullString `json:"traceparent"`
+	Tracestate  sql.NullString `json:"tracestate"`
+}
+
+type ProcessedMessage struct {
+	ConsumerGroup string    `json:"consumer_group"`
+	MessageKey    string    `json:"message_key"`
+	ProcessedAt   time.Time `json:"processed_at"`
+}
+
 type RefreshToken struct {
-	RefreshTokenID int32        `json:"refresh_token_id"`
-	UserID         int32        `json:"user_id"`
-	Token          string       `json:"token"`
-	Expiration     time.Time    `json:"expiration"`
-	CreatedAt      sql.NullTime `json:"created_at"`
-	UpdatedAt      sql.NullTime `json:"updated_at"`
-	DeletedAt      sql.NullTime `json:"deleted_at"`
+	RefreshTokenID int32          `json:"refresh_token_id"`
+	UserID         int32          `json:"user_id"`
+	Token          string         `json:"token"`
+	Expiration     time.Time      `json:"expiration"`
+	CreatedAt      sql.NullTime   `json:"created_at"`
+	UpdatedAt      sql.NullTime   `json:"updated_at"`
+	DeletedAt      sql.NullTime   `json:"deleted_at"`
+	SessionID      sql.NullString `json:"session_id"`
+	MerchantID     sql.NullInt32  `json:"merchant_id"`
+	Scopes         []string       `json:"scopes"`
 }
 
 type ResetToken struct {
@@ -64,6 +101,7 @@ type ResetToken struct {
 	UserID     int64     `json:"user_id"`
 	Token      string    `json:"token"`
 	ExpiryDate time.Time `json:"expiry_date"`
+	Attempts   int32     `json:"attempts"`
 }
 
 type Role struct {
@@ -85,6 +123,17 @@ type Saldo struct {
 	DeletedAt      sql.NullTime  `json:"deleted_at"`
 }
 
+type Session struct {
+	SessionID  string       `json:"session_id"`
+	UserID     int32        `json:"user_id"`
+	UserAgent  string       `json:"user_agent"`
+	IpAddress  string       `json:"ip_address"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastSeenAt time.Time    `json:"last_seen_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
 type Topup struct {
 	TopupID     int32        `json:"topup_id"`
 	TopupNo     uuid.UUID    `json:"topup_no"`
@@ -126,16 +175,25 @@ type Transfer struct {
 }
 
 type User struct {
-	UserID           int32        `json:"user_id"`
-	Firstname        string       `json:"firstname"`
-	Lastname         string       `json:"lastname"`
-	Email            string       `json:"email"`
-	Password         string       `json:"password"`
-	VerificationCode string       `json:"verification_code"`
-	IsVerified       sql.NullBool `json:"is_verified"`
-	CreatedAt        sql.NullTime `json:"created_at"`
-	UpdatedAt        sql.NullTime `json:"updated_at"`
-	DeletedAt        sql.NullTime `json:"deleted_at"`
+	UserID                int32        `json:"user_id"`
+	Firstname             string       `json:"firstname"`
+	Lastname              string       `json:"lastname"`
+	Email                 string       `json:"email"`
+	Password              string       `json:"password"`
+	VerificationCode      string       `json:"verification_code"`
+	IsVerified            sql.NullBool `json:"is_verified"`
+	CreatedAt             sql.NullTime `json:"created_at"`
+	UpdatedAt             sql.NullTime `json:"updated_at"`
+	DeletedAt             sql.NullTime `json:"deleted_at"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+}
+
+type UserRecoveryCode struct {
+	RecoveryCodeID int32        `json:"recovery_code_id"`
+	UserID         int32        `json:"user_id"`
+	CodeHash       string       `json:"code_hash"`
+	UsedAt         sql.NullTime `json:"used_at"`
+	CreatedAt      sql.NullTime `json:"created_at"`
 }
 
 type UserRole struct {
@@ -147,6 +205,15 @@ type UserRole struct {
 	DeletedAt  sql.NullTime `json:"deleted_at"`
 }
 
+type UserTwoFactor struct {
+	UserID       int32        `json:"user_id"`
+	Secret       string       `json:"secret"`
+	ConfirmedAt  sql.NullTime `json:"confirmed_at"`
+	LastUsedStep int64        `json:"last_used_step"`
+	CreatedAt    sql.NullTime `json:"created_at"`
+	UpdatedAt    sql.NullTime `json:"updated_at"`
+}
+
 type Withdraw struct {
 	WithdrawID     int32        `json:"withdraw_id"`
 	WithdrawNo     uuid.UUID    `json:"withdraw_no"`
@@ -22,6 +22,18 @@ type Querier interface {
 	//   - Adds a new entry in the user_roles mapping table
 	//   - Timestamps created_at and updated_at auto-set to current
 	AssignRoleToUser(ctx context.Context, arg AssignRoleToUserParams) (*UserRole, error)
+	// ConfirmUserTwoFactor: Marks the enrollment of a user as confirmed
+	// Purpose: Enable two-factor authentication once the user entered a valid code
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: None
+	ConfirmUserTwoFactor(ctx context.Context, userID int32) error
+	// ConsumeResetToken: Deletes a reset token once it was used
+	// Purpose: Make reset tokens single use
+	// Parameters:
+	//   $1: id - ID of the reset token
+	// Returns: The number of deleted rows, 0 when the token was already consumed
+	ConsumeResetToken(ctx context.Context, id int32) (int64, error)
 	// CreateCard: Creates a new card record
 	// Purpose: Add a new card to the system for a specific user
 	// Parameters:
@@ -40,7 +52,7 @@ type Querier interface {
 	// Purpose: Insert a new merchant record into the database
 	// Parameters:
 	//   $1: name - The name of the merchant
-	//   $2: api_key - Unique API key for the merchant
+	//   $2: api_key - Hash of the merchant API key, never the plain key
 	//   $3: user_id - ID of the user associated with the merchant
 	//   $4: status - Current status of the merchant (e.g., active, inactive)
 	// Returns:
@@ -50,18 +62,69 @@ type Querier interface {
 	//   - Sets the created_at and updated_at timestamps to the current time.
 	//   - Returns the created merchant's data using the RETURNING clause.
 	CreateMerchant(ctx context.Context, arg CreateMerchantParams) (*Merchant, error)
+	// CreateMerchantApiKey: Stores a new API key of a merchant
+	// Purpose: Issue an additional or rotated key without touching the other keys
+	// Parameters:
+	//   $1: merchant_id - ID of the merchant owning the key
+	//   $2: name - Name chosen by the merchant, e.g. "production"
+	//   $3: prefix - Public prefix of the key (apikey.Key.Prefix)
+	//   $4: key_hash - Stored hash of the key (apikey.Key.Hash)
+	//   $5: scopes - Scopes granted to the key
+	//   $6: expires_at - Expiration of the key, or NULL for keys that do not expire
+	//   $7: signing_key - Request signing key derived from the secret (apikey.Key.SigningKey), encrypted with apikey.KeyCipher
+	// Returns: The created key record, or no row when the prefix is taken
+	// Business Logic:
+	//   - Sets created_at to the current timestamp
+	//   - Leaves the stored key alone when the prefix is taken, also inside a transaction,
+	//     so the caller can generate another key
+	CreateMerchantApiKey(ctx context.Context, arg CreateMerchantApiKeyParams) (*MerchantApiKey, error)
 	CreateMerchantDocument(ctx context.Context, arg CreateMerchantDocumentParams) (*MerchantDocument, error)
+	// CreateOutboxEvent: Records a domain event to be published to Kafka
+	// Purpose: Store an event in the same transaction as the business write it describes
+	// Parameters:
+	//   $1: topic - Kafka topic the event is published to
+	//   $2: event_key - Kafka message key, e.g. the transaction number
+	//   $3: payload - Encoded event
+	//   $4: traceparent - W3C trace context of the write, or NULL
+	//   $5: tracestate - W3C trace state of the write, or NULL
+	// Returns: The created event record
+	// Business Logic:
+	//   - The event becomes available to the relay immediately
+	//   - Sets created_at to the current timestamp
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (*OutboxEvent, error)
+	// CreateProcessedMessage: Records that a consumer group handled a message
+	// Purpose: Claim a message before handling it, so later deliveries are skipped
+	// Parameters:
+	//   $1: consumer_group - Kafka consumer group
+	//   $2: message_key - Idempotency key of the message
+	// Returns: 1 when the message was recorded, 0 when it was already recorded
+	// Business Logic:
+	//   - Does nothing when the message is already recorded
+	//   - Waits for a concurrent transaction recording the same message to finish
+	//   - Sets processed_at to the current timestamp
+	CreateProcessedMessage(ctx context.Context, arg CreateProcessedMessageParams) (int64, error)
+	// CreateRecoveryCode: Stores the hash of a recovery code
+	// Purpose: Let users sign in when they lost their authenticator
+	// Parameters:
+	//   $1: user_id - ID of the user
+	//   $2: code_hash - Hash of the recovery code, never the code itself
+	// Returns: None
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
 	// CreateRefreshToken: Creates a new refresh token
 	// Purpose: Generate a refresh token for user authentication
 	// Parameters:
 	//   $1: user_id - ID of the user this token belongs to
 	//   $2: token - The actual refresh token string
 	//   $3: expiration - Expiration timestamp of the token
+	//   $4: session_id - ID of the session the token belongs to
+	//   $5: merchant_id - Merchant the access tokens are issued for, or NULL
+	//   $6: scopes - Scopes granted to the access tokens
 	// Returns: The created refresh token record (excluding sensitive fields if any)
 	// Business Logic:
 	//   - Sets both created_at and updated_at to current timestamp
 	//   - Used in JWT refresh token rotation
 	//   - Typically created during login/auth flows
+	//   - merchant_id and scopes are copied to the next token on rotation
 	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (*RefreshToken, error)
 	CreateResetToken(ctx context.Context, arg CreateResetTokenParams) (*ResetToken, error)
 	// CreateRole: Inserts a new role into the system
@@ -82,6 +145,18 @@ type Querier interface {
 	//   - Sets creation and update timestamps automatically
 	//   - Used when issuing new cards
 	CreateSaldo(ctx context.Context, arg CreateSaldoParams) (*Saldo, error)
+	// CreateSession: Records a new login session
+	// Purpose: Track the device a user logged in from
+	// Parameters:
+	//   $1: session_id - Random ID of the session, carried as sid in access tokens
+	//   $2: user_id - ID of the user logging in
+	//   $3: user_agent - User-Agent header of the login request
+	//   $4: ip_address - Client IP of the login request
+	//   $5: expires_at - Expiration of the refresh token issued with the session
+	// Returns: The created session record
+	// Business Logic:
+	//   - Sets created_at and last_seen_at to the current timestamp
+	CreateSession(ctx context.Context, arg CreateSessionParams) (*Session, error)
 	// CreateTopup: Inserts a new topup transaction into the topups table
 	// Purpose: Used when a user performs a topup action
 	// Parameters:
@@ -134,6 +209,18 @@ type Querier interface {
 	// Business Logic:
 	//   - Inserts a new user record into the `users` table with the current timestamp for `created_at` and `updated_at`.
 	CreateUser(ctx context.Context, arg CreateUserParams) (*User, error)
+	// CreateUserTwoFactor: Stores a new TOTP secret for a user
+	// Purpose: Start two-factor enrollment
+	// Parameters:
+	//   $1: user_id - ID of the user enrolling
+	//   $2: secret - Base32 encoded TOTP secret
+	// Returns: The two-factor record of the user, or no row when the enrollment is confirmed
+	// Business Logic:
+	//   - Replaces the secret of an earlier enrollment that was never confirmed
+	//   - Resets last_used_step so the new secret must be confirmed
+	//   - Leaves a confirmed enrollment alone, so enabled two-factor authentication
+	//     cannot be reset without disabling it first
+	CreateUserTwoFactor(ctx context.Context, arg CreateUserTwoFactorParams) (*UserTwoFactor, error)
 	// CreateWithdraw: Records a new cash withdrawal
 	// Purpose: Create a withdrawal transaction in the system
 	// Parameters:
@@ -230,6 +317,18 @@ type Querier interface {
 	// Parameters:
 	//   $1: Role ID
 	DeletePermanentRole(ctx context.Context, roleID int32) error
+	// DeleteProcessedMessages: Removes old processed message records
+	// Purpose: Keep the processed_messages table small
+	// Parameters:
+	//   $1: processed_at - Records older than this time are deleted
+	// Returns: The number of deleted rows
+	DeleteProcessedMessages(ctx context.Context, processedAt time.Time) (int64, error)
+	// DeleteRecoveryCodes: Removes every recovery code of a user
+	// Purpose: Replace recovery codes or disable two-factor authentication
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: None
+	DeleteRecoveryCodes(ctx context.Context, userID int32) error
 	// DeleteRefreshToken: Permanently deletes a refresh token
 	// Purpose: Invalidate a specific refresh token
 	// Parameters:
@@ -258,6 +357,12 @@ type Querier interface {
 	//   - Only works on already trashed records
 	//   - Irreversible operation
 	DeleteSaldoPermanently(ctx context.Context, saldoID int32) error
+	// DeleteSentOutboxEvents: Removes published events
+	// Purpose: Keep the outbox table small
+	// Parameters:
+	//   $1: sent_at - Events published before this time are deleted
+	// Returns: The number of deleted rows
+	DeleteSentOutboxEvents(ctx context.Context, sentAt sql.NullTime) (int64, error)
 	// DeleteTopupPermanently: Permanently deletes a topup record from the database
 	// Purpose: Irrecoverably removes topup data
 	// Parameters:
@@ -293,6 +398,12 @@ type Querier interface {
 	//   - Deletes the user record from the `users` table permanently.
 	//   - Only deletes users who have been trashed (`deleted_at IS NOT NULL`).
 	DeleteUserPermanently(ctx context.Context, userID int32) error
+	// DeleteUserTwoFactor: Removes the two-factor record of a user
+	// Purpose: Disable two-factor authentication
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: None
+	DeleteUserTwoFactor(ctx context.Context, userID int32) error
 	// DeleteWithdrawPermanently: Hard-deletes a withdrawal
 	// Purpose: Permanently remove a withdrawal from the system
 	// Parameters:
@@ -303,6 +414,16 @@ type Querier interface {
 	//   - Irreversible operation
 	//   - Used after retention period expires
 	DeleteWithdrawPermanently(ctx context.Context, withdrawID int32) error
+	// ExpireMerchantApiKey: Shortens the lifetime of an API key
+	// Purpose: Keep a rotated key working during the overlap window
+	// Parameters:
+	//   $1: api_key_id - ID of the key
+	//   $2: merchant_id - ID of the merchant owning the key
+	//   $3: expires_at - New expiration of the key
+	// Returns: The number of updated rows, 0 when the key is unknown, revoked or expired
+	// Business Logic:
+	//   - Never extends a key that already expires before $3
+	ExpireMerchantApiKey(ctx context.Context, arg ExpireMerchantApiKeyParams) (int64, error)
 	// FindAllTransactions: Retrieves a paginated list of active transactions with optional search
 	// Purpose: Display transaction list with merchant info, filtered by card number or payment method
 	// Parameters:
@@ -418,6 +539,16 @@ type Querier interface {
 	//   - Used during token refresh operations
 	//   - Helps prevent token reuse
 	FindRefreshTokenByToken(ctx context.Context, token string) (*RefreshToken, error)
+	// FindRefreshTokenByTokenForUpdate: Retrieves a refresh token by token string and locks it
+	// Purpose: Validate a refresh token during rotation and detect reuse
+	// Parameters:
+	//   $1: token - The refresh token string to find
+	// Returns: The refresh token record, including revoked tokens
+	// Business Logic:
+	//   - Also returns revoked (deleted_at IS NOT NULL) tokens so reuse can be detected
+	//   - Locks the row until the end of the transaction
+	//   - Prevents two concurrent rotations of the same token
+	FindRefreshTokenByTokenForUpdate(ctx context.Context, token string) (*RefreshToken, error)
 	// FindRefreshTokenByUserId: Retrieves latest active refresh token for user
 	// Purpose: Get current valid refresh token for a user
 	// Parameters:
@@ -600,15 +731,47 @@ type Querier interface {
 	//   - Returns cards ordered by card_id
 	//   - Provides total_count for pagination calculations
 	GetCards(ctx context.Context, arg GetCardsParams) ([]*GetCardsRow, error)
+	// GetMerchantApiKey: Retrieves an API key of a merchant
+	// Purpose: Load the key being rotated
+	// Parameters:
+	//   $1: api_key_id - ID of the key
+	//   $2: merchant_id - ID of the merchant owning the key
+	// Returns: The key record, including revoked and expired keys
+	GetMerchantApiKey(ctx context.Context, arg GetMerchantApiKeyParams) (*MerchantApiKey, error)
+	// GetMerchantApiKeyByPrefix: Retrieves an API key by its public prefix
+	// Purpose: Authenticate a request carrying a merchant API key
+	// Parameters:
+	//   $1: prefix - Public prefix of the key
+	// Returns: The key record, including revoked and expired keys
+	GetMerchantApiKeyByPrefix(ctx context.Context, prefix string) (*MerchantApiKey, error)
+	// GetMerchantApiKeys: Lists the usable API keys of a merchant
+	// Purpose: Show merchants their keys
+	// Parameters:
+	//   $1: merchant_id - ID of the merchant
+	// Returns: The keys that are neither revoked nor expired, newest first
+	// Business Logic:
+	//   - Keys in a rotation overlap are listed until they expire
+	GetMerchantApiKeys(ctx context.Context, merchantID int32) ([]*MerchantApiKey, error)
 	// GetMerchantByApiKey: Retrieves a merchant by its API key
 	// Purpose: Authenticate or lookup a merchant using its API key
 	// Parameters:
-	//   $1: api_key - API key of the merchant
+	//   $1: api_key - Stored hash of the merchant API key (apikey.Key.Hash)
 	// Returns:
 	//   Complete merchant record
 	// Business Logic:
 	//   - Excludes soft-deleted merchants (deleted_at IS NULL)
 	GetMerchantByApiKey(ctx context.Context, apiKey string) (*Merchant, error)
+	// GetMerchantByApiKeyPrefix: Retrieves a merchant by the public prefix of its API key
+	// Purpose: Find the merchant of a signed request, which carries only the key prefix
+	// Parameters:
+	//   $1: prefix - Public prefix of the merchant API key (apikey.Key.Prefix)
+	// Returns:
+	//   Complete merchant record
+	// Business Logic:
+	//   - Excludes soft-deleted merchants (deleted_at IS NULL)
+	//   - Compares the part of the stored api_key hash before the first dot for equality,
+	//     which the unique index merchants_api_key_prefix_key serves
+	GetMerchantByApiKeyPrefix(ctx context.Context, prefix string) (*Merchant, error)
 	// GetMerchantByID: Retrieves a merchant by its unique ID
 	// Purpose: Fetch details of a single merchant if not soft-deleted
 	// Parameters:
@@ -1496,7 +1659,27 @@ type Querier interface {
 	//   - Orders chronologically
 	//   - Useful for individual spending pattern analysis
 	GetMonthlyWithdrawsByCardNumber(ctx context.Context, arg GetMonthlyWithdrawsByCardNumberParams) ([]*GetMonthlyWithdrawsByCardNumberRow, error)
+	// GetPendingOutboxEvents: Locks the next events to publish
+	// Purpose: Let the relay claim a batch of unsent events
+	// Parameters:
+	//   $1: limit - Maximum number of events to claim
+	// Returns: Unsent events whose retry time has come, oldest first
+	// Business Logic:
+	//   - Rows stay locked until the surrounding transaction ends
+	//   - Rows locked by another relay are skipped, so several relays can run at once
+	//   - Events are left out while an earlier unsent event with the same topic and
+	//     key is waiting for a retry or locked by another relay, so they are
+	//     published in order
+	GetPendingOutboxEvents(ctx context.Context, limit int32) ([]*OutboxEvent, error)
 	GetResetToken(ctx context.Context, token string) (*ResetToken, error)
+	// GetResetTokenByUserID: Retrieves and locks the pending reset token of a user
+	// Purpose: Check a reset code entered together with the email address
+	// Parameters:
+	//   $1: user_id - ID of the user resetting the password
+	// Returns: The reset token record, with the hash of the code in token
+	// Business Logic:
+	//   - Locks the row until the transaction ends so concurrent attempts are counted one by one
+	GetResetTokenByUserID(ctx context.Context, userID int64) (*ResetToken, error)
 	// GetRole: Retrieves role details by role_id
 	// Purpose: Fetch a single role record (regardless of deleted status)
 	// Parameters:
@@ -1558,6 +1741,12 @@ type Querier interface {
 	//   - Returns saldos ordered by saldo_id
 	//   - Provides total_count for pagination calculations
 	GetSaldos(ctx context.Context, arg GetSaldosParams) ([]*GetSaldosRow, error)
+	// GetSession: Retrieves a session by ID
+	// Purpose: Check a session during token refresh
+	// Parameters:
+	//   $1: session_id - ID of the session
+	// Returns: The session record, including revoked sessions
+	GetSession(ctx context.Context, sessionID string) (*Session, error)
 	// GetTopupByID: Retrieves a specific topup by ID
 	// Purpose: Used to display details of a single topup transaction
 	// Parameters:
@@ -2050,6 +2239,12 @@ type Querier interface {
 	//   - Maintains newest-first ordering
 	//   - Used in admin interfaces for withdrawal recovery
 	GetTrashedWithdraws(ctx context.Context, arg GetTrashedWithdrawsParams) ([]*GetTrashedWithdrawsRow, error)
+	// GetUnusedRecoveryCodes: Retrieves the recovery codes of a user that were not used yet
+	// Purpose: Verify a recovery code entered at login
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: All unused recovery code records of the user
+	GetUnusedRecoveryCodes(ctx context.Context, userID int32) ([]*UserRecoveryCode, error)
 	// GetUserByEmail: Retrieve a user by their email
 	// Purpose: Fetch a specific user based on their email.
 	// Parameters:
@@ -2096,6 +2291,20 @@ type Querier interface {
 	// Returns:
 	//   List of roles (id, name, timestamps)
 	GetUserRoles(ctx context.Context, userID int32) ([]*Role, error)
+	// GetUserSessions: Lists the active sessions of a user
+	// Purpose: Show users the devices they are logged in on
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: The active sessions, most recently used first
+	// Business Logic:
+	//   - Excludes revoked and expired sessions
+	GetUserSessions(ctx context.Context, userID int32) ([]*Session, error)
+	// GetUserTwoFactor: Retrieves the two-factor record of a user
+	// Purpose: Check whether a user has two-factor authentication and verify codes
+	// Parameters:
+	//   $1: user_id - ID of the user
+	// Returns: The two-factor record of the user
+	GetUserTwoFactor(ctx context.Context, userID int32) (*UserTwoFactor, error)
 	// GetUsersWithPagination: Search Users with Pagination and Total Count
 	// Purpose: Retrieve users with pagination and total count of users matching the search criteria
 	// Parameters:
@@ -2912,6 +3121,41 @@ type Querier interface {
 	//   - Orders chronologically
 	//   - Useful for customer spending habit analysis
 	GetYearlyWithdrawsByCardNumber(ctx context.Context, arg GetYearlyWithdrawsByCardNumberParams) ([]*GetYearlyWithdrawsByCardNumberRow, error)
+	// HashLegacyMerchantApiKeys: Replaces plain legacy API keys with their hash
+	// Purpose: Migrate keys created by apikey.GenerateApiKey, which were stored in plain text
+	// Returns: The number of migrated merchants
+	// Business Logic:
+	//   - Only touches api_key values of 64 hex characters, so it can run repeatedly
+	//   - Stores 'lk_' followed by the SHA-256 of the lower-cased key (apikey.HashKey)
+	//   - Sets updated_at to the current timestamp
+	HashLegacyMerchantApiKeys(ctx context.Context) (int64, error)
+	// IncrementResetTokenAttempts: Records a wrong reset code
+	// Purpose: Enforce the attempt limit of a reset token
+	// Parameters:
+	//   $1: id - ID of the reset token
+	// Returns: The number of failed attempts so far
+	IncrementResetTokenAttempts(ctx context.Context, id int32) (int32, error)
+	// IsMessageProcessed: Checks whether a consumer group already handled a message
+	// Purpose: Skip Kafka messages that are redelivered, e.g. after a rebalance
+	// Parameters:
+	//   $1: consumer_group - Kafka consumer group
+	//   $2: message_key - Idempotency key of the message
+	// Returns: true when the message was processed
+	IsMessageProcessed(ctx context.Context, arg IsMessageProcessedParams) (bool, error)
+	// MarkOutboxEventFailed: Records a failed publish attempt
+	// Purpose: Retry the event later with backoff
+	// Parameters:
+	//   $1: outbox_id - ID of the event
+	//   $2: last_error - Error returned by Kafka
+	//   $3: available_at - Time of the next attempt
+	// Business Logic:
+	//   - Increments attempts
+	MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error
+	// MarkOutboxEventSent: Marks an event as published
+	// Purpose: Keep the relay from publishing the event again
+	// Parameters:
+	//   $1: outbox_id - ID of the event
+	MarkOutboxEventSent(ctx context.Context, outboxID int64) error
 	// RemoveRoleFromUser: Permanently removes a role from a user
 	// Purpose: Hard delete of a user-role mapping (bypasses trash)
 	// Parameters:
@@ -3059,6 +3303,53 @@ type Querier interface {
 	//   - Only works on currently trashed withdrawals
 	//   - Used for data recovery purposes
 	RestoreWithdraw(ctx context.Context, withdrawID int32) (*Withdraw, error)
+	// RevokeLegacyMerchantApiKey: Disables the API key stored in merchants.api_key
+	// Purpose: Retire a legacy key once the merchant switched to keys in merchant_api_keys
+	// Parameters:
+	//   $1: merchant_id - ID of the merchant
+	// Returns: The number of updated rows, 0 when the merchant is unknown or its key is already revoked
+	// Business Logic:
+	//   - Prepends 'revoked:' to the stored hash, which no key hashes to, so the value stays unique
+	//   - Sets updated_at to the current timestamp
+	RevokeLegacyMerchantApiKey(ctx context.Context, merchantID int32) (int64, error)
+	// RevokeMerchantApiKey: Revokes an API key immediately
+	// Purpose: Disable a leaked or unused key
+	// Parameters:
+	//   $1: api_key_id - ID of the key
+	//   $2: merchant_id - ID of the merchant owning the key
+	// Returns: The number of updated rows, 0 when the key is unknown or already revoked
+	RevokeMerchantApiKey(ctx context.Context, arg RevokeMerchantApiKeyParams) (int64, error)
+	// RevokeRefreshToken: Marks a refresh token as revoked
+	// Purpose: Retire a refresh token after it has been rotated or logged out
+	// Parameters:
+	//   $1: token - The token string to revoke
+	// Business Logic:
+	//   - Soft deletes the token by setting deleted_at
+	//   - Keeps the row so later reuse of the token can be detected
+	//   - Only affects active tokens
+	RevokeRefreshToken(ctx context.Context, token string) error
+	// RevokeSession: Ends a session of a user
+	// Purpose: Remote logout of one device
+	// Parameters:
+	//   $1: session_id - ID of the session
+	//   $2: user_id - ID of the user owning the session
+	// Returns: The number of updated rows, 0 when the session is unknown, owned by someone else or already revoked
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	// RevokeSessionRefreshTokens: Revokes the refresh tokens of a session
+	// Purpose: End a session so it can no longer be refreshed
+	// Parameters:
+	//   $1: session_id - ID of the session
+	// Business Logic:
+	//   - Soft deletes the tokens so later reuse is still detected
+	//   - Only affects active tokens
+	RevokeSessionRefreshTokens(ctx context.Context, sessionID sql.NullString) error
+	// RevokeUserSessions: Ends every session of a user except one
+	// Purpose: Logout from all devices
+	// Parameters:
+	//   $1: user_id - ID of the user
+	//   $2: session_id - Session to keep, or an empty string to end all of them
+	// Returns: The IDs of the revoked sessions
+	RevokeUserSessions(ctx context.Context, arg RevokeUserSessionsParams) ([]string, error)
 	// SearchUsersByEmail: Search users by email with case-insensitive matching
 	// Purpose: Allows searching for users whose email matches a given search term (case-insensitive).
 	// Parameters:
@@ -3070,6 +3361,18 @@ type Querier interface {
 	//   - Uses `ILIKE` to perform a case-insensitive search on the `email` column.
 	//   - Only returns active users (`deleted_at IS NULL`).
 	SearchUsersByEmail(ctx context.Context, dollar_1 sql.NullString) ([]*User, error)
+	// TouchMerchantApiKey: Records the use of an API key
+	// Purpose: Let merchants see which keys are still in use before revoking them
+	// Parameters:
+	//   $1: api_key_id - ID of the key
+	TouchMerchantApiKey(ctx context.Context, apiKeyID int32) error
+	// TouchSession: Records activity on a session
+	// Purpose: Keep last_seen_at and the expiry current when tokens are refreshed
+	// Parameters:
+	//   $1: session_id - ID of the session
+	//   $2: expires_at - Expiration of the newly issued refresh token
+	// Returns: The number of updated rows, 0 when the session was revoked
+	TouchSession(ctx context.Context, arg TouchSessionParams) (int64, error)
 	// TrashCard: Soft-deletes a card by marking deleted_at
 	// Purpose: Temporarily remove a card without deleting it permanently
 	// Parameters:
@@ -3350,6 +3653,27 @@ type Querier interface {
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error)
 	UpdateUserIsVerified(ctx context.Context, arg UpdateUserIsVerifiedParams) (*User, error)
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (*User, error)
+	// UpdateUserTwoFactorStep: Records the time step of an accepted TOTP code
+	// Purpose: Prevent a TOTP code from being used twice
+	// Parameters:
+	//   $1: user_id - ID of the user
+	//   $2: last_used_step - Time step of the accepted code
+	// Returns: Number of updated rows, 0 if the step was already used
+	// Business Logic:
+	//   - Only moves last_used_step forward, so a code can never be replayed
+	//     even by concurrent logins
+	UpdateUserTwoFactorStep(ctx context.Context, arg UpdateUserTwoFactorStepParams) (int64, error)
+	// UpdateUserVerificationCode: Replaces the verification code of a user
+	// Purpose: Issue a new email verification code
+	// Parameters:
+	//   $1: user_id - ID of the user
+	//   $2: verification_code - SHA-256 hash of the code sent by email
+	//   $3: verification_expires_at - Time after which the code is rejected
+	// Returns: None
+	// Business Logic:
+	//   - Only the hash is stored, so a leaked row cannot be used to verify the account
+	//   - Replaces any earlier code of the user
+	UpdateUserVerificationCode(ctx context.Context, arg UpdateUserVerificationCodeParams) error
 	// UpdateWithdraw: Modifies withdrawal details
 	// Purpose: Update withdrawal information
 	// Parameters:
@@ -3374,6 +3698,22 @@ type Querier interface {
 	//   - Used to reflect withdrawal processing outcomes
 	//   - Important for reconciliation purposes
 	UpdateWithdrawStatus(ctx context.Context, arg UpdateWithdrawStatusParams) (*Withdraw, error)
+	// UseRecoveryCode: Marks a recovery code as used
+	// Purpose: Make recovery codes one-time
+	// Parameters:
+	//   $1: recovery_code_id - ID of the recovery code
+	// Returns: Number of updated rows, 0 if the code was already used
+	UseRecoveryCode(ctx context.Context, recoveryCodeID int32) (int64, error)
+	// VerifyUserByCode: Marks the user owning a verification code as verified
+	// Purpose: Consume an email verification code
+	// Parameters:
+	//   $1: verification_code - SHA-256 hash of the code from the email
+	//   $2: verification_expires_at - The current time
+	// Returns: The verified user record
+	// Business Logic:
+	//   - Clears the code in the same statement so it can only be used once
+	//   - Ignores empty and expired codes, codes without an expiry and deleted users
+	VerifyUserByCode(ctx context.Context, arg VerifyUserByCodeParams) (*User, error)
 }
 
 var _ Querier = (*Queries)(nil)
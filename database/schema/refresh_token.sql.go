@@ -7,19 +7,25 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (user_id, token, expiration, created_at, updated_at)
-VALUES ($1, $2, $3, current_timestamp, current_timestamp)
-RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at
+INSERT INTO refresh_tokens (user_id, token, expiration, session_id, merchant_id, scopes, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, current_timestamp, current_timestamp)
+RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
-	UserID     int32     `json:"user_id"`
-	Token      string    `json:"token"`
-	Expiration time.Time `json:"expiration"`
+	UserID     int32          `json:"user_id"`
+	Token      string         `json:"token"`
+	Expiration time.Time      `json:"expiration"`
+	SessionID  sql.NullString `json:"session_id"`
+	MerchantID sql.NullInt32  `json:"merchant_id"`
+	Scopes     []string       `json:"scopes"`
 }
 
 // CreateRefreshToken: Creates a new refresh token
@@ -29,14 +35,25 @@ type CreateRefreshTokenParams struct {
 //	$1: user_id - ID of the user this token belongs to
 //	$2: token - The actual refresh token string
 //	$3: expiration - Expiration timestamp of the token
+//	$4: session_id - ID of the session the token belongs to
+//	$5: merchant_id - Merchant the access tokens are issued for, or NULL
+//	$6: scopes - Scopes granted to the access tokens
 //
 // Returns: The created refresh token record (excluding sensitive fields if any)
 // Business Logic:
 //   - Sets both created_at and updated_at to current timestamp
 //   - Used in JWT refresh token rotation
 //   - Typically created during login/auth flows
+//   - merchant_id and scopes are copied to the next token on rotation
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (*RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.UserID, arg.Token, arg.Expiration)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.UserID,
+		arg.Token,
+		arg.Expiration,
+		arg.SessionID,
+		arg.MerchantID,
+		pq.Array(arg.Scopes),
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.RefreshTokenID,
@@ -46,6 +63,9 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.SessionID,
+		&i.MerchantID,
+		pq.Array(&i.Scopes),
 	)
 	return &i, err
 }
@@ -91,7 +111,7 @@ func (q *Queries) DeleteRefreshTokenByUserId(ctx context.Context, userID int32)
 }
 
 const findRefreshTokenByToken = `-- name: FindRefreshTokenByToken :one
-SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at
+SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
 FROM refresh_tokens
 WHERE token = $1 AND deleted_at IS NULL
 `
@@ -118,6 +138,45 @@ func (q *Queries) FindRefreshTokenByToken(ctx context.Context, token string) (*R
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.SessionID,
+		&i.MerchantID,
+		pq.Array(&i.Scopes),
+	)
+	return &i, err
+}
+
+const findRefreshTokenByTokenForUpdate = `-- name: FindRefreshTokenByTokenForUpdate :one
+SELECT refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
+FROM refresh_tokens
+WHERE token = $1
+FOR UPDATE
+`
+
+// FindRefreshTokenByTokenForUpdate: Retrieves a refresh token by token string and locks it
+// Purpose: Validate a refresh token during rotation and detect reuse
+// Parameters:
+//
+//	$1: token - The refresh token string to find
+//
+// Returns: The refresh token record, including revoked tokens
+// Business Logic:
+//   - Also returns revoked (deleted_at IS NOT NULL) tokens so reuse can be detected
+//   - Locks the row until the end of the transaction
+//   - Prevents two concurrent rotations of the same token
+func (q *Queries) FindRefreshTokenByTokenForUpdate(ctx context.Context, token string) (*RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, findRefreshTokenByTokenForUpdate, token)
+	var i RefreshToken
+	err := row.Scan(
+		&i.RefreshTokenID,
+		&i.UserID,
+		&i.Token,
+		&i.Expiration,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.SessionID,
+		&i.MerchantID,
+		pq.Array(&i.Scopes),
 	)
 	return &i, err
 }
@@ -130,7 +189,10 @@ SELECT
     expiration,
     created_at,
     updated_at,
-    deleted_at
+    deleted_at,
+    session_id,
+    merchant_id,
+    scopes
 FROM
     refresh_tokens
 WHERE
@@ -163,15 +225,59 @@ func (q *Queries) FindRefreshTokenByUserId(ctx context.Context, userID int32) (*
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.SessionID,
+		&i.MerchantID,
+		pq.Array(&i.Scopes),
 	)
 	return &i, err
 }
 
+const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET deleted_at = current_timestamp, updated_at = current_timestamp
+WHERE token = $1 AND deleted_at IS NULL
+`
+
+// RevokeRefreshToken: Marks a refresh token as revoked
+// Purpose: Retire a refresh token after it has been rotated or logged out
+// Parameters:
+//
+//	$1: token - The token string to revoke
+//
+// Business Logic:
+//   - Soft deletes the token by setting deleted_at
+//   - Keeps the row so later reuse of the token can be detected
+//   - Only affects active tokens
+func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+	return err
+}
+
+const revokeSessionRefreshTokens = `-- name: RevokeSessionRefreshTokens :exec
+UPDATE refresh_tokens
+SET deleted_at = current_timestamp, updated_at = current_timestamp
+WHERE session_id = $1 AND deleted_at IS NULL
+`
+
+// RevokeSessionRefreshTokens: Revokes the refresh tokens of a session
+// Purpose: End a session so it can no longer be refreshed
+// Parameters:
+//
+//	$1: session_id - ID of the session
+//
+// Business Logic:
+//   - Soft deletes the tokens so later reuse is still detected
+//   - Only affects active tokens
+func (q *Queries) RevokeSessionRefreshTokens(ctx context.Context, sessionID sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, revokeSessionRefreshTokens, sessionID)
+	return err
+}
+
 const updateRefreshTokenByUserId = `-- name: UpdateRefreshTokenByUserId :one
 UPDATE refresh_tokens
 SET token = $2, expiration = $3, updated_at = current_timestamp
 WHERE user_id = $1 AND deleted_at IS NULL
-RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at
+RETURNING refresh_token_id, user_id, token, expiration, created_at, updated_at, deleted_at, session_id, merchant_id, scopes
 `
 
 type UpdateRefreshTokenByUserIdParams struct {
@@ -204,6 +310,9 @@ func (q *Queries) UpdateRefreshTokenByUserId(ctx context.Context, arg UpdateRefr
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.SessionID,
+		&i.MerchantID,
+		pq.Array(&i.Scopes),
 	)
 	return &i, err
 }
@@ -10,10 +10,30 @@ import (
 	"time"
 )
 
+const consumeResetToken = `-- name: ConsumeResetToken :execrows
+DELETE FROM reset_tokens
+WHERE id = $1
+`
+
+// ConsumeResetToken: Deletes a reset token once it was used
+// Purpose: Make reset tokens single use
+// Parameters:
+//
+//	$1: id - ID of the reset token
+//
+// Returns: The number of deleted rows, 0 when the token was already consumed
+func (q *Queries) ConsumeResetToken(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, consumeResetToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createResetToken = `-- name: CreateResetToken :one
 INSERT INTO reset_tokens (user_id, token, expiry_date)
 VALUES ($1, $2, $3)
-RETURNING id, user_id, token, expiry_date
+RETURNING id, user_id, token, expiry_date, attempts
 `
 
 type CreateResetTokenParams struct {
@@ -30,6 +50,7 @@ func (q *Queries) CreateResetToken(ctx context.Context, arg CreateResetTokenPara
 		&i.UserID,
 		&i.Token,
 		&i.ExpiryDate,
+		&i.Attempts,
 	)
 	return &i, err
 }
@@ -45,7 +66,7 @@ func (q *Queries) DeleteResetToken(ctx context.Context, userID int64) error {
 }
 
 const getResetToken = `-- name: GetResetToken :one
-SELECT id, user_id, token, expiry_date FROM reset_tokens
+SELECT id, user_id, token, expiry_date, attempts FROM reset_tokens
 WHERE token = $1
 `
 
@@ -57,6 +78,56 @@ func (q *Queries) GetResetToken(ctx context.Context, token string) (*ResetToken,
 		&i.UserID,
 		&i.Token,
 		&i.ExpiryDate,
+		&i.Attempts,
+	)
+	return &i, err
+}
+
+const getResetTokenByUserID = `-- name: GetResetTokenByUserID :one
+SELECT id, user_id, token, expiry_date, attempts FROM reset_tokens
+WHERE user_id = $1
+FOR UPDATE
+`
+
+// GetResetTokenByUserID: Retrieves and locks the pending reset token of a user
+// Purpose: Check a reset code entered together with the email address
+// Parameters:
+//
+//	$1: user_id - ID of the user resetting the password
+//
+// Returns: The reset token record, with the hash of the code in token
+// Business Logic:
+//   - Locks the row until the transaction ends so concurrent attempts are counted one by one
+func (q *Queries) GetResetTokenByUserID(ctx context.Context, userID int64) (*ResetToken, error) {
+	row := q.db.QueryRowContext(ctx, getResetTokenByUserID, userID)
+	var i ResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.ExpiryDate,
+		&i.Attempts,
 	)
 	return &i, err
 }
+
+const incrementResetTokenAttempts = `-- name: IncrementResetTokenAttempts :one
+UPDATE reset_tokens
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts
+`
+
+// IncrementResetTokenAttempts: Records a wrong reset code
+// Purpose: Enforce the attempt limit of a reset token
+// Parameters:
+//
+//	$1: id - ID of the reset token
+//
+// Returns: The number of failed attempts so far
+func (q *Queries) IncrementResetTokenAttempts(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementResetTokenAttempts, id)
+	var attempts int32
+	err := row.Scan(&attempts)
+	return attempts, err
+}
@@ -31,7 +31,7 @@ VALUES (
         $6,
         current_timestamp,
         current_timestamp
-    ) RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    ) RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 type CreateUserParams struct {
@@ -78,6 +78,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
@@ -117,7 +118,7 @@ func (q *Queries) DeleteUserPermanently(ctx context.Context, userID int32) error
 
 const getActiveUsersWithPagination = `-- name: GetActiveUsersWithPagination :many
 SELECT
-    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at,
+    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at,
     COUNT(*) OVER() AS total_count
 FROM users
 WHERE deleted_at IS NULL
@@ -133,17 +134,18 @@ type GetActiveUsersWithPaginationParams struct {
 }
 
 type GetActiveUsersWithPaginationRow struct {
-	UserID           int32        `json:"user_id"`
-	Firstname        string       `json:"firstname"`
-	Lastname         string       `json:"lastname"`
-	Email            string       `json:"email"`
-	Password         string       `json:"password"`
-	VerificationCode string       `json:"verification_code"`
-	IsVerified       sql.NullBool `json:"is_verified"`
-	CreatedAt        sql.NullTime `json:"created_at"`
-	UpdatedAt        sql.NullTime `json:"updated_at"`
-	DeletedAt        sql.NullTime `json:"deleted_at"`
-	TotalCount       int64        `json:"total_count"`
+	UserID                int32        `json:"user_id"`
+	Firstname             string       `json:"firstname"`
+	Lastname              string       `json:"lastname"`
+	Email                 string       `json:"email"`
+	Password              string       `json:"password"`
+	VerificationCode      string       `json:"verification_code"`
+	IsVerified            sql.NullBool `json:"is_verified"`
+	CreatedAt             sql.NullTime `json:"created_at"`
+	UpdatedAt             sql.NullTime `json:"updated_at"`
+	DeletedAt             sql.NullTime `json:"deleted_at"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+	TotalCount            int64        `json:"total_count"`
 }
 
 // GetActiveUsersWithPagination: Get Active Users with Pagination and Total Count
@@ -183,6 +185,7 @@ func (q *Queries) GetActiveUsersWithPagination(ctx context.Context, arg GetActiv
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.VerificationExpiresAt,
 			&i.TotalCount,
 		); err != nil {
 			return nil, err
@@ -199,7 +202,7 @@ func (q *Queries) GetActiveUsersWithPagination(ctx context.Context, arg GetActiv
 }
 
 const getTrashedUserByID = `-- name: GetTrashedUserByID :one
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 FROM users
 WHERE
     user_id = $1
@@ -232,13 +235,14 @@ func (q *Queries) GetTrashedUserByID(ctx context.Context, userID int32) (*User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const getTrashedUsersWithPagination = `-- name: GetTrashedUsersWithPagination :many
 SELECT
-    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at,
+    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at,
     COUNT(*) OVER() AS total_count
 FROM users
 WHERE deleted_at IS NOT NULL
@@ -254,17 +258,18 @@ type GetTrashedUsersWithPaginationParams struct {
 }
 
 type GetTrashedUsersWithPaginationRow struct {
-	UserID           int32        `json:"user_id"`
-	Firstname        string       `json:"firstname"`
-	Lastname         string       `json:"lastname"`
-	Email            string       `json:"email"`
-	Password         string       `json:"password"`
-	VerificationCode string       `json:"verification_code"`
-	IsVerified       sql.NullBool `json:"is_verified"`
-	CreatedAt        sql.NullTime `json:"created_at"`
-	UpdatedAt        sql.NullTime `json:"updated_at"`
-	DeletedAt        sql.NullTime `json:"deleted_at"`
-	TotalCount       int64        `json:"total_count"`
+	UserID                int32        `json:"user_id"`
+	Firstname             string       `json:"firstname"`
+	Lastname              string       `json:"lastname"`
+	Email                 string       `json:"email"`
+	Password              string       `json:"password"`
+	VerificationCode      string       `json:"verification_code"`
+	IsVerified            sql.NullBool `json:"is_verified"`
+	CreatedAt             sql.NullTime `json:"created_at"`
+	UpdatedAt             sql.NullTime `json:"updated_at"`
+	DeletedAt             sql.NullTime `json:"deleted_at"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+	TotalCount            int64        `json:"total_count"`
 }
 
 // GetTrashedUsersWithPagination: Get Trashed Users with Pagination and Total Count
@@ -304,6 +309,7 @@ func (q *Queries) GetTrashedUsersWithPagination(ctx context.Context, arg GetTras
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.VerificationExpiresAt,
 			&i.TotalCount,
 		); err != nil {
 			return nil, err
@@ -320,7 +326,7 @@ func (q *Queries) GetTrashedUsersWithPagination(ctx context.Context, arg GetTras
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at FROM users WHERE email = $1 AND deleted_at IS NULL
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at FROM users WHERE email = $1 AND deleted_at IS NULL
 `
 
 // GetUserByEmail: Retrieve a user by their email
@@ -349,12 +355,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, erro
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const getUserByEmailAndVerified = `-- name: GetUserByEmailAndVerified :one
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 FROM users
 WHERE email = $1
   AND is_verified = true
@@ -387,12 +394,13 @@ func (q *Queries) GetUserByEmailAndVerified(ctx context.Context, email string) (
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at FROM users WHERE user_id = $1 AND deleted_at IS NULL
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at FROM users WHERE user_id = $1 AND deleted_at IS NULL
 `
 
 // GetUserByID: Retrieve a user by their ID
@@ -421,12 +429,13 @@ func (q *Queries) GetUserByID(ctx context.Context, userID int32) (*User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const getUserByVerificationCode = `-- name: GetUserByVerificationCode :one
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at FROM users WHERE verification_code = $1
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at FROM users WHERE verification_code = $1
 `
 
 // Purpose: Fetch a user based on their verification code.
@@ -453,13 +462,14 @@ func (q *Queries) GetUserByVerificationCode(ctx context.Context, verificationCod
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const getUsersWithPagination = `-- name: GetUsersWithPagination :many
 SELECT
-    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at,
+    user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at,
     COUNT(*) OVER() AS total_count
 FROM users
 WHERE deleted_at IS NULL
@@ -475,17 +485,18 @@ type GetUsersWithPaginationParams struct {
 }
 
 type GetUsersWithPaginationRow struct {
-	UserID           int32        `json:"user_id"`
-	Firstname        string       `json:"firstname"`
-	Lastname         string       `json:"lastname"`
-	Email            string       `json:"email"`
-	Password         string       `json:"password"`
-	VerificationCode string       `json:"verification_code"`
-	IsVerified       sql.NullBool `json:"is_verified"`
-	CreatedAt        sql.NullTime `json:"created_at"`
-	UpdatedAt        sql.NullTime `json:"updated_at"`
-	DeletedAt        sql.NullTime `json:"deleted_at"`
-	TotalCount       int64        `json:"total_count"`
+	UserID                int32        `json:"user_id"`
+	Firstname             string       `json:"firstname"`
+	Lastname              string       `json:"lastname"`
+	Email                 string       `json:"email"`
+	Password              string       `json:"password"`
+	VerificationCode      string       `json:"verification_code"`
+	IsVerified            sql.NullBool `json:"is_verified"`
+	CreatedAt             sql.NullTime `json:"created_at"`
+	UpdatedAt             sql.NullTime `json:"updated_at"`
+	DeletedAt             sql.NullTime `json:"deleted_at"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+	TotalCount            int64        `json:"total_count"`
 }
 
 // GetUsersWithPagination: Search Users with Pagination and Total Count
@@ -524,6 +535,7 @@ func (q *Queries) GetUsersWithPagination(ctx context.Context, arg GetUsersWithPa
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.VerificationExpiresAt,
 			&i.TotalCount,
 		); err != nil {
 			return nil, err
@@ -563,7 +575,7 @@ SET
 WHERE
     user_id = $1
     AND deleted_at IS NOT NULL
-    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 // RestoreUser: Recovers a soft-deleted user
@@ -592,12 +604,13 @@ func (q *Queries) RestoreUser(ctx context.Context, userID int32) (*User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
 
 const searchUsersByEmail = `-- name: SearchUsersByEmail :many
-SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+SELECT user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 FROM users
 WHERE
     deleted_at IS NULL
@@ -638,6 +651,7 @@ func (q *Queries) SearchUsersByEmail(ctx context.Context, dollar_1 sql.NullStrin
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.VerificationExpiresAt,
 		); err != nil {
 			return nil, err
 		}
@@ -659,7 +673,7 @@ SET
 WHERE
     user_id = $1
     AND deleted_at IS NULL
-    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 // TrashUser: Soft-deletes a user account
@@ -688,6 +702,7 @@ func (q *Queries) TrashUser(ctx context.Context, userID int32) (*User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
@@ -703,7 +718,7 @@ SET
 WHERE
     user_id = $1
     AND deleted_at IS NULL
-    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 type UpdateUserParams struct {
@@ -750,6 +765,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
@@ -762,7 +778,7 @@ SET
 WHERE
     user_id = $1
     AND deleted_at IS NULL
-    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 type UpdateUserIsVerifiedParams struct {
@@ -784,6 +800,7 @@ func (q *Queries) UpdateUserIsVerified(ctx context.Context, arg UpdateUserIsVeri
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
@@ -796,7 +813,7 @@ SET
 WHERE
     user_id = $1
     AND deleted_at IS NULL
-    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
 `
 
 type UpdateUserPasswordParams struct {
@@ -818,6 +835,91 @@ func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPassword
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.VerificationExpiresAt,
+	)
+	return &i, err
+}
+
+const updateUserVerificationCode = `-- name: UpdateUserVerificationCode :exec
+UPDATE users
+SET
+    verification_code = $2,
+    verification_expires_at = $3,
+    updated_at = current_timestamp
+WHERE
+    user_id = $1
+    AND deleted_at IS NULL
+`
+
+type UpdateUserVerificationCodeParams struct {
+	UserID                int32        `json:"user_id"`
+	VerificationCode      string       `json:"verification_code"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+}
+
+// UpdateUserVerificationCode: Replaces the verification code of a user
+// Purpose: Issue a new email verification code
+// Parameters:
+//
+//	$1: user_id - ID of the user
+//	$2: verification_code - SHA-256 hash of the code sent by email
+//	$3: verification_expires_at - Time after which the code is rejected
+//
+// Returns: None
+// Business Logic:
+//   - Only the hash is stored, so a leaked row cannot be used to verify the account
+//   - Replaces any earlier code of the user
+func (q *Queries) UpdateUserVerificationCode(ctx context.Context, arg UpdateUserVerificationCodeParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserVerificationCode, arg.UserID, arg.VerificationCode, arg.VerificationExpiresAt)
+	return err
+}
+
+const verifyUserByCode = `-- name: VerifyUserByCode :one
+UPDATE users
+SET
+    is_verified = true,
+    verification_code = '',
+    verification_expires_at = NULL,
+    updated_at = current_timestamp
+WHERE
+    verification_code = $1
+    AND verification_code <> ''
+    AND verification_expires_at > $2
+    AND deleted_at IS NULL
+    RETURNING user_id, firstname, lastname, email, password, verification_code, is_verified, created_at, updated_at, deleted_at, verification_expires_at
+`
+
+type VerifyUserByCodeParams struct {
+	VerificationCode      string       `json:"verification_code"`
+	VerificationExpiresAt sql.NullTime `json:"verification_expires_at"`
+}
+
+// VerifyUserByCode: Marks the user owning a verification code as verified
+// Purpose: Consume an email verification code
+// Parameters:
+//
+//	$1: verification_code - SHA-256 hash of the code from the email
+//	$2: verification_expires_at - The current time
+//
+// Returns: The verified user record
+// Business Logic:
+//   - Clears the code in the same statement so it can only be used once
+//   - Ignores empty and expired codes, codes without an expiry and deleted users
+func (q *Queries) VerifyUserByCode(ctx context.Context, arg VerifyUserByCodeParams) (*User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserByCode, arg.VerificationCode, arg.VerificationExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.Firstname,
+		&i.Lastname,
+		&i.Email,
+		&i.Password,
+		&i.VerificationCode,
+		&i.IsVerified,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.VerificationExpiresAt,
 	)
 	return &i, err
 }
@@ -41,7 +41,7 @@ func NewMerchantSeeder(db *db.Queries, ctx context.Context, logger logger.Logger
 // trashed. The active merchants have a status of "active", while the trashed merchants
 // have a status of "deactive". The merchant names are generated randomly from the
 // combination of the adjectives and nouns provided. The API key is generated using
-// the GenerateApiKey function from the api-key package.
+// the GenerateKey function from the api-key package and only its hash is stored.
 func (r *merchantSeeder) Seed() error {
 	adjectives := []string{"Blue", "Green", "Red", "Yellow", "Fast"}
 	nouns := []string{"Shop", "Store", "Mart", "Market", "Hub"}
@@ -55,15 +55,7 @@ func (r *merchantSeeder) Seed() error {
 		noun := nouns[i%len(nouns)]
 		merchantName := fmt.Sprintf("%s %s", adjective, noun)
 
-		apiKey, _ := apikey.GenerateApiKey()
-
-		req := db.CreateMerchantParams{
-			Name:   merchantName,
-			UserID: int32((i % 5) + 1),
-			ApiKey: apiKey,
-		}
-
-		merchant, err := r.db.CreateMerchant(r.ctx, req)
+		merchant, err := r.createMerchant(merchantName, int32((i%5)+1))
 		if err != nil {
 			r.logger.Error("failed to seed merchant", zap.Int("merchant", i+1), zap.Error(err))
 			return fmt.Errorf("failed to seed merchant %d: %w", i+1, err)
@@ -101,3 +93,24 @@ func (r *merchantSeeder) Seed() error {
 
 	return nil
 }
+
+// createMerchant creates a merchant with a new API key, generating the key again
+// when its prefix is already taken.
+func (r *merchantSeeder) createMerchant(name string, userID int32) (*db.Merchant, error) {
+	for attempt := 1; ; attempt++ {
+		apiKey, err := apikey.GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate api key: %w", err)
+		}
+
+		merchant, err := r.db.CreateMerchant(r.ctx, db.CreateMerchantParams{
+			Name:   name,
+			UserID: userID,
+			ApiKey: apiKey.Hash(),
+		})
+		if apikey.IsPrefixTaken(err) && attempt < 3 {
+			continue
+		}
+		return merchant, err
+	}
+}
@@ -2,8 +2,8 @@ package email
 
 import (
 	"bytes"
+	"html/template"
 	"log"
-	"text/template"
 )
 
 // GenerateEmailHTML takes a map of key-value pairs and generates an HTML
@@ -16,7 +16,8 @@ import (
 //   - Button: The text for the call-to-action button
 //   - Link: The URL for the call-to-action button
 //
-// The generated HTML will be responsive and have a basic CSS style.
+// The values are escaped, so they may contain user input such as names. The
+// generated HTML will be responsive and have a basic CSS style.
 func GenerateEmailHTML(data map[string]string) string {
 	const emailTemplate = `
 	<!DOCTYPE html>
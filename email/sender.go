@@ -0,0 +1,161 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipients is returned when a message has no recipient.
+var ErrNoRecipients = errors.New("email has no recipients")
+
+// DefaultSMTPTimeout bounds a send whose context has no deadline.
+const DefaultSMTPTimeout = 30 * time.Second
+
+// Message is an HTML email, usually rendered with GenerateEmailHTML.
+type Message struct {
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// Sender delivers emails.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig holds the settings of an SMTP server.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, for example "Payment Gateway <no-reply@sanedge.com>".
+	From string
+	// Timeout bounds a send whose context has no deadline, DefaultSMTPTimeout
+	// when zero.
+	Timeout time.Duration
+}
+
+// SMTPSender is a Sender that delivers emails through an SMTP server with
+// PLAIN authentication. STARTTLS is used when the server supports it.
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPSender creates a new SMTPSender.
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+// Send delivers the message. The deadline of the context, or the configured
+// timeout when it has none, bounds the whole exchange with the server.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := s.cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultSMTPTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	from, err := envelopeAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, fmt.Sprint(s.cfg.Port))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate to smtp server: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(buildMessage(s.cfg.From, msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func envelopeAddress(from string) (string, error) {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		j := strings.LastIndex(from, ">")
+		if j < i {
+			return "", fmt.Errorf("malformed address %q", from)
+		}
+		return from[i+1 : j], nil
+	}
+	if from == "" {
+		return "", fmt.Errorf("empty address")
+	}
+	return from, nil
+}
+
+// buildMessage renders the headers and HTML body of msg.
+func buildMessage(from string, msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.HTML, "\n", "\r\n"))
+
+	return b.Bytes()
+}
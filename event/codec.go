@@ -0,0 +1,145 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrUnsupportedPayload is returned when a payload cannot be encoded with the
+// codec of its schema, such as a struct given to the protobuf codec.
+var ErrUnsupportedPayload = errors.New("unsupported event payload")
+
+// Format is the serialization format of a schema. Its value is sent as the
+// content-type header.
+type Format string
+
+// Supported formats.
+const (
+	FormatJSON     Format = "application/json"
+	FormatProtobuf Format = "application/x-protobuf"
+	FormatAvro     Format = "application/avro"
+)
+
+// Codec encodes and decodes payloads of one format.
+type Codec interface {
+	Format() Format
+	Encode(schema *Schema, v any) ([]byte, error)
+	Decode(schema *Schema, data []byte, v any) error
+}
+
+// JSONCodec encodes payloads with encoding/json.
+type JSONCodec struct{}
+
+// Format returns FormatJSON.
+func (JSONCodec) Format() Format { return FormatJSON }
+
+// Encode encodes v as JSON.
+func (JSONCodec) Encode(schema *Schema, v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode decodes JSON into v.
+func (JSONCodec) Decode(schema *Schema, data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes payloads that are proto.Message values.
+type ProtobufCodec struct{}
+
+// Format returns FormatProtobuf.
+func (ProtobufCodec) Format() Format { return FormatProtobuf }
+
+// Encode encodes v, which must be a proto.Message, in the protobuf wire format.
+func (ProtobufCodec) Encode(schema *Schema, v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a proto.Message", ErrUnsupportedPayload, v)
+	}
+	return proto.Marshal(msg)
+}
+
+// Decode decodes the protobuf wire format into v, which must be a proto.Message.
+func (ProtobufCodec) Decode(schema *Schema, data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a proto.Message", ErrUnsupportedPayload, v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// AvroCodec encodes payloads in the Avro binary format with the schema they
+// were registered with.
+//
+// Payloads are converted through their JSON form, so struct fields map to Avro
+// fields by their json tags. Avro unions, including nullable fields, use the
+// Avro JSON encoding, e.g. {"string": "value"}, or nil for null.
+type AvroCodec struct {
+	mu     sync.Mutex
+	codecs map[string]*goavro.Codec
+}
+
+// NewAvroCodec creates an AvroCodec.
+func NewAvroCodec() *AvroCodec {
+	return &AvroCodec{codecs: make(map[string]*goavro.Codec)}
+}
+
+// Format returns FormatAvro.
+func (c *AvroCodec) Format() Format { return FormatAvro }
+
+// Encode encodes v in the Avro binary format.
+func (c *AvroCodec) Encode(schema *Schema, v any) ([]byte, error) {
+	codec, err := c.codec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromTextual(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPayload, err)
+	}
+	return codec.BinaryFromNative(nil, native)
+}
+
+// Decode decodes the Avro binary format into v.
+func (c *AvroCodec) Decode(schema *Schema, data []byte, v any) error {
+	codec, err := c.codec(schema)
+	if err != nil {
+		return err
+	}
+
+	native, _, err := codec.NativeFromBinary(data)
+	if err != nil {
+		return err
+	}
+	text, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(text, v)
+}
+
+func (c *AvroCodec) codec(schema *Schema) (*goavro.Codec, error) {
+	key := schema.key()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if codec, ok := c.codecs[key]; ok {
+		return codec, nil
+	}
+	codec, err := goavro.NewCodec(schema.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	c.codecs[key] = codec
+	return codec, nil
+}
@@ -0,0 +1,259 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// CheckCompatibility reports whether next may follow previous under mode. The
+// error wraps ErrIncompatibleSchema and lists every breaking change.
+//
+// Only the top level of a schema is compared: Avro record fields, JSON Schema
+// properties and protobuf message fields. Nested types must stay identical.
+func CheckCompatibility(mode Compatibility, previous, next *Schema) error {
+	if mode == CompatibilityNone {
+		return nil
+	}
+	if previous.Format != next.Format {
+		return fmt.Errorf("%w: %s changes format from %s to %s", ErrIncompatibleSchema, next.Subject, previous.Format, next.Format)
+	}
+
+	prev, err := parseSchema(previous)
+	if err != nil {
+		return err
+	}
+	curr, err := parseSchema(next)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	switch mode {
+	case CompatibilityBackward:
+		problems = curr.canRead(prev)
+	case CompatibilityForward:
+		problems = prev.canRead(curr)
+	case CompatibilityFull:
+		problems = append(curr.canRead(prev), prev.canRead(curr)...)
+	default:
+		return fmt.Errorf("%w: unknown compatibility mode %q", ErrInvalidSchema, mode)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%w: %s version %d: %v", ErrIncompatibleSchema, next.Subject, next.Version, problems)
+	}
+	return nil
+}
+
+// parsedSchema is a schema reduced to the parts compared by CheckCompatibility.
+type parsedSchema interface {
+	// canRead lists why a reader with this schema cannot read data written
+	// with writer, which has the same format.
+	canRead(writer parsedSchema) []string
+}
+
+func parseSchema(schema *Schema) (parsedSchema, error) {
+	switch schema.Format {
+	case FormatJSON:
+		return parseJSONSchema(schema.Definition)
+	case FormatAvro:
+		return parseAvroSchema(schema.Definition)
+	case FormatProtobuf:
+		return parseProtobufSchema(schema.Definition)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidSchema, schema.Format)
+	}
+}
+
+// jsonSchema is the top level of a JSON Schema object.
+type jsonSchema struct {
+	Properties map[string]struct {
+		Type json.RawMessage `json:"type"`
+	} `json:"properties"`
+	Required []string `json:"required"`
+
+	empty bool
+}
+
+func parseJSONSchema(definition string) (*jsonSchema, error) {
+	if definition == "" {
+		return &jsonSchema{empty: true}, nil
+	}
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(definition), &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return &s, nil
+}
+
+// canRead requires every property the reader requires to be required by the
+// writer, and shared properties to keep their type.
+func (r *jsonSchema) canRead(writer parsedSchema) []string {
+	w := writer.(*jsonSchema)
+	if r.empty || w.empty {
+		return nil
+	}
+
+	var problems []string
+	written := make(map[string]bool, len(w.Required))
+	for _, name := range w.Required {
+		written[name] = true
+	}
+	for _, name := range r.Required {
+		if !written[name] {
+			problems = append(problems, fmt.Sprintf("property %q is required but may be missing", name))
+		}
+	}
+	for name, rp := range r.Properties {
+		wp, ok := w.Properties[name]
+		if ok && len(rp.Type) > 0 && len(wp.Type) > 0 && !sameJSON(rp.Type, wp.Type) {
+			problems = append(problems, fmt.Sprintf("property %q changes type from %s to %s", name, wp.Type, rp.Type))
+		}
+	}
+	return problems
+}
+
+// avroSchema is an Avro schema, with the fields of a top-level record.
+type avroSchema struct {
+	canonical string
+	record    bool
+	fields    map[string]avroField
+}
+
+type avroField struct {
+	Name    string           `json:"name"`
+	Type    json.RawMessage  `json:"type"`
+	Default *json.RawMessage `json:"default"`
+}
+
+func parseAvroSchema(definition string) (*avroSchema, error) {
+	codec, err := goavro.NewCodec(definition)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	s := &avroSchema{canonical: codec.CanonicalSchema()}
+
+	var record struct {
+		Type   string      `json:"type"`
+		Fields []avroField `json:"fields"`
+	}
+	if json.Unmarshal([]byte(definition), &record) == nil && record.Type == "record" {
+		s.record = true
+		s.fields = make(map[string]avroField, len(record.Fields))
+		for _, f := range record.Fields {
+			s.fields[f.Name] = f
+		}
+	}
+	return s, nil
+}
+
+// avroPromotions lists the writer types each reader type can read, following
+// the Avro schema resolution rules.
+var avroPromotions = map[string][]string{
+	`"long"`:   {`"int"`},
+	`"float"`:  {`"int"`, `"long"`},
+	`"double"`: {`"int"`, `"long"`, `"float"`},
+	`"string"`: {`"bytes"`},
+	`"bytes"`:  {`"string"`},
+}
+
+// canRead requires every reader field missing from the writer to have a
+// default, and shared fields to keep their type or be promotable.
+func (r *avroSchema) canRead(writer parsedSchema) []string {
+	w := writer.(*avroSchema)
+	if !r.record || !w.record {
+		if r.canonical != w.canonical {
+			return []string{"schema changes"}
+		}
+		return nil
+	}
+
+	var problems []string
+	for name, rf := range r.fields {
+		wf, ok := w.fields[name]
+		if !ok {
+			if rf.Default == nil {
+				problems = append(problems, fmt.Sprintf("field %q has no default", name))
+			}
+			continue
+		}
+		if !avroReadable(rf.Type, wf.Type) {
+			problems = append(problems, fmt.Sprintf("field %q changes type from %s to %s", name, wf.Type, rf.Type))
+		}
+	}
+	return problems
+}
+
+func avroReadable(reader, writer json.RawMessage) bool {
+	if sameJSON(reader, writer) {
+		return true
+	}
+	for _, from := range avroPromotions[compactJSON(reader)] {
+		if compactJSON(writer) == from {
+			return true
+		}
+	}
+	return false
+}
+
+// protobufSchema is a message descriptor built by ProtobufSchema.
+type protobufSchema struct {
+	fields map[int32]*descriptorpb.FieldDescriptorProto
+}
+
+func parseProtobufSchema(definition string) (*protobufSchema, error) {
+	var descriptor descriptorpb.DescriptorProto
+	if err := protojson.Unmarshal([]byte(definition), &descriptor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	s := &protobufSchema{fields: make(map[int32]*descriptorpb.FieldDescriptorProto, len(descriptor.GetField()))}
+	for _, f := range descriptor.GetField() {
+		s.fields[f.GetNumber()] = f
+	}
+	return s, nil
+}
+
+// canRead requires shared field numbers to keep their type and label, and
+// fields the reader requires to be written.
+func (r *protobufSchema) canRead(writer parsedSchema) []string {
+	w := writer.(*protobufSchema)
+
+	var problems []string
+	for number, rf := range r.fields {
+		wf, ok := w.fields[number]
+		if !ok {
+			if rf.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+				problems = append(problems, fmt.Sprintf("required field %d (%s) is missing", number, rf.GetName()))
+			}
+			continue
+		}
+		if rf.GetType() != wf.GetType() || rf.GetTypeName() != wf.GetTypeName() {
+			problems = append(problems, fmt.Sprintf("field %d (%s) changes type from %s to %s", number, rf.GetName(), wf.GetType(), rf.GetType()))
+		}
+		if rf.GetLabel() != wf.GetLabel() {
+			problems = append(problems, fmt.Sprintf("field %d (%s) changes label from %s to %s", number, rf.GetName(), wf.GetLabel(), rf.GetLabel()))
+		}
+	}
+	return problems
+}
+
+func sameJSON(a, b json.RawMessage) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,37 @@
+package event
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Envelope wraps the payload of a domain event with the metadata every consumer
+// needs to route and decode it.
+type Envelope struct {
+	// ID identifies the event; consumers use it as the idempotency key.
+	ID string `json:"id"`
+	// Type names the event, e.g. "topup.created", and is the registry subject
+	// of its payload schema.
+	Type string `json:"type"`
+	// Version is the schema version the payload is encoded with.
+	Version int `json:"version"`
+	// OccurredAt is when the event happened, in UTC.
+	OccurredAt time.Time `json:"occurred_at"`
+	// Trace holds the W3C trace context of the producer, such as traceparent
+	// and tracestate, so consumers can continue the trace.
+	Trace map[string]string `json:"trace,omitempty"`
+	// Payload is the event data, a proto.Message for protobuf schemas.
+	Payload any `json:"payload"`
+}
+
+// New creates an envelope for a payload with a new ID, occurring now.
+func New(eventType string, version int, payload any) *Envelope {
+	return &Envelope{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		Version:    version,
+		OccurredAt: time.Now().UTC(),
+		Payload:    payload,
+	}
+}
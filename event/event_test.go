@@ -0,0 +1,259 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type topupCreated struct {
+	TopupNo     string `json:"topup_no"`
+	CardNumber  string `json:"card_number"`
+	TopupAmount int64  `json:"topup_amount"`
+}
+
+const topupAvroV1 = `{
+	"type": "record",
+	"name": "TopupCreated",
+	"fields": [
+		{"name": "topup_no", "type": "string"},
+		{"name": "card_number", "type": "string"},
+		{"name": "topup_amount", "type": "int"}
+	]
+}`
+
+func toConsumed(msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	key, _ := msg.Key.Encode()
+	value, _ := msg.Value.Encode()
+
+	consumed := &sarama.ConsumerMessage{Topic: msg.Topic, Key: key, Value: value}
+	for i := range msg.Headers {
+		consumed.Headers = append(consumed.Headers, &msg.Headers[i])
+	}
+	return consumed
+}
+
+func TestSerializer_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry(CompatibilityBackward)
+
+	require.NoError(t, registry.Register(ctx, Schema{Subject: "topup.created", Version: 1, Format: FormatAvro, Definition: topupAvroV1}))
+	require.NoError(t, registry.Register(ctx, Schema{Subject: "transfer.created", Version: 1, Format: FormatJSON}))
+	wrapper, err := ProtobufSchema("withdraw.created", 1, &wrapperspb.Int64Value{})
+	require.NoError(t, err)
+	require.NoError(t, registry.Register(ctx, wrapper))
+
+	s := NewSerializer(registry)
+
+	tests := []struct {
+		name    string
+		env     *Envelope
+		payload func() any
+		format  Format
+	}{
+		{
+			name:    "avro",
+			env:     New("topup.created", 1, topupCreated{TopupNo: "TOP-1", CardNumber: "4111", TopupAmount: 50000}),
+			payload: func() any { return &topupCreated{} },
+			format:  FormatAvro,
+		},
+		{
+			name:    "json",
+			env:     New("transfer.created", 0, map[string]any{"transfer_no": "TR-1"}),
+			payload: func() any { return &map[string]any{} },
+			format:  FormatJSON,
+		},
+		{
+			name:    "protobuf",
+			env:     New("withdraw.created", 1, wrapperspb.Int64(75000)),
+			payload: func() any { return &wrapperspb.Int64Value{} },
+			format:  FormatProtobuf,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.env.Trace = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+
+			msg, err := s.Serialize(ctx, "payment-events", "key-1", tt.env)
+			require.NoError(t, err)
+			assert.Equal(t, "payment-events", msg.Topic)
+
+			got, err := s.Deserialize(ctx, toConsumed(msg), tt.payload())
+			require.NoError(t, err)
+			assert.Equal(t, tt.env.ID, got.ID)
+			assert.Equal(t, tt.env.Type, got.Type)
+			assert.Equal(t, 1, got.Version)
+			assert.True(t, tt.env.OccurredAt.Equal(got.OccurredAt))
+			assert.Equal(t, tt.env.Trace, got.Trace)
+			assert.Equal(t, string(tt.format), header(toConsumed(msg), HeaderContentType))
+		})
+	}
+}
+
+func TestSerializer_DecodedPayloads(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry(CompatibilityBackward)
+	require.NoError(t, registry.Register(ctx, Schema{Subject: "topup.created", Version: 1, Format: FormatAvro, Definition: topupAvroV1}))
+	s := NewSerializer(registry)
+
+	msg, err := s.Serialize(ctx, "topup-events", "TOP-1", New("topup.created", 1, topupCreated{TopupNo: "TOP-1", CardNumber: "4111", TopupAmount: 50000}))
+	require.NoError(t, err)
+
+	var payload topupCreated
+	_, err = s.Deserialize(ctx, toConsumed(msg), &payload)
+	require.NoError(t, err)
+	assert.Equal(t, topupCreated{TopupNo: "TOP-1", CardNumber: "4111", TopupAmount: 50000}, payload)
+
+	_, err = s.Serialize(ctx, "topup-events", "TOP-2", New("topup.created", 1, map[string]any{"topup_no": "TOP-2"}))
+	assert.ErrorIs(t, err, ErrUnsupportedPayload)
+
+	_, err = s.Serialize(ctx, "topup-events", "TOP-3", New("topup.created", 2, topupCreated{}))
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+
+	noID := New("topup.created", 1, topupCreated{})
+	noID.ID = ""
+	_, err = s.Serialize(ctx, "topup-events", "TOP-4", noID)
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+
+	_, err = s.Serialize(ctx, "topup-events", "TOP-5", New("", 1, topupCreated{}))
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+
+	_, err = s.Deserialize(ctx, &sarama.ConsumerMessage{Value: []byte("{}")}, &payload)
+	assert.ErrorIs(t, err, ErrMissingHeader)
+}
+
+func TestMemoryRegistry_Avro(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry(CompatibilityBackward)
+	v1 := Schema{Subject: "topup.created", Version: 1, Format: FormatAvro, Definition: topupAvroV1}
+	require.NoError(t, registry.Register(ctx, v1))
+	require.NoError(t, registry.Register(ctx, v1), "registering the same schema again is a no-op")
+
+	// Adding a field with a default and widening int to long is backward
+	// compatible.
+	v2 := Schema{Subject: "topup.created", Version: 2, Format: FormatAvro, Definition: `{
+		"type": "record",
+		"name": "TopupCreated",
+		"fields": [
+			{"name": "topup_no", "type": "string"},
+			{"name": "card_number", "type": "string"},
+			{"name": "topup_amount", "type": "long"},
+			{"name": "topup_method", "type": "string", "default": "bank_transfer"}
+		]
+	}`}
+	require.NoError(t, registry.Register(ctx, v2))
+
+	// A new field without a default cannot be read from v2 events.
+	v3 := Schema{Subject: "topup.created", Version: 3, Format: FormatAvro, Definition: `{
+		"type": "record",
+		"name": "TopupCreated",
+		"fields": [
+			{"name": "topup_no", "type": "string"},
+			{"name": "topup_amount", "type": "long"},
+			{"name": "merchant_id", "type": "int"}
+		]
+	}`}
+	assert.ErrorIs(t, registry.Register(ctx, v3), ErrIncompatibleSchema)
+
+	// Removing card_number breaks readers still on v2 once forward
+	// compatibility is required, but not under backward compatibility.
+	v3.Definition = `{
+		"type": "record",
+		"name": "TopupCreated",
+		"fields": [
+			{"name": "topup_no", "type": "string"},
+			{"name": "topup_amount", "type": "long"},
+			{"name": "topup_method", "type": "string", "default": "bank_transfer"}
+		]
+	}`
+	registry.SetCompatibility("topup.created", CompatibilityFull)
+	assert.ErrorIs(t, registry.Register(ctx, v3), ErrIncompatibleSchema)
+	registry.SetCompatibility("topup.created", CompatibilityBackward)
+	require.NoError(t, registry.Register(ctx, v3))
+
+	latest, err := registry.Latest(ctx, "topup.created")
+	require.NoError(t, err)
+	assert.Equal(t, 3, latest.Version)
+	assert.Equal(t, []int{1, 2, 3}, registry.Versions("topup.created"))
+
+	v1.Definition = v2.Definition
+	assert.ErrorIs(t, registry.Register(ctx, v1), ErrSchemaConflict)
+	assert.ErrorIs(t, registry.Register(ctx, Schema{Subject: "topup.created", Version: 4, Format: FormatAvro, Definition: "{"}), ErrInvalidSchema)
+
+	_, err = registry.Get(ctx, "topup.created", 9)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
+
+func TestCheckCompatibility_JSONSchema(t *testing.T) {
+	v1 := &Schema{Subject: "transfer.created", Version: 1, Format: FormatJSON, Definition: `{
+		"type": "object",
+		"properties": {"transfer_no": {"type": "string"}, "amount": {"type": "integer"}},
+		"required": ["transfer_no", "amount"]
+	}`}
+	v2 := &Schema{Subject: "transfer.created", Version: 2, Format: FormatJSON, Definition: `{
+		"type": "object",
+		"properties": {"transfer_no": {"type": "string"}, "amount": {"type": "integer"}, "note": {"type": "string"}},
+		"required": ["transfer_no", "amount", "note"]
+	}`}
+
+	assert.NoError(t, CheckCompatibility(CompatibilityForward, v1, v2))
+	assert.ErrorIs(t, CheckCompatibility(CompatibilityBackward, v1, v2), ErrIncompatibleSchema)
+	assert.NoError(t, CheckCompatibility(CompatibilityNone, v1, v2))
+
+	v2.Definition = `{"properties": {"transfer_no": {"type": "string"}, "amount": {"type": "string"}}, "required": ["transfer_no", "amount"]}`
+	assert.ErrorIs(t, CheckCompatibility(CompatibilityForward, v1, v2), ErrIncompatibleSchema)
+
+	avro := &Schema{Subject: "transfer.created", Version: 2, Format: FormatAvro, Definition: `"string"`}
+	assert.ErrorIs(t, CheckCompatibility(CompatibilityBackward, v1, avro), ErrIncompatibleSchema)
+}
+
+func TestCheckCompatibility_Protobuf(t *testing.T) {
+	int64Value, err := ProtobufSchema("withdraw.created", 1, &wrapperspb.Int64Value{})
+	require.NoError(t, err)
+	int32Value, err := ProtobufSchema("withdraw.created", 2, &wrapperspb.Int32Value{})
+	require.NoError(t, err)
+	stringValue, err := ProtobufSchema("withdraw.created", 2, &wrapperspb.StringValue{})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, CheckCompatibility(CompatibilityBackward, &int64Value, &int32Value), ErrIncompatibleSchema)
+	assert.ErrorIs(t, CheckCompatibility(CompatibilityBackward, &int64Value, &stringValue), ErrIncompatibleSchema)
+	assert.NoError(t, CheckCompatibility(CompatibilityFull, &int64Value, &int64Value))
+}
+
+type fakeSender struct {
+	messages []*sarama.ProducerMessage
+}
+
+func (f *fakeSender) SendContext(ctx context.Context, msg *sarama.ProducerMessage) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry(CompatibilityBackward)
+	require.NoError(t, registry.Register(ctx, Schema{Subject: "topup.created", Version: 1, Format: FormatJSON}))
+
+	sender := &fakeSender{}
+	p := NewPublisher(NewSerializer(registry), sender)
+
+	env := New("topup.created", 1, topupCreated{TopupNo: "TOP-1"})
+	env.OccurredAt = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, p.Publish(ctx, "topup-events", "TOP-1", env))
+
+	require.Len(t, sender.messages, 1)
+	consumed := toConsumed(sender.messages[0])
+	assert.Equal(t, "TOP-1", string(consumed.Key))
+	assert.Equal(t, "2025-01-01T12:00:00Z", header(consumed, HeaderOccurredAt))
+
+	parsed, err := Parse(consumed)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, parsed.ID)
+	assert.Nil(t, parsed.Payload)
+}
@@ -0,0 +1,42 @@
+package event
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// Sender sends a prepared Kafka message within the trace of ctx.
+// *kafka.Kafka implements it.
+type Sender interface {
+	SendContext(ctx context.Context, msg *sarama.ProducerMessage) error
+}
+
+// Publisher serializes envelopes and sends them to Kafka.
+type Publisher struct {
+	serializer *Serializer
+	sender     Sender
+}
+
+// NewPublisher creates a Publisher.
+//
+// Parameters:
+//   - serializer: The serializer encoding the envelopes (*Serializer)
+//   - sender: The producer sending the messages (Sender)
+//
+// Returns:
+//   - *Publisher: The publisher
+func NewPublisher(serializer *Serializer, sender Sender) *Publisher {
+	return &Publisher{serializer: serializer, sender: sender}
+}
+
+// Publish serializes env and sends it to topic with the given key. The trace
+// context of ctx replaces env.Trace in the message headers when the sender
+// traces, as *kafka.Kafka does.
+func (p *Publisher) Publish(ctx context.Context, topic, key string, env *Envelope) error {
+	msg, err := p.serializer.Serialize(ctx, topic, key, env)
+	if err != nil {
+		return err
+	}
+	return p.sender.SendContext(ctx, msg)
+}
@@ -0,0 +1,207 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+var (
+	// ErrSchemaNotFound is returned when a subject has no schema of the version.
+	ErrSchemaNotFound = errors.New("event schema not found")
+
+	// ErrInvalidSchema is returned when a schema definition cannot be parsed.
+	ErrInvalidSchema = errors.New("invalid event schema")
+
+	// ErrSchemaConflict is returned when a version is registered again with a
+	// different definition, or is not newer than the latest version.
+	ErrSchemaConflict = errors.New("event schema conflict")
+
+	// ErrIncompatibleSchema is returned when a new version breaks the
+	// compatibility mode of its subject.
+	ErrIncompatibleSchema = errors.New("incompatible event schema")
+)
+
+// Schema is a version of the payload schema of an event type.
+type Schema struct {
+	// Subject is the event type the schema belongs to.
+	Subject string
+	Version int
+	Format  Format
+	// Definition is a JSON Schema for FormatJSON, an Avro schema for
+	// FormatAvro, and a descriptor built by ProtobufSchema for FormatProtobuf.
+	// It may be empty for FormatJSON, which disables compatibility checks.
+	Definition string
+}
+
+func (s *Schema) key() string {
+	return s.Subject + "/" + strconv.Itoa(s.Version)
+}
+
+// ProtobufSchema builds the schema of a protobuf message type.
+func ProtobufSchema(subject string, version int, msg proto.Message) (Schema, error) {
+	descriptor := protodesc.ToDescriptorProto(msg.ProtoReflect().Descriptor())
+	definition, err := protojson.Marshal(descriptor)
+	if err != nil {
+		return Schema{}, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return Schema{
+		Subject:    subject,
+		Version:    version,
+		Format:     FormatProtobuf,
+		Definition: string(definition),
+	}, nil
+}
+
+// Compatibility decides which schema changes a subject accepts. Each new
+// version is checked against the latest registered one.
+type Compatibility string
+
+// Compatibility modes.
+const (
+	// CompatibilityBackward lets consumers on the new version read events
+	// written with the previous one, so consumers are upgraded first.
+	CompatibilityBackward Compatibility = "BACKWARD"
+	// CompatibilityForward lets consumers on the previous version read events
+	// written with the new one, so producers are upgraded first.
+	CompatibilityForward Compatibility = "FORWARD"
+	// CompatibilityFull requires both.
+	CompatibilityFull Compatibility = "FULL"
+	// CompatibilityNone accepts any change.
+	CompatibilityNone Compatibility = "NONE"
+)
+
+// Registry stores the schemas of event payloads.
+type Registry interface {
+	// Register adds a schema version, checking it against the latest version of
+	// its subject. Registering an identical schema again is a no-op.
+	Register(ctx context.Context, schema Schema) error
+	// Get returns a schema version of a subject.
+	Get(ctx context.Context, subject string, version int) (*Schema, error)
+	// Latest returns the newest schema version of a subject.
+	Latest(ctx context.Context, subject string) (*Schema, error)
+}
+
+// MemoryRegistry is a Registry kept in process memory. Services register the
+// schemas they produce and consume at startup.
+type MemoryRegistry struct {
+	mu       sync.RWMutex
+	mode     Compatibility
+	modes    map[string]Compatibility
+	subjects map[string]map[int]*Schema
+}
+
+// NewMemoryRegistry creates an empty MemoryRegistry checking new versions with
+// the given default mode.
+func NewMemoryRegistry(mode Compatibility) *MemoryRegistry {
+	return &MemoryRegistry{
+		mode:     mode,
+		modes:    make(map[string]Compatibility),
+		subjects: make(map[string]map[int]*Schema),
+	}
+}
+
+// SetCompatibility overrides the default mode for one subject.
+func (r *MemoryRegistry) SetCompatibility(subject string, mode Compatibility) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modes[subject] = mode
+}
+
+// Register adds a schema version, checking it against the latest version of
+// its subject. Registering an identical schema again is a no-op.
+func (r *MemoryRegistry) Register(ctx context.Context, schema Schema) error {
+	if schema.Subject == "" || schema.Version <= 0 {
+		return fmt.Errorf("%w: subject and a positive version are required", ErrInvalidSchema)
+	}
+	if _, err := parseSchema(&schema); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[schema.Subject]
+	if existing, ok := versions[schema.Version]; ok {
+		if *existing == schema {
+			return nil
+		}
+		return fmt.Errorf("%w: %s version %d is already registered", ErrSchemaConflict, schema.Subject, schema.Version)
+	}
+
+	if latest := latestOf(versions); latest != nil {
+		if schema.Version < latest.Version {
+			return fmt.Errorf("%w: %s version %d is older than version %d", ErrSchemaConflict, schema.Subject, schema.Version, latest.Version)
+		}
+
+		mode, ok := r.modes[schema.Subject]
+		if !ok {
+			mode = r.mode
+		}
+		if err := CheckCompatibility(mode, latest, &schema); err != nil {
+			return err
+		}
+	}
+
+	if versions == nil {
+		versions = make(map[int]*Schema)
+		r.subjects[schema.Subject] = versions
+	}
+	versions[schema.Version] = &schema
+	return nil
+}
+
+// Get returns a schema version of a subject.
+func (r *MemoryRegistry) Get(ctx context.Context, subject string, version int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.subjects[subject][version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s version %d", ErrSchemaNotFound, subject, version)
+	}
+	return schema, nil
+}
+
+// Latest returns the newest schema version of a subject.
+func (r *MemoryRegistry) Latest(ctx context.Context, subject string) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	latest := latestOf(r.subjects[subject])
+	if latest == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, subject)
+	}
+	return latest, nil
+}
+
+// Versions returns the registered versions of a subject in ascending order.
+func (r *MemoryRegistry) Versions(subject string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make([]int, 0, len(r.subjects[subject]))
+	for v := range r.subjects[subject] {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+func latestOf(versions map[int]*Schema) *Schema {
+	var latest *Schema
+	for _, s := range versions {
+		if latest == nil || s.Version > latest.Version {
+			latest = s
+		}
+	}
+	return latest
+}
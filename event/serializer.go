@@ -0,0 +1,212 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers carrying the envelope metadata of a Kafka message. The payload is the
+// message value.
+const (
+	HeaderID          = "event-id"
+	HeaderType        = "event-type"
+	HeaderVersion     = "event-version"
+	HeaderOccurredAt  = "event-occurred-at"
+	HeaderContentType = "content-type"
+)
+
+// TraceHeaders are the W3C trace context headers copied between Envelope.Trace
+// and the message headers.
+var TraceHeaders = []string{"traceparent", "tracestate", "baggage"}
+
+var (
+	// ErrMissingHeader is returned when a consumed message lacks an envelope header.
+	ErrMissingHeader = errors.New("missing event header")
+
+	// ErrInvalidEnvelope is returned when an envelope to serialize lacks an ID
+	// or a type, which Parse would reject on the consumer side.
+	ErrInvalidEnvelope = errors.New("invalid event envelope")
+)
+
+// Serializer turns envelopes into Kafka messages and back, encoding payloads
+// with the codec of the schema they are registered with.
+type Serializer struct {
+	registry Registry
+	codecs   map[Format]Codec
+}
+
+// NewSerializer creates a Serializer looking schemas up in registry.
+//
+// The JSON, protobuf and Avro codecs are used unless codecs are given; a given
+// codec replaces the one of its format.
+//
+// Parameters:
+//   - registry: The registry holding the payload schemas (Registry)
+//   - codecs: Codecs replacing the defaults (...Codec)
+//
+// Returns:
+//   - *Serializer: The serializer
+func NewSerializer(registry Registry, codecs ...Codec) *Serializer {
+	s := &Serializer{
+		registry: registry,
+		codecs: map[Format]Codec{
+			FormatJSON:     JSONCodec{},
+			FormatProtobuf: ProtobufCodec{},
+			FormatAvro:     NewAvroCodec(),
+		},
+	}
+	for _, c := range codecs {
+		s.codecs[c.Format()] = c
+	}
+	return s
+}
+
+// Serialize encodes env into a message for topic. The payload is encoded with
+// schema env.Type version env.Version, or the latest version when env.Version
+// is zero, in which case env.Version is set to it.
+// An envelope without an ID or type is rejected with ErrInvalidEnvelope.
+func (s *Serializer) Serialize(ctx context.Context, topic, key string, env *Envelope) (*sarama.ProducerMessage, error) {
+	if env.ID == "" {
+		return nil, fmt.Errorf("%w: missing ID", ErrInvalidEnvelope)
+	}
+	if env.Type == "" {
+		return nil, fmt.Errorf("%w: missing type", ErrInvalidEnvelope)
+	}
+
+	schema, err := s.schema(ctx, env.Type, env.Version)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := s.codec(schema.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := codec.Encode(schema, env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", env.Type, err)
+	}
+	env.Version = schema.Version
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(HeaderID), Value: []byte(env.ID)},
+		{Key: []byte(HeaderType), Value: []byte(env.Type)},
+		{Key: []byte(HeaderVersion), Value: []byte(strconv.Itoa(env.Version))},
+		{Key: []byte(HeaderOccurredAt), Value: []byte(env.OccurredAt.UTC().Format(time.RFC3339Nano))},
+		{Key: []byte(HeaderContentType), Value: []byte(schema.Format)},
+	}
+	for _, name := range TraceHeaders {
+		if value, ok := env.Trace[name]; ok {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(name), Value: []byte(value)})
+		}
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(value),
+		Headers: headers,
+	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	return msg, nil
+}
+
+// Deserialize decodes the envelope of msg, decoding the payload into payload,
+// which must be a pointer, or a proto.Message for protobuf schemas. The
+// returned envelope holds payload.
+//
+// The payload is decoded with the schema version it was written with, so the
+// reader must accept every version still on the topic.
+func (s *Serializer) Deserialize(ctx context.Context, msg *sarama.ConsumerMessage, payload any) (*Envelope, error) {
+	env, err := Parse(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := s.schema(ctx, env.Type, env.Version)
+	if err != nil {
+		return nil, err
+	}
+	if format := Format(header(msg, HeaderContentType)); format != "" && format != schema.Format {
+		return nil, fmt.Errorf("%w: %s version %d is %s, message is %s", ErrUnsupportedPayload, env.Type, env.Version, schema.Format, format)
+	}
+	codec, err := s.codec(schema.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := codec.Decode(schema, msg.Value, payload); err != nil {
+		return nil, fmt.Errorf("failed to decode %s event: %w", env.Type, err)
+	}
+	env.Payload = payload
+	return env, nil
+}
+
+// Parse reads the envelope headers of msg without decoding the payload, e.g. to
+// pick the payload type from the event type. The returned envelope has no
+// payload.
+func Parse(msg *sarama.ConsumerMessage) (*Envelope, error) {
+	env := &Envelope{
+		ID:   header(msg, HeaderID),
+		Type: header(msg, HeaderType),
+	}
+	if env.ID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, HeaderID)
+	}
+	if env.Type == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, HeaderType)
+	}
+
+	version, err := strconv.Atoi(header(msg, HeaderVersion))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, HeaderVersion)
+	}
+	env.Version = version
+
+	if value := header(msg, HeaderOccurredAt); value != "" {
+		if env.OccurredAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", HeaderOccurredAt, err)
+		}
+	}
+
+	for _, name := range TraceHeaders {
+		if value := header(msg, name); value != "" {
+			if env.Trace == nil {
+				env.Trace = make(map[string]string)
+			}
+			env.Trace[name] = value
+		}
+	}
+	return env, nil
+}
+
+func (s *Serializer) schema(ctx context.Context, subject string, version int) (*Schema, error) {
+	if version == 0 {
+		return s.registry.Latest(ctx, subject)
+	}
+	return s.registry.Get(ctx, subject, version)
+}
+
+func (s *Serializer) codec(format Format) (Codec, error) {
+	codec, ok := s.codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: no codec for %s", ErrUnsupportedPayload, format)
+	}
+	return codec, nil
+}
+
+// header returns the value of the named header of msg, or an empty string.
+func header(msg *sarama.ConsumerMessage, name string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == name {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package hash
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// breachPrefixLength is the number of hex characters of the SHA-1 hash that are
+// used to select a bucket, as in the Have I Been Pwned range API.
+const breachPrefixLength = 5
+
+// BreachedPasswords returns buckets of SHA-1 hashes of breached passwords.
+//
+// Lookups use k-anonymity: only the first five hex characters of the hash are
+// passed to Range, which returns every hash suffix in that bucket with the
+// number of times it was seen. The password itself, or its full hash, never
+// leaves CheckBreached.
+type BreachedPasswords interface {
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// CheckBreached returns how often the password has been seen in breaches, or 0
+// if it is not in the list.
+//
+// Parameters:
+//   - ctx: The context of the lookup (context.Context)
+//   - list: The breached password list (BreachedPasswords)
+//   - password: The plaintext password (string)
+//
+// Returns:
+//   - int: The number of times the password was seen (int)
+//   - error: Any error encountered while querying the list (error)
+func CheckBreached(ctx context.Context, list BreachedPasswords, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	bucket, err := list.Range(ctx, digest[:breachPrefixLength])
+	if err != nil {
+		return 0, err
+	}
+
+	return bucket[digest[breachPrefixLength:]], nil
+}
+
+// BreachList is a BreachedPasswords kept in memory, loaded from a local file.
+type BreachList struct {
+	buckets map[string]map[string]int
+}
+
+// LoadBreachList reads a breached password list from the file at path, see
+// ReadBreachList for the format.
+func LoadBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBreachList(f)
+}
+
+// ReadBreachList reads a breached password list made of SHA-1 prefix buckets.
+// Every bucket starts with a line holding the five character prefix followed by
+// a colon, and lists one "SUFFIX:COUNT" line per hash, as returned by the Have I
+// Been Pwned range API:
+//
+//	21BD1:
+//	0018A45C4D1DEF81644B54AB7F969B88D65:1
+//	00D4F6E8FA6EECAD2A3AA415EEC418D38EC:2
+//
+// Blank lines and lines starting with # are ignored. Hashes are upper cased.
+func ReadBreachList(r io.Reader) (*BreachList, error) {
+	list := &BreachList{buckets: make(map[string]map[string]int)}
+
+	var bucket map[string]int
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, count, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+
+		if len(hash) == breachPrefixLength && count == "" {
+			bucket = list.buckets[hash]
+			if bucket == nil {
+				bucket = make(map[string]int)
+				list.buckets[hash] = bucket
+			}
+			continue
+		}
+
+		if bucket == nil {
+			return nil, fmt.Errorf("breach list line %d: hash outside of a bucket", line)
+		}
+		if len(hash) != sha1.Size*2-breachPrefixLength {
+			return nil, fmt.Errorf("breach list line %d: invalid hash suffix %q", line, hash)
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("breach list line %d: invalid count: %w", line, err)
+		}
+		bucket[hash] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Range returns the hash suffixes in the bucket of the given prefix.
+func (l *BreachList) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	return l.buckets[strings.ToUpper(prefix)], nil
+}
@@ -0,0 +1,105 @@
+package hash
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names a password hashing algorithm.
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+	Scrypt   Algorithm = "scrypt"
+)
+
+// Config selects the algorithm used for new hashes and its parameters.
+// Only the parameters of the selected algorithm are used.
+type Config struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2id   Argon2idParams
+	Scrypt     ScryptParams
+}
+
+// Argon2idParams are the parameters of argon2id hashes.
+type Argon2idParams struct {
+	Memory      uint32 // memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// ScryptParams are the parameters of scrypt hashes.
+type ScryptParams struct {
+	LogN       uint8 // CPU/memory cost, N = 2^LogN
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+// DefaultConfig returns a Config that hashes with argon2id using 64 MiB of
+// memory, 3 iterations and 2 lanes.
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:  Argon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2id:   DefaultArgon2idParams(),
+		Scrypt:     DefaultScryptParams(),
+	}
+}
+
+// DefaultArgon2idParams returns the default argon2id parameters.
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// DefaultScryptParams returns the default scrypt parameters, N=2^15, r=8, p=1.
+func DefaultScryptParams() ScryptParams {
+	return ScryptParams{
+		LogN:       15,
+		R:          8,
+		P:          1,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+func (c Config) bcryptCost() int {
+	if c.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return c.BcryptCost
+}
+
+func (c Config) validate() error {
+	switch c.Algorithm {
+	case Bcrypt:
+		if cost := c.bcryptCost(); cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost %d out of range", cost)
+		}
+	case Argon2id:
+		p := c.Argon2id
+		if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 || p.SaltLength == 0 || p.KeyLength == 0 {
+			return fmt.Errorf("argon2id parameters must not be zero")
+		}
+	case Scrypt:
+		p := c.Scrypt
+		if p.LogN == 0 || p.LogN > 31 || p.R <= 0 || p.P <= 0 || p.SaltLength <= 0 || p.KeyLength <= 0 {
+			return fmt.Errorf("invalid scrypt parameters")
+		}
+	default:
+		return fmt.Errorf("unsupported hash algorithm %q", c.Algorithm)
+	}
+	return nil
+}
@@ -2,33 +2,71 @@ package hash
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrMismatchedHashAndPassword is returned by ComparePassword when the password
+	// does not match the hash, whatever the algorithm of the hash.
+	ErrMismatchedHashAndPassword = bcrypt.ErrMismatchedHashAndPassword
+
+	// ErrUnsupportedHash is returned when a hash is not in any supported format.
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+	// ErrInvalidHash is returned when a hash has a supported prefix but is malformed.
+	ErrInvalidHash = errors.New("invalid password hash")
+
+	// ErrEmptyPassword is returned by HashPassword for an empty password.
+	ErrEmptyPassword = errors.New("password must not be empty")
 )
 
 //go:generate mockgen -source=hash.go -destination=mocks/hash.go
 type HashPassword interface {
 	HashPassword(password string) (string, error)
 	ComparePassword(hashPassword string, password string) error
+	NeedsRehash(hashPassword string) bool
 }
 
-type Hashing struct{}
+type Hashing struct {
+	cfg Config
+}
 
 // NewHashingPassword initializes a new Hashing instance for hashing and comparing passwords.
+// New hashes are created with bcrypt at DefaultCost; use NewHashing to choose another algorithm.
 //
 // Returns:
 //   - HashPassword: The initialized Hashing instance.
 func NewHashingPassword() HashPassword {
-	return &Hashing{}
+	return &Hashing{cfg: Config{Algorithm: Bcrypt, BcryptCost: bcrypt.DefaultCost}}
+}
+
+// NewHashing initializes a new Hashing instance that creates hashes with the
+// algorithm and parameters of the given config. Hashes of every supported
+// algorithm can still be compared, so existing passwords keep working.
+//
+// Parameters:
+//   - cfg: The algorithm and its parameters (Config)
+//
+// Returns:
+//   - HashPassword: The initialized Hashing instance.
+//   - error: An error if the config is invalid (error)
+func NewHashing(cfg Config) (HashPassword, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Hashing{cfg: cfg}, nil
 }
 
 // HashPassword takes a plaintext password and returns a hashed version of the password.
 // The hashed password is a string that can be safely stored in a database or other
-// secure storage.
+// secure storage. Argon2id and scrypt hashes are encoded as PHC strings, bcrypt
+// hashes in their usual modular crypt format. Passwords should be checked with
+// Policy.Validate first; HashPassword itself only rejects empty passwords.
 //
 // Parameters:
 //   - password: The plaintext password to be hashed (string)
@@ -37,23 +75,90 @@ func NewHashingPassword() HashPassword {
 //   - string: The hashed version of the password (string)
 //   - error: Any error encountered while hashing the password (error)
 func (h Hashing) HashPassword(password string) (string, error) {
-	pw := []byte(password)
-	hashedPw, err := bcrypt.GenerateFromPassword(pw, bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	switch h.cfg.Algorithm {
+	case Argon2id:
+		return hashArgon2id(password, h.cfg.Argon2id)
+	case Scrypt:
+		return hashScrypt(password, h.cfg.Scrypt)
+	default:
+		hashedPw, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.bcryptCost())
+		if err != nil {
+			return "", err
+		}
+		return string(hashedPw), nil
 	}
-	return string(hashedPw), nil
 }
 
 // ComparePassword takes a hashed password and a plaintext password and
-// returns an error if the passwords do not match.
+// returns an error if the passwords do not match. The algorithm is taken from
+// the hash, so bcrypt, argon2id and scrypt hashes are all accepted.
 //
 // Parameters:
 //   - hashPassword: The hashed password to compare against (string)
 //   - password: The plaintext password to compare to the hashed password (string)
 //
 // Returns:
-//   - error: nil if the passwords match, otherwise an error (error)
+//   - error: nil if the passwords match, ErrMismatchedHashAndPassword if they do not,
+//     otherwise an error describing the malformed hash (error)
 func (h Hashing) ComparePassword(hashPassword string, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+	switch algorithmOf(hashPassword) {
+	case Argon2id:
+		return compareArgon2id(hashPassword, password)
+	case Scrypt:
+		return compareScrypt(hashPassword, password)
+	case Bcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+	default:
+		return ErrUnsupportedHash
+	}
+}
+
+// NeedsRehash reports whether the hash was created with another algorithm or
+// other parameters than the ones configured. After a successful ComparePassword
+// the caller should then hash the password again and store the result, see
+// UpgradePassword.
+//
+// Parameters:
+//   - hashPassword: The stored hashed password (string)
+//
+// Returns:
+//   - bool: true if the hash should be replaced (bool)
+func (h Hashing) NeedsRehash(hashPassword string) bool {
+	if algorithmOf(hashPassword) != h.cfg.Algorithm {
+		return true
+	}
+
+	switch h.cfg.Algorithm {
+	case Argon2id:
+		params, _, _, err := decodeArgon2id(hashPassword)
+		return err != nil || params != h.cfg.Argon2id
+	case Scrypt:
+		params, _, _, err := decodeScrypt(hashPassword)
+		return err != nil || params != h.cfg.Scrypt
+	default:
+		cost, err := bcrypt.Cost([]byte(hashPassword))
+		return err != nil || cost != h.cfg.bcryptCost()
+	}
+}
+
+// algorithmOf returns the algorithm a hash was created with, or "" if unknown.
+func algorithmOf(hash string) Algorithm {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$scrypt$"):
+		return Scrypt
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	default:
+		return ""
+	}
+}
+
+func invalidHash(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidHash, fmt.Sprintf(format, args...))
 }
@@ -1,9 +1,13 @@
 package hash
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -45,3 +49,128 @@ func TestComparePassword_Failure(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, bcrypt.ErrMismatchedHashAndPassword, err)
 }
+
+func testConfig(algorithm Algorithm) Config {
+	return Config{
+		Algorithm:  algorithm,
+		BcryptCost: bcrypt.MinCost,
+		Argon2id:   Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		Scrypt:     ScryptParams{LogN: 10, R: 8, P: 1, SaltLength: 16, KeyLength: 32},
+	}
+}
+
+// TestHashing_Algorithms tests hashing and comparing with every supported algorithm
+func TestHashing_Algorithms(t *testing.T) {
+	prefixes := map[Algorithm]string{
+		Bcrypt:   "$2a$04$",
+		Argon2id: "$argon2id$v=19$m=1024,t=1,p=1$",
+		Scrypt:   "$scrypt$ln=10,r=8,p=1$",
+	}
+
+	for algorithm, prefix := range prefixes {
+		t.Run(string(algorithm), func(t *testing.T) {
+			hasher, err := NewHashing(testConfig(algorithm))
+			require.NoError(t, err)
+
+			hashed, err := hasher.HashPassword("correctPassword")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hashed, prefix), hashed)
+
+			assert.NoError(t, hasher.ComparePassword(hashed, "correctPassword"))
+			assert.Equal(t, ErrMismatchedHashAndPassword, hasher.ComparePassword(hashed, "wrongPassword"))
+			assert.False(t, hasher.NeedsRehash(hashed))
+		})
+	}
+}
+
+// TestHashing_CompareAnyFormat tests that hashes of other algorithms are still accepted
+func TestHashing_CompareAnyFormat(t *testing.T) {
+	legacy, err := NewHashingPassword().HashPassword("correctPassword")
+	require.NoError(t, err)
+
+	hasher, err := NewHashing(testConfig(Argon2id))
+	require.NoError(t, err)
+
+	assert.NoError(t, hasher.ComparePassword(legacy, "correctPassword"))
+	assert.True(t, hasher.NeedsRehash(legacy))
+
+	assert.ErrorIs(t, hasher.ComparePassword("plaintext", "plaintext"), ErrUnsupportedHash)
+	assert.ErrorIs(t, hasher.ComparePassword("$argon2id$v=19$m=1024$abc", "x"), ErrInvalidHash)
+}
+
+// TestHashing_CompareZeroParameters tests that zero cost parameters are rejected
+// instead of panicking in the key derivation
+func TestHashing_CompareZeroParameters(t *testing.T) {
+	hasher, err := NewHashing(testConfig(Argon2id))
+	require.NoError(t, err)
+
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$scrypt$ln=10,r=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$scrypt$ln=10,r=8,p=0$c2FsdHNhbHQ$a2V5a2V5",
+	} {
+		assert.ErrorIs(t, hasher.ComparePassword(hash, "x"), ErrInvalidHash, hash)
+	}
+}
+
+// TestHashing_NeedsRehashOnParameterChange tests that weaker parameters are upgraded
+func TestHashing_NeedsRehashOnParameterChange(t *testing.T) {
+	weak, err := NewHashing(testConfig(Argon2id))
+	require.NoError(t, err)
+
+	hashed, err := weak.HashPassword("correctPassword")
+	require.NoError(t, err)
+
+	cfg := testConfig(Argon2id)
+	cfg.Argon2id.Iterations = 2
+	strong, err := NewHashing(cfg)
+	require.NoError(t, err)
+
+	assert.NoError(t, strong.ComparePassword(hashed, "correctPassword"))
+	assert.True(t, strong.NeedsRehash(hashed))
+}
+
+// TestNewHashing_InvalidConfig tests that invalid configs are rejected
+func TestNewHashing_InvalidConfig(t *testing.T) {
+	_, err := NewHashing(Config{Algorithm: "md5"})
+	assert.Error(t, err)
+
+	_, err = NewHashing(Config{Algorithm: Argon2id})
+	assert.Error(t, err)
+
+	_, err = NewHashing(DefaultConfig())
+	assert.NoError(t, err)
+}
+
+type passwordUpdaterFunc func(ctx context.Context, arg db.UpdateUserPasswordParams) (*db.User, error)
+
+func (f passwordUpdaterFunc) UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) (*db.User, error) {
+	return f(ctx, arg)
+}
+
+// TestUpgradePassword tests that a bcrypt hash is replaced on login
+func TestUpgradePassword(t *testing.T) {
+	legacy, err := NewHashingPassword().HashPassword("correctPassword")
+	require.NoError(t, err)
+
+	hasher, err := NewHashing(testConfig(Argon2id))
+	require.NoError(t, err)
+
+	var saved db.UpdateUserPasswordParams
+	users := passwordUpdaterFunc(func(ctx context.Context, arg db.UpdateUserPasswordParams) (*db.User, error) {
+		saved = arg
+		return &db.User{UserID: arg.UserID, Password: arg.Password}, nil
+	})
+
+	upgraded, err := UpgradePassword(context.Background(), hasher, users, 7, legacy, "correctPassword")
+	require.NoError(t, err)
+	assert.True(t, upgraded)
+	assert.Equal(t, int32(7), saved.UserID)
+	assert.NoError(t, hasher.ComparePassword(saved.Password, "correctPassword"))
+
+	upgraded, err = UpgradePassword(context.Background(), hasher, users, 7, saved.Password, "correctPassword")
+	require.NoError(t, err)
+	assert.False(t, upgraded)
+}
@@ -67,3 +67,17 @@ func (mr *MockHashPasswordMockRecorder) HashPassword(password any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashPassword", reflect.TypeOf((*MockHashPassword)(nil).HashPassword), password)
 }
+
+// NeedsRehash mocks base method.
+func (m *MockHashPassword) NeedsRehash(hashPassword string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NeedsRehash", hashPassword)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// NeedsRehash indicates an expected call of NeedsRehash.
+func (mr *MockHashPasswordMockRecorder) NeedsRehash(hashPassword any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NeedsRehash", reflect.TypeOf((*MockHashPassword)(nil).NeedsRehash), hashPassword)
+}
@@ -0,0 +1,164 @@
+package hash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PHC strings encode salt and hash in standard base64 without padding.
+var b64 = base64.RawStdEncoding
+
+// hashArgon2id returns the PHC string of the password:
+//
+//	$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+func hashArgon2id(password string, p Argon2idParams) (string, error) {
+	salt, err := randomSalt(int(p.SaltLength))
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func compareArgon2id(hash, password string) error {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return compareKeys(key, other)
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, invalidHash("argon2id hash has %d fields", len(parts))
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, invalidHash("argon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, invalidHash("argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, invalidHash("argon2id parameters: %v", err)
+	}
+	if p.Memory < 1 || p.Iterations < 1 || p.Parallelism < 1 {
+		return p, nil, nil, invalidHash("argon2id m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// hashScrypt returns the PHC string of the password:
+//
+//	$scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>
+func hashScrypt(password string, p ScryptParams) (string, error) {
+	salt, err := randomSalt(p.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		p.LogN, p.R, p.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func compareScrypt(hash, password string) error {
+	p, salt, key, err := decodeScrypt(hash)
+	if err != nil {
+		return err
+	}
+
+	other, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLength)
+	if err != nil {
+		return invalidHash("scrypt parameters: %v", err)
+	}
+	return compareKeys(key, other)
+}
+
+func decodeScrypt(hash string) (ScryptParams, []byte, []byte, error) {
+	var p ScryptParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return p, nil, nil, invalidHash("scrypt hash has %d fields", len(parts))
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.LogN, &p.R, &p.P); err != nil {
+		return p, nil, nil, invalidHash("scrypt parameters: %v", err)
+	}
+	if p.LogN == 0 || p.LogN > 31 {
+		return p, nil, nil, invalidHash("scrypt ln=%d", p.LogN)
+	}
+	if p.R < 1 || p.P < 1 {
+		return p, nil, nil, invalidHash("scrypt r=%d,p=%d", p.R, p.P)
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	p.SaltLength = len(salt)
+	p.KeyLength = len(key)
+
+	return p, salt, key, nil
+}
+
+func decodeSaltAndKey(encodedSalt, encodedKey string) ([]byte, []byte, error) {
+	salt, err := b64.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, invalidHash("salt: %v", err)
+	}
+
+	key, err := b64.DecodeString(encodedKey)
+	if err != nil {
+		return nil, nil, invalidHash("key: %v", err)
+	}
+	if len(key) == 0 {
+		return nil, nil, invalidHash("empty key")
+	}
+
+	return salt, key, nil
+}
+
+func compareKeys(key, other []byte) error {
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+func randomSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
@@ -0,0 +1,203 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrPasswordPolicy is matched by every *PolicyError, so callers can use
+// errors.Is(err, ErrPasswordPolicy) before extracting the violations.
+var ErrPasswordPolicy = errors.New("password does not satisfy policy")
+
+// Violation codes reported by Policy.Validate.
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationMissingUpper  = "missing_upper"
+	ViolationMissingLower  = "missing_lower"
+	ViolationMissingDigit  = "missing_digit"
+	ViolationMissingSymbol = "missing_symbol"
+	ViolationPersonalInfo  = "contains_personal_info"
+	ViolationBannedWord    = "contains_banned_word"
+	ViolationBreached      = "breached"
+)
+
+// minPersonalInfoFragment is the shortest name or email part checked by Validate.
+const minPersonalInfoFragment = 3
+
+// Violation is one rule of the policy a password does not satisfy. Message is
+// meant to be shown to the user, Code to be matched by clients.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password violates.
+type PolicyError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrPasswordPolicy, strings.Join(messages, "; "))
+}
+
+// Is reports whether target is ErrPasswordPolicy.
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPasswordPolicy
+}
+
+// Has reports whether the error contains a violation with the given code.
+func (e *PolicyError) Has(code string) bool {
+	for _, v := range e.Violations {
+		if v.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordOwner holds the details of the user a password belongs to. None of
+// them may appear in the password.
+type PasswordOwner struct {
+	Email     string
+	Firstname string
+	Lastname  string
+}
+
+// Policy describes the passwords users may choose.
+type Policy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MaxLength is the maximum number of bytes. bcrypt ignores everything past
+	// 72 bytes, so longer passwords would be silently truncated.
+	MaxLength int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// BannedWords may not appear in the password, compared case-insensitively.
+	BannedWords []string
+
+	// Breached, when set, is used to reject passwords found in known breaches.
+	Breached BreachedPasswords
+}
+
+// DefaultPolicy returns a Policy requiring 8 to 72 bytes with upper case,
+// lower case and digit characters.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:    8,
+		MaxLength:    72,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+	}
+}
+
+// Validate checks the password against the policy and returns a *PolicyError
+// listing every violation, or nil if the password is acceptable. Other errors
+// are only returned when the breached password list cannot be queried.
+//
+// Parameters:
+//   - ctx: The context used for the breached password lookup (context.Context)
+//   - password: The plaintext password chosen by the user (string)
+//   - owner: The user the password belongs to (PasswordOwner)
+//
+// Returns:
+//   - error: nil if the password satisfies the policy, otherwise an error (error)
+func (p Policy) Validate(ctx context.Context, password string, owner PasswordOwner) error {
+	var violations []Violation
+	add := func(code, format string, args ...any) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		add(ViolationTooShort, "Password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add(ViolationTooLong, "Password must be at most %d bytes long", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add(ViolationMissingUpper, "Password must contain an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		add(ViolationMissingLower, "Password must contain a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		add(ViolationMissingDigit, "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(ViolationMissingSymbol, "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	for _, fragment := range owner.fragments() {
+		if strings.Contains(lowered, fragment) {
+			add(ViolationPersonalInfo, "Password must not contain your name or email")
+			break
+		}
+	}
+	for _, word := range p.BannedWords {
+		if word != "" && strings.Contains(lowered, strings.ToLower(word)) {
+			add(ViolationBannedWord, "Password must not contain %q", word)
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		count, err := CheckBreached(ctx, p.Breached, password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %w", err)
+		}
+		if count > 0 {
+			add(ViolationBreached, "Password has appeared in a data breach, please choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// fragments returns the lower cased parts of the owner details that may not
+// appear in a password. Fragments shorter than three characters are ignored,
+// they would reject too many passwords.
+func (o PasswordOwner) fragments() []string {
+	var fragments []string
+	add := func(s string) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len([]rune(s)) >= minPersonalInfoFragment {
+			fragments = append(fragments, s)
+		}
+	}
+
+	local, _, _ := strings.Cut(o.Email, "@")
+	add(local)
+	add(o.Firstname)
+	add(o.Lastname)
+
+	return fragments
+}
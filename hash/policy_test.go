@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+
+	var policyErr *PolicyError
+	require.True(t, errors.As(err, &policyErr), "expected a *PolicyError, got %v", err)
+	assert.ErrorIs(t, err, ErrPasswordPolicy)
+
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+// TestPolicy_Validate tests that every violated rule is reported
+func TestPolicy_Validate(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.RequireSymbol = true
+	policy.BannedWords = []string{"gateway"}
+
+	owner := PasswordOwner{Email: "budi.santoso@example.com", Firstname: "Budi", Lastname: "Santoso"}
+	ctx := context.Background()
+
+	assert.NoError(t, policy.Validate(ctx, "Kopi-Tubruk42", owner))
+
+	assert.ElementsMatch(t,
+		[]string{ViolationTooShort, ViolationMissingUpper, ViolationMissingDigit, ViolationMissingSymbol},
+		violationCodes(t, policy.Validate(ctx, "abc", owner)))
+
+	assert.Equal(t, []string{ViolationTooLong}, violationCodes(t, policy.Validate(ctx, "Aa1!"+strings.Repeat("x", 72), owner)))
+	assert.Equal(t, []string{ViolationPersonalInfo}, violationCodes(t, policy.Validate(ctx, "Santoso#2024", owner)))
+	assert.Equal(t, []string{ViolationBannedWord}, violationCodes(t, policy.Validate(ctx, "MyGateway#2024", owner)))
+}
+
+// TestPolicy_Breached tests that passwords in the breach list are rejected
+func TestPolicy_Breached(t *testing.T) {
+	sum := sha1.Sum([]byte("P@ssw0rd123"))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	list, err := ReadBreachList(strings.NewReader(
+		"# sample\n" +
+			digest[:5] + ":\n" +
+			digest[5:] + ":52\n" +
+			"0018A45C4D1DEF81644B54AB7F969B88D65:1\n",
+	))
+	require.NoError(t, err)
+
+	count, err := CheckBreached(context.Background(), list, "P@ssw0rd123")
+	require.NoError(t, err)
+	assert.Equal(t, 52, count)
+
+	policy := DefaultPolicy()
+	policy.Breached = list
+
+	err = policy.Validate(context.Background(), "P@ssw0rd123", PasswordOwner{})
+	assert.Equal(t, []string{ViolationBreached}, violationCodes(t, err))
+	assert.NoError(t, policy.Validate(context.Background(), "Kopi-Tubruk42", PasswordOwner{}))
+}
+
+// TestReadBreachList_Invalid tests that malformed lists are rejected
+func TestReadBreachList_Invalid(t *testing.T) {
+	_, err := ReadBreachList(strings.NewReader("0018A45C4D1DEF81644B54AB7F969B88D65:1\n"))
+	assert.Error(t, err)
+
+	_, err = ReadBreachList(strings.NewReader("21BD1:\nABC:1\n"))
+	assert.Error(t, err)
+
+	_, err = ReadBreachList(strings.NewReader("21BD1:\n0018A45C4D1DEF81644B54AB7F969B88D65:x\n"))
+	assert.Error(t, err)
+}
+
+// TestHashPassword_Empty tests that empty passwords are not hashed
+func TestHashPassword_Empty(t *testing.T) {
+	_, err := NewHashingPassword().HashPassword("")
+	assert.ErrorIs(t, err, ErrEmptyPassword)
+}
@@ -0,0 +1,48 @@
+package hash
+
+import (
+	"context"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+)
+
+// PasswordUpdater stores a new password hash for a user.
+// It is implemented by *db.Queries.
+type PasswordUpdater interface {
+	UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) (*db.User, error)
+}
+
+// UpgradePassword rehashes the password of a user whose stored hash NeedsRehash
+// and saves the new hash with UpdateUserPassword. It must only be called after
+// ComparePassword succeeded, typically during login.
+//
+// Parameters:
+//   - ctx: The context of the login request (context.Context)
+//   - hasher: The hasher configured with the current algorithm (HashPassword)
+//   - users: Where the new hash is stored (PasswordUpdater)
+//   - userID: The ID of the user (int32)
+//   - hashPassword: The stored hashed password (string)
+//   - password: The plaintext password that matched the stored hash (string)
+//
+// Returns:
+//   - bool: true if a new hash was stored (bool)
+//   - error: Any error encountered while hashing or storing the password (error)
+func UpgradePassword(ctx context.Context, hasher HashPassword, users PasswordUpdater, userID int32, hashPassword string, password string) (bool, error) {
+	if !hasher.NeedsRehash(hashPassword) {
+		return false, nil
+	}
+
+	hashed, err := hasher.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := users.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		UserID:   userID,
+		Password: hashed,
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
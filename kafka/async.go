@@ -0,0 +1,308 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxInFlight is the number of messages an AsyncPublisher buffers
+// unless another limit is given.
+const DefaultMaxInFlight = 1024
+
+// ErrPublisherClosed is returned when publishing on a closed AsyncPublisher.
+var ErrPublisherClosed = errors.New("kafka publisher closed")
+
+// Delivery is the outcome of publishing one message.
+type Delivery struct {
+	Topic     string
+	Key       string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// Callback receives the outcome of a published message. Callbacks run on the
+// goroutine reading the producer results and must not block.
+type Callback func(Delivery)
+
+// Future is the pending outcome of a message published with PublishFuture.
+type Future struct {
+	done     chan struct{}
+	delivery Delivery
+}
+
+// Done is closed once the outcome of the message is known.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the message is delivered or failed, or ctx is done. The
+// returned error is the delivery error or the context error.
+func (f *Future) Wait(ctx context.Context) (Delivery, error) {
+	select {
+	case <-f.done:
+		return f.delivery, f.delivery.Err
+	case <-ctx.Done():
+		return Delivery{}, ctx.Err()
+	}
+}
+
+// pending is attached to every message as its Metadata.
+type pending struct {
+	key      string
+	callback Callback
+	future   *Future
+	span     trace.Span
+}
+
+// AsyncPublisher publishes messages through a sarama.AsyncProducer, which
+// batches them per partition according to the Producer.Flush settings, see
+// WithBatching.
+//
+// At most maxInFlight messages are buffered; Publish blocks once the limit is
+// reached until earlier messages are acknowledged. The outcome of every message
+// is reported through its callback or future, and failures are also logged.
+type AsyncPublisher struct {
+	producer sarama.AsyncProducer
+	logger   logger.LoggerInterface
+	tracing  *Tracing
+	slots    chan struct{}
+	results  sync.WaitGroup
+
+	// input is held for reading while a message is handed to the producer and
+	// for writing while the producer is closed.
+	input sync.RWMutex
+
+	mu      sync.Mutex
+	closed  bool
+	pending int
+	idle    chan struct{}
+}
+
+// NewAsync connects an AsyncPublisher to the given brokers.
+//
+// The producer starts from DefaultConfig and applies the options like New does.
+// A maxInFlight of zero or less uses DefaultMaxInFlight.
+func NewAsync(logger logger.LoggerInterface, brokers []string, maxInFlight int, opts ...Option) (*AsyncPublisher, error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOption, err)
+	}
+
+	producer, err := sarama.NewAsyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+
+	logger.Info("Kafka async producer connected successfully")
+
+	return NewAsyncPublisher(producer, maxInFlight, logger), nil
+}
+
+// NewAsyncPublisher wraps an existing producer, such as a sarama mocks.AsyncProducer
+// in tests. The producer must return successes and errors.
+//
+// Parameters:
+//   - producer: The producer used to send messages (sarama.AsyncProducer)
+//   - maxInFlight: The maximum number of unacknowledged messages, or zero for DefaultMaxInFlight (int)
+//   - logger: The logger used to report failed deliveries (logger.LoggerInterface)
+//
+// Returns:
+//   - *AsyncPublisher: The publisher, already reading the producer results
+func NewAsyncPublisher(producer sarama.AsyncProducer, maxInFlight int, logger logger.LoggerInterface) *AsyncPublisher {
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+
+	p := &AsyncPublisher{
+		producer: producer,
+		logger:   logger,
+		tracing:  NewTracing(),
+		slots:    make(chan struct{}, maxInFlight),
+	}
+
+	p.results.Add(2)
+	go func() {
+		defer p.results.Done()
+		for msg := range producer.Successes() {
+			p.complete(msg, nil)
+		}
+	}()
+	go func() {
+		defer p.results.Done()
+		for perr := range producer.Errors() {
+			p.complete(perr.Msg, perr.Err)
+		}
+	}()
+
+	return p
+}
+
+// SetTracing replaces the Tracing used by p, which defaults to NewTracing(). It
+// must be called before publishing.
+func (p *AsyncPublisher) SetTracing(tracing *Tracing) {
+	p.tracing = tracing
+}
+
+// Publish queues a message for the topic and returns without waiting for it to
+// be written. The callback, which may be nil, receives the outcome. Publish
+// blocks while maxInFlight messages are buffered and returns the context error
+// if ctx is done first. The message is sent inside a producer span, a child of
+// the span of ctx, which ends once the outcome is known.
+func (p *AsyncPublisher) Publish(ctx context.Context, topic string, key string, value []byte, callback Callback) error {
+	return p.publish(ctx, topic, key, value, &pending{key: key, callback: callback})
+}
+
+// PublishFuture is like Publish but returns a Future for the outcome.
+func (p *AsyncPublisher) PublishFuture(ctx context.Context, topic string, key string, value []byte) (*Future, error) {
+	future := &Future{done: make(chan struct{})}
+	if err := p.publish(ctx, topic, key, value, &pending{key: key, future: future}); err != nil {
+		return nil, err
+	}
+	return future, nil
+}
+
+// Flush waits until every published message has been acknowledged or failed, or
+// ctx is done.
+func (p *AsyncPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	if p.pending == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, flushes the buffered ones and closes the
+// producer. Messages still pending when ctx is done are failed by the producer
+// as it shuts down, and the context error is returned.
+func (p *AsyncPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPublisherClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	err := p.Flush(ctx)
+
+	p.input.Lock()
+	p.producer.AsyncClose()
+	p.input.Unlock()
+	p.results.Wait()
+
+	return err
+}
+
+func (p *AsyncPublisher) publish(ctx context.Context, topic string, key string, value []byte, meta *pending) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.input.RLock()
+	defer p.input.RUnlock()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return ErrPublisherClosed
+	}
+	if p.pending == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.pending++
+	p.mu.Unlock()
+
+	msg := &sarama.ProducerMessage{
+		Topic:    topic,
+		Key:      sarama.StringEncoder(key),
+		Value:    sarama.ByteEncoder(value),
+		Metadata: meta,
+	}
+	_, meta.span = p.tracing.StartProducer(ctx, msg)
+
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		p.tracing.EndProducer(meta.span, msg, ctx.Err())
+		p.release()
+		return ctx.Err()
+	}
+}
+
+func (p *AsyncPublisher) complete(msg *sarama.ProducerMessage, err error) {
+	meta, ok := msg.Metadata.(*pending)
+	if !ok {
+		return
+	}
+
+	delivery := Delivery{
+		Topic:     msg.Topic,
+		Key:       meta.key,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Err:       err,
+	}
+
+	if err != nil {
+		p.logger.Error("Failed to deliver kafka message",
+			zap.String("topic", msg.Topic),
+			zap.String("key", meta.key),
+			zap.Error(err),
+		)
+	}
+
+	if meta.span != nil {
+		p.tracing.EndProducer(meta.span, msg, err)
+	}
+
+	if meta.callback != nil {
+		meta.callback(delivery)
+	}
+	if meta.future != nil {
+		meta.future.delivery = delivery
+		close(meta.future.done)
+	}
+
+	p.release()
+}
+
+// release frees the slot and the pending count of a message.
+func (p *AsyncPublisher) release() {
+	<-p.slots
+
+	p.mu.Lock()
+	p.pending--
+	if p.pending == 0 {
+		close(p.idle)
+	}
+	p.mu.Unlock()
+}
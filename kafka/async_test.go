@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newMockPublisher(t *testing.T, maxInFlight int) (*AsyncPublisher, *mocks.AsyncProducer) {
+	t.Helper()
+
+	producer := mocks.NewAsyncProducer(t, DefaultConfig())
+	return NewAsyncPublisher(producer, maxInFlight, &logger.Logger{Log: zap.NewNop()}), producer
+}
+
+func TestAsyncPublisher_Callbacks(t *testing.T) {
+	p, producer := newMockPublisher(t, 0)
+	ctx := context.Background()
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	producer.ExpectInputAndSucceed()
+
+	var (
+		mu         sync.Mutex
+		deliveries []Delivery
+	)
+	record := func(d Delivery) {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, d)
+	}
+
+	require.NoError(t, p.Publish(ctx, "transactions", "tx-1", []byte("a"), record))
+	require.NoError(t, p.Publish(ctx, "transactions", "tx-2", []byte("b"), record))
+	require.NoError(t, p.Publish(ctx, "transactions", "tx-3", []byte("c"), nil))
+
+	require.NoError(t, p.Flush(ctx))
+
+	mu.Lock()
+	require.Len(t, deliveries, 2)
+	byKey := map[string]Delivery{}
+	for _, d := range deliveries {
+		byKey[d.Key] = d
+	}
+	mu.Unlock()
+
+	assert.NoError(t, byKey["tx-1"].Err)
+	assert.Equal(t, "transactions", byKey["tx-1"].Topic)
+	assert.ErrorIs(t, byKey["tx-2"].Err, sarama.ErrNotLeaderForPartition)
+
+	require.NoError(t, p.Close(ctx))
+}
+
+func TestAsyncPublisher_Future(t *testing.T) {
+	p, producer := newMockPublisher(t, 0)
+	ctx := context.Background()
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+
+	ok, err := p.PublishFuture(ctx, "transactions", "tx-1", []byte("a"))
+	require.NoError(t, err)
+	failed, err := p.PublishFuture(ctx, "transactions", "tx-2", []byte("b"))
+	require.NoError(t, err)
+
+	delivery, err := ok.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "tx-1", delivery.Key)
+
+	_, err = failed.Wait(ctx)
+	assert.ErrorIs(t, err, sarama.ErrMessageSizeTooLarge)
+
+	require.NoError(t, p.Close(ctx))
+}
+
+func TestAsyncPublisher_MaxInFlight(t *testing.T) {
+	p, _ := newMockPublisher(t, 1)
+
+	// Occupy the only slot, as an unacknowledged message would.
+	p.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := p.Publish(ctx, "transactions", "tx-1", []byte("a"), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	<-p.slots
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func TestAsyncPublisher_Close(t *testing.T) {
+	p, producer := newMockPublisher(t, 0)
+	ctx := context.Background()
+
+	producer.ExpectInputAndSucceed()
+	future, err := p.PublishFuture(ctx, "transactions", "tx-1", []byte("a"))
+	require.NoError(t, err)
+
+	require.NoError(t, p.Close(ctx))
+	select {
+	case <-future.Done():
+	default:
+		t.Fatal("Close returned before the buffered message was delivered")
+	}
+
+	assert.ErrorIs(t, p.Publish(ctx, "transactions", "tx-2", []byte("b"), nil), ErrPublisherClosed)
+	assert.ErrorIs(t, p.Close(ctx), ErrPublisherClosed)
+}
@@ -0,0 +1,260 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ErrRetriesExhausted is returned by Consumer.Wait when the consumer stopped
+// because Consume kept failing after Backoff.MaxRetries attempts.
+var ErrRetriesExhausted = errors.New("kafka consumer retries exhausted")
+
+// Backoff controls the delay between attempts to rejoin the consumer group after
+// Consume fails. The delay starts at Initial and is multiplied by Multiplier
+// after every consecutive failure, up to Max.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// MaxRetries stops the consumer after that many consecutive failures. Zero
+	// retries forever.
+	MaxRetries int
+}
+
+// DefaultBackoff returns a Backoff starting at one second, doubling up to 30
+// seconds and retrying forever.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Initial:    time.Second,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+	}
+}
+
+// Delay returns the delay before the given attempt, counted from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Initial <= 0 || attempt <= 0 {
+		return 0
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(b.Initial)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if b.Max > 0 && delay >= float64(b.Max) {
+			return b.Max
+		}
+	}
+	return time.Duration(delay)
+}
+
+// ConsumerOption configures a Consumer started by StartConsumers.
+type ConsumerOption func(*consumerOptions)
+
+type consumerOptions struct {
+	backoff       Backoff
+	errorHandler  func(error)
+	initialOffset int64
+}
+
+// WithBackoff replaces DefaultBackoff.
+func WithBackoff(backoff Backoff) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithErrorHandler receives every consumer error instead of the Errors channel.
+// The handler runs on the consumer goroutines and must not block.
+func WithErrorHandler(handler func(error)) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.errorHandler = handler
+	}
+}
+
+// WithInitialOffset sets where a group without committed offsets starts,
+// sarama.OffsetNewest by default or sarama.OffsetOldest.
+func WithInitialOffset(offset int64) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.initialOffset = offset
+	}
+}
+
+// Consumer is a running consumer group started by StartConsumers.
+//
+// It consumes until the context passed to StartConsumers is done or Stop is
+// called, rejoining the group with backoff when Consume fails. On shutdown the
+// group is closed, so its partitions are handed to the remaining members right
+// away instead of after the session timeout.
+type Consumer struct {
+	group   sarama.ConsumerGroup
+	topics  []string
+	handler sarama.ConsumerGroupHandler
+	opts    consumerOptions
+	logger  logger.LoggerInterface
+
+	cancel context.CancelFunc
+	errs   chan error
+	done   chan struct{}
+	err    error
+}
+
+// StartConsumers joins the consumer group groupID and consumes the topics with
+// the handler until ctx is done or the returned Consumer is stopped.
+//
+// The consumer uses the client ID, version, TLS and SASL settings given to New.
+// Handlers must return from ConsumeClaim once session.Context() is done, so the
+// group can rebalance. Errors are reported through Consumer.Errors or the
+// handler given WithErrorHandler; they never exit the process.
+func (k *Kafka) StartConsumers(ctx context.Context, topics []string, groupID string, handler sarama.ConsumerGroupHandler, opts ...ConsumerOption) (*Consumer, error) {
+	o := consumerOptions{
+		backoff:       DefaultBackoff(),
+		initialOffset: sarama.OffsetNewest,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	config := k.consumerConfig()
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = o.initialOffset
+
+	group, err := sarama.NewConsumerGroup(k.brokers, groupID, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer group: %w", err)
+	}
+
+	return startConsumer(ctx, group, topics, handler, o, k.logger), nil
+}
+
+func startConsumer(ctx context.Context, group sarama.ConsumerGroup, topics []string, handler sarama.ConsumerGroupHandler, opts consumerOptions, logger logger.LoggerInterface) *Consumer {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := &Consumer{
+		group:   group,
+		topics:  topics,
+		handler: handler,
+		opts:    opts,
+		logger:  logger,
+		cancel:  cancel,
+		errs:    make(chan error, 16),
+		done:    make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.consume(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		for err := range group.Errors() {
+			c.report(err)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(c.errs)
+		close(c.done)
+	}()
+
+	return c
+}
+
+// Errors returns the errors of the consumer. The channel is closed when the
+// consumer has stopped. Errors are dropped when nobody reads the channel, and
+// nothing is sent when WithErrorHandler was given.
+func (c *Consumer) Errors() <-chan error {
+	return c.errs
+}
+
+// Done is closed once the consumer has stopped and left the group.
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stop leaves the consumer group and waits for the consumer to stop. It returns
+// the same error as Wait.
+func (c *Consumer) Stop() error {
+	c.cancel()
+	return c.Wait()
+}
+
+// Wait blocks until the consumer has stopped. It returns nil when the consumer
+// was stopped through its context or Stop, and an error wrapping
+// ErrRetriesExhausted when it gave up rejoining the group.
+func (c *Consumer) Wait() error {
+	<-c.done
+	return c.err
+}
+
+func (c *Consumer) consume(ctx context.Context) {
+	defer func() {
+		if err := c.group.Close(); err != nil {
+			c.report(fmt.Errorf("failed to close consumer group: %w", err))
+		}
+	}()
+
+	failures := 0
+	for {
+		err := c.group.Consume(ctx, c.topics, c.handler)
+		if ctx.Err() != nil || errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return
+		}
+		if err == nil {
+			// The session ended because of a rebalance; join the next one.
+			failures = 0
+			continue
+		}
+
+		failures++
+		c.report(err)
+
+		if c.opts.backoff.MaxRetries > 0 && failures >= c.opts.backoff.MaxRetries {
+			c.err = fmt.Errorf("%w after %d attempts: %v", ErrRetriesExhausted, failures, err)
+			c.logger.Error("Kafka consumer stopped", zap.Strings("topics", c.topics), zap.Error(c.err))
+			return
+		}
+
+		delay := c.opts.backoff.Delay(failures)
+		c.logger.Info("Retrying kafka consumer",
+			zap.Strings("topics", c.topics),
+			zap.Int("attempt", failures),
+			zap.Duration("delay", delay),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Consumer) report(err error) {
+	c.logger.Error("Kafka consumer error", zap.Strings("topics", c.topics), zap.Error(err))
+
+	if c.opts.errorHandler != nil {
+		c.opts.errorHandler(err)
+		return
+	}
+
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
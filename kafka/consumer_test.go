@@ -0,0 +1,184 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeGroup returns the queued results from Consume, then blocks until ctx is
+// done like a healthy session would.
+type fakeGroup struct {
+	mu       sync.Mutex
+	results  []error
+	consumes int
+	closed   bool
+	errs     chan error
+}
+
+func newFakeGroup(results ...error) *fakeGroup {
+	return &fakeGroup{results: results, errs: make(chan error, 1)}
+}
+
+func (g *fakeGroup) Consume(ctx context.Context, _ []string, _ sarama.ConsumerGroupHandler) error {
+	g.mu.Lock()
+	g.consumes++
+	if len(g.results) > 0 {
+		err := g.results[0]
+		g.results = g.results[1:]
+		g.mu.Unlock()
+		return err
+	}
+	g.mu.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+func (g *fakeGroup) Errors() <-chan error { return g.errs }
+
+func (g *fakeGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.closed {
+		g.closed = true
+		close(g.errs)
+	}
+	return nil
+}
+
+func (g *fakeGroup) Pause(map[string][]int32)  {}
+func (g *fakeGroup) Resume(map[string][]int32) {}
+func (g *fakeGroup) PauseAll()                 {}
+func (g *fakeGroup) ResumeAll()                {}
+
+func (g *fakeGroup) state() (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.consumes, g.closed
+}
+
+func newTestConsumer(ctx context.Context, group sarama.ConsumerGroup, opts ...ConsumerOption) *Consumer {
+	o := consumerOptions{
+		backoff:       Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2},
+		initialOffset: sarama.OffsetNewest,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return startConsumer(ctx, group, []string{"transactions"}, nil, o, &logger.Logger{Log: zap.NewNop()})
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	assert.Equal(t, time.Duration(0), b.Delay(0))
+	assert.Equal(t, 100*time.Millisecond, b.Delay(1))
+	assert.Equal(t, 200*time.Millisecond, b.Delay(2))
+	assert.Equal(t, 800*time.Millisecond, b.Delay(4))
+	assert.Equal(t, time.Second, b.Delay(5))
+	assert.Equal(t, time.Second, b.Delay(50))
+
+	constant := Backoff{Initial: time.Second}
+	assert.Equal(t, time.Second, constant.Delay(3))
+}
+
+func TestConsumer_RetriesAndReportsErrors(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	group := newFakeGroup(errBroker, errBroker)
+
+	c := newTestConsumer(context.Background(), group)
+
+	require.ErrorIs(t, <-c.Errors(), errBroker)
+	require.ErrorIs(t, <-c.Errors(), errBroker)
+
+	require.Eventually(t, func() bool {
+		consumes, _ := group.state()
+		return consumes == 3
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, c.Stop())
+	_, closed := group.state()
+	assert.True(t, closed)
+
+	_, open := <-c.Errors()
+	assert.False(t, open)
+}
+
+func TestConsumer_StopsOnContextCancel(t *testing.T) {
+	group := newFakeGroup()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := newTestConsumer(ctx, group)
+	cancel()
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not stop after the context was cancelled")
+	}
+	assert.NoError(t, c.Wait())
+
+	_, closed := group.state()
+	assert.True(t, closed)
+}
+
+func TestConsumer_MaxRetries(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	group := newFakeGroup(errBroker, errBroker, errBroker, errBroker)
+
+	var (
+		mu       sync.Mutex
+		reported []error
+	)
+	c := newTestConsumer(context.Background(), group,
+		WithBackoff(Backoff{Initial: time.Millisecond, Multiplier: 2, MaxRetries: 3}),
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		}),
+	)
+
+	err := c.Wait()
+	require.ErrorIs(t, err, ErrRetriesExhausted)
+
+	consumes, closed := group.state()
+	assert.Equal(t, 3, consumes)
+	assert.True(t, closed)
+
+	mu.Lock()
+	assert.Len(t, reported, 3)
+	mu.Unlock()
+}
+
+func TestConsumer_RebalanceResetsRetries(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	// Two failures, a completed session, then two more failures: with MaxRetries
+	// 3 the consumer must keep running because the count restarts.
+	group := newFakeGroup(errBroker, errBroker, nil, errBroker, errBroker)
+
+	c := newTestConsumer(context.Background(), group,
+		WithBackoff(Backoff{Initial: time.Millisecond, MaxRetries: 3}),
+	)
+
+	require.Eventually(t, func() bool {
+		consumes, _ := group.state()
+		return consumes == 6
+	}, time.Second, time.Millisecond)
+
+	select {
+	case <-c.Done():
+		t.Fatal("consumer stopped although the retry count was reset")
+	default:
+	}
+	assert.NoError(t, c.Stop())
+}
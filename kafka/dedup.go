@@ -0,0 +1,207 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultDedupRetention is how long a RedisDedupStore remembers a message.
+const DefaultDedupRetention = 7 * 24 * time.Hour
+
+// DefaultDedupClaimTTL is how long a RedisDedupStore holds the claim of a
+// consumer that neither completed nor released it, e.g. because it crashed.
+const DefaultDedupClaimTTL = 2 * time.Hour
+
+// ErrMessageInProgress is returned by DedupStore.Claim while another consumer
+// holds the claim on a message.
+var ErrMessageInProgress = errors.New("kafka message is being processed")
+
+// DedupStore records which messages a consumer group has processed.
+type DedupStore interface {
+	// Claim atomically reserves the message with the idempotency key for the
+	// caller. It returns a nil Claim when the message was processed, and
+	// ErrMessageInProgress while another consumer holds a claim on it.
+	Claim(ctx context.Context, key string) (Claim, error)
+}
+
+// Claim is the reservation of a message by the consumer handling it. Exactly
+// one of Complete and Release must be called.
+type Claim interface {
+	// Context returns ctx carrying what the handler needs to write together
+	// with the record, such as the transaction of a PostgresDedupStore.
+	Context(ctx context.Context) context.Context
+	// Complete records the message as processed.
+	Complete(ctx context.Context) error
+	// Release gives the message up without recording it, so it can be claimed
+	// again.
+	Release(ctx context.Context) error
+}
+
+type txContextKey struct{}
+
+// TxFromContext returns the transaction a PostgresDedupStore claimed the
+// message in. Writes made through it commit together with the record of the
+// message, and roll back with it when the handler fails.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	return tx, ok && tx != nil
+}
+
+// PostgresDedupStore is a DedupStore backed by the processed_messages table.
+// A message is claimed by recording it in a transaction that stays open while
+// it is handled, so a concurrent claim waits for it and a failed or crashed
+// handler leaves no record.
+type PostgresDedupStore struct {
+	conn    *sql.DB
+	queries *db.Queries
+	group   string
+}
+
+// NewPostgresDedupStore creates a PostgresDedupStore for the consumer group.
+// Records are kept until Purge removes them.
+func NewPostgresDedupStore(conn *sql.DB, queries *db.Queries, group string) *PostgresDedupStore {
+	return &PostgresDedupStore{
+		conn:    conn,
+		queries: queries,
+		group:   group,
+	}
+}
+
+// Claim begins a transaction and records the message with the idempotency key
+// in it. The message was processed when it is already recorded.
+func (s *PostgresDedupStore) Claim(ctx context.Context, key string) (Claim, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.queries.WithTx(tx).CreateProcessedMessage(ctx, db.CreateProcessedMessageParams{
+		ConsumerGroup: s.group,
+		MessageKey:    key,
+	})
+	if err != nil || n == 0 {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &postgresClaim{tx: tx}, nil
+}
+
+// Purge deletes the records of messages processed before the given time by any
+// consumer group.
+func (s *PostgresDedupStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return s.queries.DeleteProcessedMessages(ctx, before)
+}
+
+type postgresClaim struct {
+	tx *sql.Tx
+}
+
+func (c *postgresClaim) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txContextKey{}, c.tx)
+}
+
+func (c *postgresClaim) Complete(ctx context.Context) error {
+	return c.tx.Commit()
+}
+
+func (c *postgresClaim) Release(ctx context.Context) error {
+	if err := c.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// RedisDedupStore is a DedupStore backed by Redis. Records expire after the
+// retention, which must be longer than messages can be redelivered.
+//
+// A message is claimed with SET NX before it is handled. Redis cannot record
+// the message in the same transaction as the writes of the handler, so a
+// message whose handler succeeded but whose record failed is handled again.
+type RedisDedupStore struct {
+	client    redis.UniversalClient
+	prefix    string
+	retention time.Duration
+	claimTTL  time.Duration
+}
+
+// NewRedisDedupStore creates a RedisDedupStore for the consumer group. A
+// retention of zero or less uses DefaultDedupRetention.
+func NewRedisDedupStore(client redis.UniversalClient, group string, retention time.Duration) *RedisDedupStore {
+	if retention <= 0 {
+		retention = DefaultDedupRetention
+	}
+	return &RedisDedupStore{
+		client:    client,
+		prefix:    "kafka:processed:" + group + ":",
+		retention: retention,
+		claimTTL:  DefaultDedupClaimTTL,
+	}
+}
+
+// SetClaimTTL replaces DefaultDedupClaimTTL. The TTL must be longer than a
+// handler runs, including the delay a NewRetryHandler holds messages for, and
+// is how long a message stays blocked after its consumer crashed.
+func (s *RedisDedupStore) SetClaimTTL(ttl time.Duration) {
+	s.claimTTL = ttl
+}
+
+// processedValue is stored under the key of a processed message; a claimed
+// message holds the token of its claim instead.
+const processedValue = "1"
+
+// releaseClaim deletes KEYS[1] when it still holds the token ARGV[1], so an
+// expired claim taken over by another consumer is left alone.
+var releaseClaim = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Claim sets the key of the message to a claim token unless it exists. The
+// message was processed when the key holds processedValue.
+func (s *RedisDedupStore) Claim(ctx context.Context, key string) (Claim, error) {
+	k := s.prefix + key
+	token := uuid.NewString()
+
+	ok, err := s.client.SetNX(ctx, k, token, s.claimTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return &redisClaim{store: s, key: k, token: token}, nil
+	}
+
+	value, err := s.client.Get(ctx, k).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if value == processedValue {
+		return nil, nil
+	}
+	return nil, ErrMessageInProgress
+}
+
+type redisClaim struct {
+	store *RedisDedupStore
+	key   string
+	token string
+}
+
+func (c *redisClaim) Context(ctx context.Context) context.Context {
+	return ctx
+}
+
+func (c *redisClaim) Complete(ctx context.Context) error {
+	return c.store.client.Set(ctx, c.key, processedValue, c.store.retention).Err()
+}
+
+func (c *redisClaim) Release(ctx context.Context) error {
+	return releaseClaim.Run(ctx, c.store.client, []string{c.key}, c.token).Err()
+}
@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyHeader is the message header the default KeyFunc reads.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MessageHandler processes one consumed message. A returned error leaves the
+// message uncommitted so it is handled again.
+type MessageHandler func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+// KeyFunc returns the idempotency key of a message, or an empty string when the
+// message has none.
+type KeyFunc func(msg *sarama.ConsumerMessage) string
+
+// HeaderKey returns a KeyFunc reading the named header.
+func HeaderKey(name string) KeyFunc {
+	return func(msg *sarama.ConsumerMessage) string {
+		return header(msg, name)
+	}
+}
+
+// MessageKey is a KeyFunc using the message key. It only suits topics where
+// every message has its own key, not topics keyed by entity.
+func MessageKey(msg *sarama.ConsumerMessage) string {
+	return string(msg.Key)
+}
+
+// offsetKey identifies a message by its position, which catches redeliveries
+// after a rebalance but not messages that were produced twice.
+func offsetKey(msg *sarama.ConsumerMessage) string {
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// IdempotentOption configures an IdempotentHandler.
+type IdempotentOption func(*IdempotentHandler)
+
+// WithKeyFunc replaces the default KeyFunc, HeaderKey(IdempotencyKeyHeader).
+// Messages for which it returns an empty string are identified by topic,
+// partition and offset.
+func WithKeyFunc(fn KeyFunc) IdempotentOption {
+	return func(h *IdempotentHandler) {
+		h.key = fn
+	}
+}
+
+// WithRetryBackoff sets the delay between attempts to handle a failing message.
+// Once Backoff.MaxRetries attempts failed, ConsumeClaim stops and the partition
+// is not consumed again until the next rebalance.
+func WithRetryBackoff(backoff Backoff) IdempotentOption {
+	return func(h *IdempotentHandler) {
+		h.backoff = backoff
+	}
+}
+
+// IdempotentHandler is a sarama.ConsumerGroupHandler that skips messages the
+// DedupStore already knows, and marks a message for commit only after the
+// MessageHandler succeeded and the message was recorded in the store.
+//
+// A message is claimed in the store before the MessageHandler runs, so two
+// consumers never handle it at the same time. The claim is released when the
+// handler fails, and a message claimed by another consumer is retried with
+// backoff until that claim is completed or released.
+//
+// Copies of a message forwarded by NewRetryHandler or replayed from the DLQ are
+// tracked separately from the delivery that failed.
+//
+// Messages are handled one at a time per partition. A failing message is
+// retried with backoff before the next message of its partition is handled, so
+// the order within a partition is kept.
+type IdempotentHandler struct {
+	handler MessageHandler
+	store   DedupStore
+	logger  logger.LoggerInterface
+	key     KeyFunc
+	backoff Backoff
+}
+
+// NewIdempotentHandler creates a new IdempotentHandler.
+//
+// Parameters:
+//   - handler: The function processing each new message (MessageHandler)
+//   - store: The store of processed messages, scoped to the consumer group (DedupStore)
+//   - logger: The logger used to report skipped and failed messages (logger.LoggerInterface)
+//   - opts: Options overriding the KeyFunc and DefaultBackoff
+//
+// Returns:
+//   - *IdempotentHandler: The handler, ready to be passed to StartConsumers
+func NewIdempotentHandler(handler MessageHandler, store DedupStore, logger logger.LoggerInterface, opts ...IdempotentOption) *IdempotentHandler {
+	h := &IdempotentHandler{
+		handler: handler,
+		store:   store,
+		logger:  logger,
+		key:     HeaderKey(IdempotencyKeyHeader),
+		backoff: DefaultBackoff(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim.
+func (h *IdempotentHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited.
+func (h *IdempotentHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim handles the messages of one partition until the session ends.
+func (h *IdempotentHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := h.process(ctx, session, msg); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// process handles one message, retrying with backoff, and marks it once done.
+func (h *IdempotentHandler) process(ctx context.Context, session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	key := h.key(msg)
+	if key == "" {
+		key = offsetKey(msg)
+	}
+	key += deliveryGeneration(msg)
+
+	for attempt := 1; ; attempt++ {
+		err := h.handle(ctx, msg, key)
+		if err == nil {
+			session.MarkMessage(msg, "")
+			return nil
+		}
+
+		h.logger.Error("Failed to handle kafka message",
+			zap.String("topic", msg.Topic),
+			zap.Int32("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.String("idempotency_key", key),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+
+		if h.backoff.MaxRetries > 0 && attempt >= h.backoff.MaxRetries {
+			return fmt.Errorf("%w after %d attempts: %v", ErrRetriesExhausted, attempt, err)
+		}
+
+		timer := time.NewTimer(h.backoff.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (h *IdempotentHandler) handle(ctx context.Context, msg *sarama.ConsumerMessage, key string) error {
+	claim, err := h.store.Claim(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to claim message: %w", err)
+	}
+	if claim == nil {
+		h.logger.Debug("Skipping processed kafka message",
+			zap.String("topic", msg.Topic),
+			zap.Int64("offset", msg.Offset),
+			zap.String("idempotency_key", key),
+		)
+		return nil
+	}
+
+	if err := h.handler(claim.Context(ctx), msg); err != nil {
+		return errors.Join(err, h.release(ctx, claim))
+	}
+	if err := claim.Complete(ctx); err != nil {
+		return errors.Join(fmt.Errorf("failed to record processed message: %w", err), h.release(ctx, claim))
+	}
+	return nil
+}
+
+// release gives up claim even when ctx is done, so the message is not blocked
+// until the claim expires.
+func (h *IdempotentHandler) release(ctx context.Context, claim Claim) error {
+	if err := claim.Release(context.WithoutCancel(ctx)); err != nil {
+		return fmt.Errorf("failed to release message claim: %w", err)
+	}
+	return nil
+}
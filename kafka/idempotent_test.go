@@ -0,0 +1,350 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/IBM/sarama"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return nil }
+func (s *fakeSession) MemberID() string                         { return "member-1" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) Commit()                                  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) Context() context.Context                 { return s.ctx }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "transactions" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func newClaim(msgs ...*sarama.ConsumerMessage) *fakeClaim {
+	c := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, msg := range msgs {
+		c.messages <- msg
+	}
+	close(c.messages)
+	return c
+}
+
+type memoryDedupStore struct {
+	mu            sync.Mutex
+	keys          map[string]bool
+	claimed       map[string]bool
+	completeErr   error
+	completeCalls int
+}
+
+func (s *memoryDedupStore) Claim(ctx context.Context, key string) (Claim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return nil, nil
+	}
+	if s.claimed[key] {
+		return nil, ErrMessageInProgress
+	}
+	if s.claimed == nil {
+		s.claimed = make(map[string]bool)
+	}
+	s.claimed[key] = true
+	return &memoryClaim{store: s, key: key}, nil
+}
+
+type memoryClaim struct {
+	store *memoryDedupStore
+	key   string
+}
+
+func (c *memoryClaim) Context(ctx context.Context) context.Context { return ctx }
+
+func (c *memoryClaim) Complete(ctx context.Context) error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	c.store.completeCalls++
+	if c.store.completeErr != nil {
+		err := c.store.completeErr
+		c.store.completeErr = nil
+		return err
+	}
+	delete(c.store.claimed, c.key)
+	c.store.keys[c.key] = true
+	return nil
+}
+
+func (c *memoryClaim) Release(ctx context.Context) error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	delete(c.store.claimed, c.key)
+	return nil
+}
+
+func message(offset int64, idempotencyKey string) *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{Topic: "transactions", Offset: offset, Key: []byte("card-1")}
+	if idempotencyKey != "" {
+		msg.Headers = []*sarama.RecordHeader{{Key: []byte(IdempotencyKeyHeader), Value: []byte(idempotencyKey)}}
+	}
+	return msg
+}
+
+func TestIdempotentHandler_SkipsProcessedMessages(t *testing.T) {
+	store := &memoryDedupStore{keys: map[string]bool{"evt-1": true}}
+
+	var handled []int64
+	h := NewIdempotentHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		handled = append(handled, msg.Offset)
+		return nil
+	}, store, &logger.Logger{Log: zap.NewNop()})
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := newClaim(
+		message(10, "evt-1"),
+		message(11, "evt-2"),
+		message(12, "evt-2"),
+		message(13, ""),
+	)
+
+	require.NoError(t, h.ConsumeClaim(session, claim))
+
+	assert.Equal(t, []int64{11, 13}, handled)
+	assert.Equal(t, []int64{10, 11, 12, 13}, session.markedOffsets())
+	assert.True(t, store.keys["evt-2"])
+	assert.True(t, store.keys["transactions/0/13"])
+}
+
+func TestIdempotentHandler_RetriesBeforeMarking(t *testing.T) {
+	store := &memoryDedupStore{keys: map[string]bool{}, completeErr: errors.New("redis down")}
+
+	calls := 0
+	h := NewIdempotentHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		calls++
+		if calls == 1 {
+			return errors.New("saldo locked")
+		}
+		return nil
+	}, store, &logger.Logger{Log: zap.NewNop()},
+		WithRetryBackoff(Backoff{Initial: time.Millisecond}),
+		WithKeyFunc(MessageKey),
+	)
+
+	session := &fakeSession{ctx: context.Background()}
+	require.NoError(t, h.ConsumeClaim(session, newClaim(message(5, ""))))
+
+	// The handler fails once, then succeeds; recording it fails once, which
+	// releases the claim, so the handler runs again before it is recorded.
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, store.completeCalls)
+	assert.True(t, store.keys["card-1"])
+	assert.Equal(t, []int64{5}, session.markedOffsets())
+}
+
+func TestIdempotentHandler_MaxRetries(t *testing.T) {
+	store := &memoryDedupStore{keys: map[string]bool{}}
+	h := NewIdempotentHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("saldo locked")
+	}, store, &logger.Logger{Log: zap.NewNop()},
+		WithRetryBackoff(Backoff{Initial: time.Millisecond, MaxRetries: 2}),
+	)
+
+	session := &fakeSession{ctx: context.Background()}
+	err := h.ConsumeClaim(session, newClaim(message(5, "evt-5"), message(6, "evt-6")))
+
+	assert.ErrorIs(t, err, ErrRetriesExhausted)
+	assert.Empty(t, session.markedOffsets())
+	assert.Empty(t, store.keys)
+	assert.Empty(t, store.claimed, "failed attempts release their claim")
+}
+
+func TestIdempotentHandler_WaitsForOtherClaim(t *testing.T) {
+	store := &memoryDedupStore{keys: map[string]bool{}, claimed: map[string]bool{"evt-7": true}}
+
+	calls := 0
+	h := NewIdempotentHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		calls++
+		return nil
+	}, store, &logger.Logger{Log: zap.NewNop()},
+		WithRetryBackoff(Backoff{Initial: 10 * time.Millisecond}),
+	)
+
+	// The other consumer completes the message while this one backs off.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		delete(store.claimed, "evt-7")
+		store.keys["evt-7"] = true
+	}()
+
+	session := &fakeSession{ctx: context.Background()}
+	require.NoError(t, h.ConsumeClaim(session, newClaim(message(7, "evt-7"))))
+
+	assert.Zero(t, calls)
+	assert.Equal(t, []int64{7}, session.markedOffsets())
+}
+
+func TestIdempotentHandler_StopsWithSession(t *testing.T) {
+	store := &memoryDedupStore{keys: map[string]bool{}}
+	h := NewIdempotentHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("saldo locked")
+	}, store, &logger.Logger{Log: zap.NewNop()},
+		WithRetryBackoff(Backoff{Initial: time.Hour}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+
+	done := make(chan error, 1)
+	go func() { done <- h.ConsumeClaim(session, newClaim(message(5, "evt-5"))) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeClaim did not return when the session ended")
+	}
+	assert.Empty(t, session.markedOffsets())
+}
+
+func TestRedisDedupStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	store := NewRedisDedupStore(client, "saldo-service", time.Hour)
+	store.SetClaimTTL(time.Minute)
+
+	claim, err := store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	require.NotNil(t, claim)
+	assert.Equal(t, time.Minute, mr.TTL("kafka:processed:saldo-service:evt-1"))
+
+	_, err = store.Claim(ctx, "evt-1")
+	assert.ErrorIs(t, err, ErrMessageInProgress)
+
+	require.NoError(t, claim.Release(ctx))
+	claim, err = store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	require.NotNil(t, claim)
+
+	require.NoError(t, claim.Complete(ctx))
+	assert.Equal(t, time.Hour, mr.TTL("kafka:processed:saldo-service:evt-1"))
+	processed, err := store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.Nil(t, processed)
+
+	other, err := NewRedisDedupStore(client, "email-service", 0).Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.NotNil(t, other)
+
+	mr.FastForward(time.Hour)
+	claim, err = store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.NotNil(t, claim)
+}
+
+func TestRedisDedupStore_ExpiredClaim(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	store := NewRedisDedupStore(client, "saldo-service", 0)
+	store.SetClaimTTL(time.Minute)
+
+	stale, err := store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	mr.FastForward(time.Minute)
+
+	claim, err := store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	require.NotNil(t, claim)
+
+	// Releasing the expired claim leaves the claim that took it over.
+	require.NoError(t, stale.Release(ctx))
+	_, err = store.Claim(ctx, "evt-1")
+	assert.ErrorIs(t, err, ErrMessageInProgress)
+}
+
+func TestPostgresDedupStore(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	store := NewPostgresDedupStore(conn, db.New(conn), "saldo-service")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO processed_messages")).
+		WithArgs("saldo-service", "evt-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	claim, err := store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	require.NotNil(t, claim)
+	tx, ok := TxFromContext(claim.Context(ctx))
+	assert.True(t, ok)
+	assert.NotNil(t, tx)
+	require.NoError(t, claim.Complete(ctx))
+	require.NoError(t, claim.Release(ctx), "releasing a completed claim is a no-op")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO processed_messages")).
+		WithArgs("saldo-service", "evt-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	claim, err = store.Claim(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.Nil(t, claim)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO processed_messages")).
+		WithArgs("saldo-service", "evt-2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	claim, err = store.Claim(ctx, "evt-2")
+	require.NoError(t, err)
+	require.NoError(t, claim.Release(ctx))
+
+	_, ok = TxFromContext(ctx)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
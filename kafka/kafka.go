@@ -2,11 +2,12 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
 )
 
 // SyncProducer is an interface that represents a Kafka producer.
@@ -20,31 +21,61 @@ type Kafka struct {
 	logger   logger.LoggerInterface
 	producer SyncProducer
 	brokers  []string
+	config   *sarama.Config
+	tracing  *Tracing
 }
 
-// NewKafka initializes a new Kafka struct.
+// New connects a Kafka producer to the given brokers.
 //
-// It takes a logger and a list of broker addresses as inputs and returns a pointer to the Kafka struct.
-// It creates a new Kafka producer with the given configuration, and logs a message indicating if the connection is successful.
-// If the connection fails, it logs an error message and exits.
-func NewKafka(logger logger.LoggerInterface, brokers []string) *Kafka {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
-	config.Producer.Return.Successes = true
+// The producer starts from DefaultConfig and applies the options in order, so
+// later options win. The resulting config, including TLS and SASL settings, is
+// also used by StartConsumers. An error is returned when an option fails, the
+// config is invalid or no broker can be reached.
+func New(logger logger.LoggerInterface, brokers []string, opts ...Option) (*Kafka, error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOption, err)
+	}
 
 	producer, err := sarama.NewSyncProducer(brokers, config)
 	if err != nil {
-		log.Fatalf("Failed to create Kafka producer: %v", err)
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
 	}
 
-	log.Println("Kafka producer connected successfully")
+	logger.Info("Kafka producer connected successfully")
 
 	return &Kafka{
 		producer: producer,
 		brokers:  brokers,
+		config:   config,
 		logger:   logger,
+		tracing:  NewTracing(),
+	}, nil
+}
+
+// NewKafka initializes a new Kafka struct with the default configuration.
+//
+// It takes a logger and a list of broker addresses as inputs and returns a pointer to the Kafka struct.
+// If the connection fails, it logs an error message and exits.
+//
+// Deprecated: use New, which accepts options and returns an error instead of exiting.
+func NewKafka(logger logger.LoggerInterface, brokers []string) *Kafka {
+	k, err := New(logger, brokers)
+	if err != nil {
+		log.Fatalf("Failed to create Kafka producer: %v", err)
 	}
+	return k
+}
+
+// Close closes the producer, flushing buffered messages.
+func (k *Kafka) Close() error {
+	return k.producer.Close()
 }
 
 // GetBrokers returns a list of the Kafka broker addresses that the producer is connected to.
@@ -55,64 +86,66 @@ func (k *Kafka) GetBrokers() []string {
 // SendMessage sends a message to the given Kafka topic with the given key and value.
 //
 // It uses the configured SyncProducer to send the message and logs the result of the send operation.
-// If the send operation fails, it returns an error.
+// If the send operation fails, it returns an error. The producer span starts a
+// new trace; use SendMessageContext to continue the trace of a request.
 func (k *Kafka) SendMessage(topic string, key string, value []byte) error {
+	return k.SendMessageContext(context.Background(), topic, key, value)
+}
+
+// SendMessageContext is SendMessage within the trace of ctx. The message is
+// sent inside a producer span whose context is injected into its headers, so
+// consumers continue the trace.
+func (k *Kafka) SendMessageContext(ctx context.Context, topic string, key string, value []byte) error {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
 		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(value),
 	}
 
+	_, span := k.tracing.StartProducer(ctx, msg)
 	partition, offset, err := k.producer.SendMessage(msg)
+	k.tracing.EndProducer(span, msg, err)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Message is stored in topic(%s)/partition(%d)/offset(%d)\n", topic, partition, offset)
+	k.logger.Debug("Message is stored",
+		zap.String("topic", topic),
+		zap.Int32("partition", partition),
+		zap.Int64("offset", offset),
+	)
 	return nil
 }
 
-// StartConsumers starts a Kafka consumer group to consume messages from the specified topics.
-//
-// It takes a list of topics, a consumer group ID, and a handler implementing the sarama.ConsumerGroupHandler interface.
-// The method initializes a new Kafka consumer group and begins consuming messages in a background goroutine.
-// If an error occurs during consumption, it retries up to a maximum number of retries with a delay between attempts.
-// Any errors from the consumer group are logged and the function returns an error if the consumer group initialization fails.
-func (k *Kafka) StartConsumers(topics []string, groupID string, handler sarama.ConsumerGroupHandler) error {
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
-
-	consumerGroup, err := sarama.NewConsumerGroup(k.brokers, groupID, config)
+// Send sends a prepared message, such as one built by an event.Serializer,
+// keeping its headers.
+func (k *Kafka) Send(msg *sarama.ProducerMessage) error {
+	return k.SendContext(context.Background(), msg)
+}
+
+// SendContext is Send within the trace of ctx, like SendMessageContext.
+func (k *Kafka) SendContext(ctx context.Context, msg *sarama.ProducerMessage) error {
+	_, span := k.tracing.StartProducer(ctx, msg)
+	partition, offset, err := k.producer.SendMessage(msg)
+	k.tracing.EndProducer(span, msg, err)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to send message to %s: %w", msg.Topic, err)
 	}
 
-	ctx := context.Background()
-
-	go func() {
-		retries := 0
-		maxRetries := 5
-		for {
-			err := consumerGroup.Consume(ctx, topics, handler)
-			if err != nil {
-				log.Printf("Error from consumer: %v", err)
-				retries++
-				if retries >= maxRetries {
-					log.Fatalf("Max retries reached for consumer group. Exiting.")
-				}
-				time.Sleep(30 * time.Second)
-				continue
-			}
-			retries = 0
-		}
-	}()
-
-	go func() {
-		for err := range consumerGroup.Errors() {
-			log.Printf("Consumer group error: %v", err)
-		}
-	}()
-
+	k.logger.Debug("Message is stored",
+		zap.String("topic", msg.Topic),
+		zap.Int32("partition", partition),
+		zap.Int64("offset", offset),
+	)
 	return nil
 }
+
+// consumerConfig returns a copy of the producer config, so consumers use the same
+// client ID, version, TLS and SASL settings.
+func (k *Kafka) consumerConfig() *sarama.Config {
+	if k.config == nil {
+		return sarama.NewConfig()
+	}
+	config := *k.config
+	return &config
+}
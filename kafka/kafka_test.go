@@ -1,11 +1,17 @@
 package kafka
 
 import (
+	"crypto/tls"
 	"testing"
+	"time"
 
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
 	mock_logger "github.com/MamangRust/monolith-payment-gateway-pkg/logger/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
 )
 
 func TestKafka_SendMessage_Success(t *testing.T) {
@@ -21,6 +27,8 @@ func TestKafka_SendMessage_Success(t *testing.T) {
 		logger:   mockLogger,
 	}
 
+	mockLogger.EXPECT().Debug("Message is stored", gomock.Any(), gomock.Any(), gomock.Any())
+
 	err := k.SendMessage("test-topic", "key", []byte("hello"))
 	assert.NoError(t, err)
 	assert.Len(t, mockProducer.Messages, 1)
@@ -44,6 +52,23 @@ func TestKafka_SendMessage_Failure(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestKafka_Send(t *testing.T) {
+	mockProducer := &MockProducer{}
+	k := &Kafka{producer: mockProducer, logger: &logger.Logger{Log: zap.NewNop()}}
+
+	msg := &sarama.ProducerMessage{
+		Topic:   "topup-events",
+		Value:   sarama.StringEncoder("payload"),
+		Headers: []sarama.RecordHeader{{Key: []byte("event-type"), Value: []byte("topup.created")}},
+	}
+	require.NoError(t, k.Send(msg))
+	require.Len(t, mockProducer.Messages, 1)
+	assert.Equal(t, "topup.created", string(mockProducer.Messages[0].Headers[0].Value))
+
+	mockProducer.ShouldFail = true
+	assert.ErrorIs(t, k.Send(msg), sarama.ErrUnknown)
+}
+
 func TestKafka_GetBrokers(t *testing.T) {
 	k := &Kafka{
 		brokers: []string{"broker1", "broker2"},
@@ -51,3 +76,60 @@ func TestKafka_GetBrokers(t *testing.T) {
 
 	assert.Equal(t, []string{"broker1", "broker2"}, k.GetBrokers())
 }
+
+func TestOptions(t *testing.T) {
+	config := DefaultConfig()
+	for _, opt := range []Option{
+		WithClientID("payment-gateway"),
+		WithVersion("3.6.0"),
+		WithTLS(&tls.Config{MinVersion: tls.VersionTLS12}),
+		WithSASLSCRAM(SCRAMSHA512, "user", "secret"),
+		WithCompression(sarama.CompressionSnappy),
+		WithIdempotence(),
+		WithRetry(10, time.Second),
+		WithTimeouts(5*time.Second, 0, 0),
+		WithProducerTimeout(15 * time.Second),
+	} {
+		require.NoError(t, opt(config))
+	}
+	require.NoError(t, config.Validate())
+
+	assert.Equal(t, "payment-gateway", config.ClientID)
+	assert.Equal(t, sarama.V3_6_0_0, config.Version)
+	assert.True(t, config.Net.TLS.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	assert.Equal(t, 10, config.Producer.Retry.Max)
+	assert.Equal(t, 5*time.Second, config.Net.DialTimeout)
+	assert.Equal(t, 30*time.Second, config.Net.ReadTimeout)
+
+	// The SCRAM client starts the conversation with the client-first message.
+	client := config.Net.SASL.SCRAMClientGeneratorFunc()
+	require.NoError(t, client.Begin("user", "secret", ""))
+	first, err := client.Step("")
+	require.NoError(t, err)
+	assert.Contains(t, first, "n=user")
+	assert.False(t, client.Done())
+}
+
+func TestNew_Errors(t *testing.T) {
+	log := &logger.Logger{Log: zap.NewNop()}
+
+	_, err := New(log, []string{"localhost:9092"}, WithVersion("not-a-version"))
+	assert.ErrorIs(t, err, ErrInvalidOption)
+
+	_, err = New(log, []string{"localhost:9092"}, WithSASLSCRAM("SCRAM-MD5", "user", "secret"))
+	assert.ErrorIs(t, err, ErrInvalidOption)
+
+	_, err = New(log, []string{"localhost:9092"}, WithTLSFiles("testdata/missing.pem", "", ""))
+	assert.Error(t, err)
+
+	// An unreachable broker is reported instead of exiting the process.
+	noRetry := func(c *sarama.Config) error {
+		c.Metadata.Retry.Max = 0
+		return nil
+	}
+	_, err = New(log, []string{"127.0.0.1:1"}, WithTimeouts(time.Second, 0, 0), noRetry)
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrInvalidOption is returned by New when an option is given an unusable value.
+var ErrInvalidOption = errors.New("invalid kafka option")
+
+// Option configures the sarama config used by New.
+type Option func(*sarama.Config) error
+
+// SCRAMMechanism selects the hash used for SASL/SCRAM authentication.
+type SCRAMMechanism string
+
+// SASL/SCRAM mechanisms supported by WithSASLSCRAM.
+const (
+	SCRAMSHA256 SCRAMMechanism = sarama.SASLTypeSCRAMSHA256
+	SCRAMSHA512 SCRAMMechanism = sarama.SASLTypeSCRAMSHA512
+)
+
+// DefaultConfig returns the sarama config New starts from: every in-sync replica
+// must acknowledge a message, sends are retried 5 times and successes are
+// reported so the sync producer can return the offset.
+func DefaultConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	return config
+}
+
+// WithClientID sets the client ID sent to the brokers, which shows up in broker
+// logs and quotas.
+func WithClientID(clientID string) Option {
+	return func(c *sarama.Config) error {
+		c.ClientID = clientID
+		return nil
+	}
+}
+
+// WithVersion sets the Kafka protocol version, e.g. "3.6.0". Features such as
+// idempotent producers and transactions require a recent enough version.
+func WithVersion(version string) Option {
+	return func(c *sarama.Config) error {
+		v, err := sarama.ParseKafkaVersion(version)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidOption, err)
+		}
+		c.Version = v
+		return nil
+	}
+}
+
+// WithTLS enables TLS with the given config.
+func WithTLS(config *tls.Config) Option {
+	return func(c *sarama.Config) error {
+		c.Net.TLS.Enable = true
+		c.Net.TLS.Config = config
+		return nil
+	}
+}
+
+// WithTLSFiles enables TLS, trusting the CA certificate in caFile. certFile and
+// keyFile hold the client certificate for mutual TLS and may be empty.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(c *sarama.Config) error {
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return fmt.Errorf("failed to read kafka CA certificate: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("%w: no certificates in %s", ErrInvalidOption, caFile)
+			}
+			config.RootCAs = pool
+		}
+
+		if certFile != "" || keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load kafka client certificate: %w", err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+
+		return WithTLS(config)(c)
+	}
+}
+
+// WithSASLPlain enables SASL/PLAIN authentication. It should be combined with
+// TLS, since the password is sent in the clear.
+func WithSASLPlain(username, password string) Option {
+	return func(c *sarama.Config) error {
+		c.Net.SASL.Enable = true
+		c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		c.Net.SASL.User = username
+		c.Net.SASL.Password = password
+		return nil
+	}
+}
+
+// WithSASLSCRAM enables SASL/SCRAM authentication with SHA-256 or SHA-512.
+func WithSASLSCRAM(mechanism SCRAMMechanism, username, password string) Option {
+	return func(c *sarama.Config) error {
+		var generator func() sarama.SCRAMClient
+		switch mechanism {
+		case SCRAMSHA256:
+			generator = func() sarama.SCRAMClient { return &scramClient{hash: sha256Generator} }
+		case SCRAMSHA512:
+			generator = func() sarama.SCRAMClient { return &scramClient{hash: sha512Generator} }
+		default:
+			return fmt.Errorf("%w: unknown SCRAM mechanism %q", ErrInvalidOption, mechanism)
+		}
+
+		c.Net.SASL.Enable = true
+		c.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+		c.Net.SASL.User = username
+		c.Net.SASL.Password = password
+		c.Net.SASL.SCRAMClientGeneratorFunc = generator
+		return nil
+	}
+}
+
+// WithCompression sets the codec used to compress message batches.
+func WithCompression(codec sarama.CompressionCodec) Option {
+	return func(c *sarama.Config) error {
+		c.Producer.Compression = codec
+		return nil
+	}
+}
+
+// WithIdempotence enables the idempotent producer, so retried sends are not
+// written twice. It requires Kafka 0.11 or later, see WithVersion, and forces
+// WaitForAll acks and a single in-flight request per broker.
+func WithIdempotence() Option {
+	return func(c *sarama.Config) error {
+		c.Producer.Idempotent = true
+		c.Producer.RequiredAcks = sarama.WaitForAll
+		c.Net.MaxOpenRequests = 1
+		if !c.Version.IsAtLeast(sarama.V0_11_0_0) {
+			c.Version = sarama.V0_11_0_0
+		}
+		return nil
+	}
+}
+
+// WithBatching sets when the async producer sends a batch: once it holds
+// messages messages or bytes bytes, or frequency after the first buffered
+// message. Zero values leave the setting unused.
+func WithBatching(messages, bytes int, frequency time.Duration) Option {
+	return func(c *sarama.Config) error {
+		if messages < 0 || bytes < 0 || frequency < 0 {
+			return fmt.Errorf("%w: negative batch setting", ErrInvalidOption)
+		}
+		c.Producer.Flush.Messages = messages
+		c.Producer.Flush.Bytes = bytes
+		c.Producer.Flush.Frequency = frequency
+		return nil
+	}
+}
+
+// WithRequiredAcks sets how many replicas must acknowledge a message.
+func WithRequiredAcks(acks sarama.RequiredAcks) Option {
+	return func(c *sarama.Config) error {
+		c.Producer.RequiredAcks = acks
+		return nil
+	}
+}
+
+// WithRetry sets how often a failed send is retried and the delay between attempts.
+func WithRetry(max int, backoff time.Duration) Option {
+	return func(c *sarama.Config) error {
+		if max < 0 {
+			return fmt.Errorf("%w: negative retry count", ErrInvalidOption)
+		}
+		c.Producer.Retry.Max = max
+		c.Producer.Retry.Backoff = backoff
+		return nil
+	}
+}
+
+// WithTimeouts sets the timeouts for connecting to a broker, for reading a
+// response and for writing a request. Zero values keep the sarama defaults.
+func WithTimeouts(dial, read, write time.Duration) Option {
+	return func(c *sarama.Config) error {
+		if dial > 0 {
+			c.Net.DialTimeout = dial
+		}
+		if read > 0 {
+			c.Net.ReadTimeout = read
+		}
+		if write > 0 {
+			c.Net.WriteTimeout = write
+		}
+		return nil
+	}
+}
+
+// WithProducerTimeout sets how long the brokers wait for the required acks
+// before failing a produce request.
+func WithProducerTimeout(timeout time.Duration) Option {
+	return func(c *sarama.Config) error {
+		c.Producer.Timeout = timeout
+		return nil
+	}
+}
@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// offsetReader looks up the oldest and newest offsets of a partition. It is
+// implemented by sarama.Client.
+type offsetReader interface {
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+// ReplayOptions selects the DLQ messages to replay.
+type ReplayOptions struct {
+	// From holds the first offset to replay per partition, usually the Next
+	// offsets of an earlier replay. Partitions missing from it start at their
+	// oldest message.
+	From map[int32]int64
+	// Filter reports whether a message should be replayed. Nil replays every
+	// message.
+	Filter func(msg *sarama.ConsumerMessage) bool
+}
+
+// ReplayResult is the outcome of a replay.
+type ReplayResult struct {
+	Replayed int
+	// Skipped counts messages rejected by the filter or without an original topic.
+	Skipped int
+	// Next holds the offset after the last message read per partition.
+	Next map[int32]int64
+}
+
+// Replayer moves messages from a DLQ topic back to the topic they failed on.
+type Replayer struct {
+	consumer sarama.Consumer
+	offsets  offsetReader
+	producer SyncProducer
+	logger   logger.LoggerInterface
+	client   sarama.Client
+}
+
+// NewReplayer creates a Replayer reading with a new client that uses the same
+// settings as StartConsumers and publishing with the producer of k. The
+// Replayer must be closed after use.
+func (k *Kafka) NewReplayer() (*Replayer, error) {
+	client, err := sarama.NewClient(k.brokers, k.consumerConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+
+	r := newReplayer(consumer, client, k.producer, k.logger)
+	r.client = client
+	return r, nil
+}
+
+func newReplayer(consumer sarama.Consumer, offsets offsetReader, producer SyncProducer, logger logger.LoggerInterface) *Replayer {
+	return &Replayer{
+		consumer: consumer,
+		offsets:  offsets,
+		producer: producer,
+		logger:   logger,
+	}
+}
+
+// Replay publishes the messages of dlqTopic that were there when it started to
+// their original topic, with the failure headers removed and the replay count
+// incremented, so they go through every retry tier again. Messages are not
+// removed from the DLQ; pass ReplayResult.Next as ReplayOptions.From to resume
+// after them. On error the result holds the messages replayed so far.
+func (r *Replayer) Replay(ctx context.Context, dlqTopic string, opts ReplayOptions) (*ReplayResult, error) {
+	partitions, err := r.consumer.Partitions(dlqTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions of %s: %w", dlqTopic, err)
+	}
+
+	result := &ReplayResult{Next: make(map[int32]int64, len(partitions))}
+	for _, partition := range partitions {
+		if err := r.replayPartition(ctx, dlqTopic, partition, opts, result); err != nil {
+			return result, err
+		}
+	}
+
+	r.logger.Info("Replayed kafka dead letters",
+		zap.String("topic", dlqTopic),
+		zap.Int("replayed", result.Replayed),
+		zap.Int("skipped", result.Skipped),
+	)
+	return result, nil
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, topic string, partition int32, opts ReplayOptions, result *ReplayResult) error {
+	end, err := r.offsets.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("failed to get newest offset of %s/%d: %w", topic, partition, err)
+	}
+
+	start, ok := opts.From[partition]
+	if !ok {
+		start, err = r.offsets.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return fmt.Errorf("failed to get oldest offset of %s/%d: %w", topic, partition, err)
+		}
+	}
+	result.Next[partition] = start
+	if start >= end {
+		return nil
+	}
+
+	pc, err := r.consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s/%d: %w", topic, partition, err)
+	}
+	defer pc.Close()
+
+	errs := pc.Errors()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case cerr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return fmt.Errorf("failed to read %s/%d: %w", topic, partition, cerr)
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return fmt.Errorf("failed to read %s/%d: partition consumer closed", topic, partition)
+			}
+
+			if err := r.replayMessage(msg, opts, result); err != nil {
+				return err
+			}
+			result.Next[partition] = msg.Offset + 1
+
+			if msg.Offset+1 >= end {
+				return nil
+			}
+		}
+	}
+}
+
+func (r *Replayer) replayMessage(msg *sarama.ConsumerMessage, opts ReplayOptions, result *ReplayResult) error {
+	target := header(msg, HeaderOriginalTopic)
+	if target == "" || (opts.Filter != nil && !opts.Filter(msg)) {
+		result.Skipped++
+		return nil
+	}
+
+	replays, _ := strconv.Atoi(header(msg, HeaderReplayCount))
+
+	headers := withoutHeaders(msg.Headers,
+		HeaderRetryAttempt, HeaderRetryAt, HeaderError, HeaderFailedAt, HeaderReplayCount,
+		HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset,
+	)
+	headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderReplayCount), Value: []byte(strconv.Itoa(replays + 1))})
+
+	out := &sarama.ProducerMessage{
+		Topic:   target,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	if _, _, err := r.producer.SendMessage(out); err != nil {
+		return fmt.Errorf("failed to replay message %s/%d/%d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	result.Replayed++
+	return nil
+}
+
+// Close closes the consumer and the client created by NewReplayer. The producer
+// belongs to the Kafka it came from and stays open.
+func (r *Replayer) Close() error {
+	err := r.consumer.Close()
+	if r.client != nil {
+		if cerr := r.client.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
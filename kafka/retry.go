@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Headers written on messages forwarded to a retry topic or the DLQ.
+const (
+	HeaderRetryAttempt      = "X-Retry-Attempt"
+	HeaderRetryAt           = "X-Retry-At"
+	HeaderReplayCount       = "X-Replay-Count"
+	HeaderError             = "X-Error"
+	HeaderFailedAt          = "X-Failed-At"
+	HeaderOriginalTopic     = "X-Original-Topic"
+	HeaderOriginalPartition = "X-Original-Partition"
+	HeaderOriginalOffset    = "X-Original-Offset"
+)
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, so a handler wrapped by
+// NewRetryHandler sends the message straight to the DLQ, e.g. for a payload
+// that cannot be decoded.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// RetryPolicy lists the delays of the retry tiers. A message that fails on the
+// source topic goes to the first retry topic, one that fails there to the
+// second, and so on; after the last tier it goes to the DLQ.
+type RetryPolicy struct {
+	Delays []time.Duration
+}
+
+// DefaultRetryPolicy retries after one minute, ten minutes and one hour.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Delays: []time.Duration{time.Minute, 10 * time.Minute, time.Hour}}
+}
+
+// Topics returns the source topic followed by its retry topics, which the
+// consumer must subscribe to together.
+func (p RetryPolicy) Topics(topic string) []string {
+	topics := []string{topic}
+	for _, delay := range p.Delays {
+		topics = append(topics, RetryTopic(topic, delay))
+	}
+	return topics
+}
+
+// RetryTopic returns the name of the retry topic of topic for delay, such as
+// "transfer-events.retry.10m".
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + ".retry." + delayLabel(delay)
+}
+
+// DLQTopic returns the name of the dead-letter topic of topic, such as
+// "transfer-events.dlq".
+func DLQTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+func delayLabel(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d >= time.Minute && d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	case d >= time.Second && d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	default:
+		return strings.ReplaceAll(d.String(), ".", "_")
+	}
+}
+
+// retryHandler forwards messages whose handler failed to the next retry topic.
+type retryHandler struct {
+	next     MessageHandler
+	producer SyncProducer
+	policy   RetryPolicy
+	logger   logger.LoggerInterface
+	tracing  *Tracing
+	now      func() time.Time
+}
+
+// NewRetryHandler wraps next so that a failed message is published to the next
+// retry topic of its source topic, or to the DLQ once every tier failed or the
+// error is Permanent. The failure is then considered handled and the offset is
+// committed. Messages consumed from a retry topic are held until their delay
+// has passed; one whose X-Retry-At header cannot be parsed goes to the DLQ
+// without being handled. Forwarded messages carry the trace context of the
+// handler, so the retry joins the trace of the failed attempt.
+//
+// Holding a message blocks its partition for up to the delay of its tier. The
+// wait ends as soon as ctx is done, and IdempotentHandler passes
+// session.Context(), which sarama cancels when a rebalance starts, so the
+// delay does not hold up Consumer.Group.Rebalance.Timeout; the message is
+// handled again after the rebalance. Handlers running with a context that is
+// not cancelled on rebalance need a Rebalance.Timeout longer than the longest
+// delay.
+//
+// The wrapped handler is usually passed to NewIdempotentHandler, and the
+// consumer subscribes to RetryPolicy.Topics. An error is only returned when the
+// message could not be forwarded.
+//
+// Parameters:
+//   - next: The handler processing the messages (MessageHandler)
+//   - producer: The producer used to forward failed messages (SyncProducer)
+//   - policy: The retry tiers (RetryPolicy)
+//   - logger: The logger used to report forwarded messages (logger.LoggerInterface)
+//
+// Returns:
+//   - MessageHandler: The wrapped handler
+func NewRetryHandler(next MessageHandler, producer SyncProducer, policy RetryPolicy, logger logger.LoggerInterface) MessageHandler {
+	h := &retryHandler{
+		next:     next,
+		producer: producer,
+		policy:   policy,
+		logger:   logger,
+		tracing:  NewTracing(),
+		now:      time.Now,
+	}
+	return h.handle
+}
+
+// RetryHandler is NewRetryHandler forwarding with the producer and Tracing of k.
+func (k *Kafka) RetryHandler(next MessageHandler, policy RetryPolicy) MessageHandler {
+	h := &retryHandler{
+		next:     next,
+		producer: k.producer,
+		policy:   policy,
+		logger:   k.logger,
+		tracing:  k.tracing,
+		now:      time.Now,
+	}
+	return h.handle
+}
+
+func (h *retryHandler) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var permanent *permanentError
+	err := h.wait(ctx, msg)
+	if err != nil && !errors.As(err, &permanent) {
+		return err
+	}
+	if err == nil {
+		if err = h.next(ctx, msg); err == nil {
+			return nil
+		}
+	}
+
+	attempt, _ := strconv.Atoi(header(msg, HeaderRetryAttempt))
+	source := header(msg, HeaderOriginalTopic)
+	if source == "" {
+		source = msg.Topic
+	}
+
+	var (
+		target  string
+		retryAt time.Time
+	)
+	if attempt < len(h.policy.Delays) && !errors.As(err, &permanent) {
+		delay := h.policy.Delays[attempt]
+		target = RetryTopic(source, delay)
+		retryAt = h.now().Add(delay)
+	} else {
+		target = DLQTopic(source)
+	}
+
+	out := h.forward(msg, target, attempt+1, retryAt, err)
+	_, span := h.tracing.StartProducer(ctx, out)
+	_, _, sendErr := h.producer.SendMessage(out)
+	h.tracing.EndProducer(span, out, sendErr)
+	if sendErr != nil {
+		return fmt.Errorf("failed to forward message to %s: %w", target, sendErr)
+	}
+
+	h.logger.Error("Kafka message forwarded after failure",
+		zap.String("topic", msg.Topic),
+		zap.Int64("offset", msg.Offset),
+		zap.String("target", target),
+		zap.Int("attempt", attempt+1),
+		zap.Error(err),
+	)
+	return nil
+}
+
+// wait holds a message from a retry topic until its retry time. An invalid
+// retry time is a Permanent error.
+func (h *retryHandler) wait(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	value := header(msg, HeaderRetryAt)
+	if value == "" {
+		return nil
+	}
+	retryAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid %s header: %w", HeaderRetryAt, err))
+	}
+
+	delay := retryAt.Sub(h.now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (h *retryHandler) forward(msg *sarama.ConsumerMessage, target string, attempt int, retryAt time.Time, cause error) *sarama.ProducerMessage {
+	headers := withoutHeaders(msg.Headers, HeaderRetryAttempt, HeaderRetryAt, HeaderError, HeaderFailedAt)
+	if header(msg, HeaderOriginalTopic) == "" {
+		headers = append(headers,
+			sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+			sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+			sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte(strconv.Itoa(attempt))},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(h.now().UTC().Format(time.RFC3339Nano))},
+	)
+	if !retryAt.IsZero() {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderRetryAt), Value: []byte(retryAt.UTC().Format(time.RFC3339Nano))})
+	}
+
+	out := &sarama.ProducerMessage{
+		Topic:   target,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	return out
+}
+
+// header returns the value of the named header of msg, or an empty string.
+func header(msg *sarama.ConsumerMessage, name string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == name {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// withoutHeaders copies headers, leaving out the named ones.
+func withoutHeaders(headers []*sarama.RecordHeader, names ...string) []sarama.RecordHeader {
+	out := make([]sarama.RecordHeader, 0, len(headers)+len(names))
+	for _, h := range headers {
+		if h == nil {
+			continue
+		}
+		skip := false
+		for _, name := range names {
+			if string(h.Key) == name {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			out = append(out, *h)
+		}
+	}
+	return out
+}
+
+// deliveryGeneration distinguishes the copies of a message made by retries and
+// replays, so an IdempotentHandler does not skip them as duplicates of the
+// delivery that failed. It is empty for messages that were never forwarded.
+func deliveryGeneration(msg *sarama.ConsumerMessage) string {
+	attempt := header(msg, HeaderRetryAttempt)
+	replay := header(msg, HeaderReplayCount)
+	if attempt == "" && replay == "" {
+		return ""
+	}
+	return "#" + replay + "." + attempt
+}
@@ -0,0 +1,270 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func producedHeader(msg *sarama.ProducerMessage, name string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == name {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func toConsumed(msg *sarama.ProducerMessage, offset int64) *sarama.ConsumerMessage {
+	key, _ := msg.Key.Encode()
+	value, _ := msg.Value.Encode()
+
+	consumed := &sarama.ConsumerMessage{Topic: msg.Topic, Key: key, Value: value, Offset: offset}
+	for i := range msg.Headers {
+		consumed.Headers = append(consumed.Headers, &msg.Headers[i])
+	}
+	return consumed
+}
+
+func TestRetryTopics(t *testing.T) {
+	policy := RetryPolicy{Delays: []time.Duration{30 * time.Second, time.Minute, 10 * time.Minute, 2 * time.Hour, 1500 * time.Millisecond}}
+
+	assert.Equal(t, []string{
+		"transfer-events",
+		"transfer-events.retry.30s",
+		"transfer-events.retry.1m",
+		"transfer-events.retry.10m",
+		"transfer-events.retry.2h",
+		"transfer-events.retry.1_5s",
+	}, policy.Topics("transfer-events"))
+	assert.Equal(t, "transfer-events.dlq", DLQTopic("transfer-events"))
+}
+
+func TestRetryHandler_Tiers(t *testing.T) {
+	producer := &MockProducer{}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	errSaldo := errors.New("saldo locked")
+
+	h := &retryHandler{
+		next:     func(ctx context.Context, msg *sarama.ConsumerMessage) error { return errSaldo },
+		producer: producer,
+		policy:   RetryPolicy{Delays: []time.Duration{time.Minute, 10 * time.Minute}},
+		logger:   &logger.Logger{Log: zap.NewNop()},
+		now:      func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	msg := &sarama.ConsumerMessage{
+		Topic:     "transfer-events",
+		Partition: 2,
+		Offset:    41,
+		Key:       []byte("TR-1"),
+		Value:     []byte("payload"),
+		Headers:   []*sarama.RecordHeader{{Key: []byte(IdempotencyKeyHeader), Value: []byte("evt-1")}},
+	}
+	require.NoError(t, h.handle(ctx, msg))
+
+	require.Len(t, producer.Messages, 1)
+	first := producer.Messages[0]
+	assert.Equal(t, "transfer-events.retry.1m", first.Topic)
+	assert.Equal(t, "1", producedHeader(first, HeaderRetryAttempt))
+	assert.Equal(t, "transfer-events", producedHeader(first, HeaderOriginalTopic))
+	assert.Equal(t, "2", producedHeader(first, HeaderOriginalPartition))
+	assert.Equal(t, "41", producedHeader(first, HeaderOriginalOffset))
+	assert.Equal(t, "saldo locked", producedHeader(first, HeaderError))
+	assert.Equal(t, now.Add(time.Minute).Format(time.RFC3339Nano), producedHeader(first, HeaderRetryAt))
+	assert.Equal(t, "evt-1", producedHeader(first, IdempotencyKeyHeader))
+
+	// The retry copy is due, so it is handled at once and moves on to the
+	// second tier, keeping the original position.
+	now = now.Add(time.Minute)
+	require.NoError(t, h.handle(ctx, toConsumed(first, 7)))
+	second := producer.Messages[1]
+	assert.Equal(t, "transfer-events.retry.10m", second.Topic)
+	assert.Equal(t, "2", producedHeader(second, HeaderRetryAttempt))
+	assert.Equal(t, "41", producedHeader(second, HeaderOriginalOffset))
+
+	now = now.Add(10 * time.Minute)
+	require.NoError(t, h.handle(ctx, toConsumed(second, 3)))
+	dead := producer.Messages[2]
+	assert.Equal(t, "transfer-events.dlq", dead.Topic)
+	assert.Equal(t, "3", producedHeader(dead, HeaderRetryAttempt))
+	assert.Empty(t, producedHeader(dead, HeaderRetryAt))
+	assert.Equal(t, "transfer-events", producedHeader(dead, HeaderOriginalTopic))
+}
+
+func TestRetryHandler_Permanent(t *testing.T) {
+	producer := &MockProducer{}
+	h := NewRetryHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return Permanent(errors.New("invalid payload"))
+	}, producer, DefaultRetryPolicy(), &logger.Logger{Log: zap.NewNop()})
+
+	require.NoError(t, h(context.Background(), &sarama.ConsumerMessage{Topic: "topup-events"}))
+	require.Len(t, producer.Messages, 1)
+	assert.Equal(t, "topup-events.dlq", producer.Messages[0].Topic)
+}
+
+func TestRetryHandler_SuccessAndForwardFailure(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		calls++
+		if string(msg.Key) == "bad" {
+			return errors.New("saldo locked")
+		}
+		return nil
+	}
+
+	producer := &MockProducer{ShouldFail: true}
+	h := NewRetryHandler(next, producer, DefaultRetryPolicy(), &logger.Logger{Log: zap.NewNop()})
+
+	assert.NoError(t, h(context.Background(), &sarama.ConsumerMessage{Topic: "topup-events", Key: []byte("good")}))
+	assert.ErrorIs(t, h(context.Background(), &sarama.ConsumerMessage{Topic: "topup-events", Key: []byte("bad")}), sarama.ErrUnknown)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryHandler_WaitsForRetryTime(t *testing.T) {
+	h := NewRetryHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		t.Fatal("handler ran before the retry time")
+		return nil
+	}, &MockProducer{}, DefaultRetryPolicy(), &logger.Logger{Log: zap.NewNop()})
+
+	msg := &sarama.ConsumerMessage{
+		Topic: "topup-events.retry.1m",
+		Headers: []*sarama.RecordHeader{{
+			Key:   []byte(HeaderRetryAt),
+			Value: []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)),
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, h(ctx, msg), context.DeadlineExceeded)
+}
+
+func TestRetryHandler_InvalidRetryTime(t *testing.T) {
+	producer := &MockProducer{}
+	h := NewRetryHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		t.Fatal("handler ran without a valid retry time")
+		return nil
+	}, producer, DefaultRetryPolicy(), &logger.Logger{Log: zap.NewNop()})
+
+	msg := &sarama.ConsumerMessage{
+		Topic: "topup-events.retry.1m",
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("topup-events")},
+			{Key: []byte(HeaderRetryAttempt), Value: []byte("1")},
+			{Key: []byte(HeaderRetryAt), Value: []byte("tomorrow")},
+		},
+	}
+
+	require.NoError(t, h(context.Background(), msg))
+	require.Len(t, producer.Messages, 1)
+	dead := producer.Messages[0]
+	assert.Equal(t, "topup-events.dlq", dead.Topic)
+	assert.Empty(t, producedHeader(dead, HeaderRetryAt))
+	assert.Contains(t, producedHeader(dead, HeaderError), "invalid X-Retry-At header")
+}
+
+func TestDeliveryGeneration(t *testing.T) {
+	assert.Empty(t, deliveryGeneration(&sarama.ConsumerMessage{}))
+	assert.Equal(t, "#.2", deliveryGeneration(&sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderRetryAttempt), Value: []byte("2")}},
+	}))
+	assert.Equal(t, "#1.", deliveryGeneration(&sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderReplayCount), Value: []byte("1")}},
+	}))
+}
+
+type fakeOffsets map[int32][2]int64
+
+func (f fakeOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return f[partition][0], nil
+	}
+	return f[partition][1], nil
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"transfer-events.dlq": {0, 1}})
+
+	dead := func(key string, extra ...*sarama.RecordHeader) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{
+			Topic: "transfer-events.dlq",
+			Key:   []byte(key),
+			Value: []byte("payload"),
+			Headers: append([]*sarama.RecordHeader{
+				{Key: []byte(IdempotencyKeyHeader), Value: []byte("evt-" + key)},
+				{Key: []byte(HeaderRetryAttempt), Value: []byte("3")},
+				{Key: []byte(HeaderError), Value: []byte("saldo locked")},
+				{Key: []byte(HeaderOriginalTopic), Value: []byte("transfer-events")},
+				{Key: []byte(HeaderOriginalOffset), Value: []byte("41")},
+			}, extra...),
+		}
+	}
+
+	consumer.ExpectConsumePartition("transfer-events.dlq", 0, 0).
+		YieldMessage(dead("TR-1")).
+		YieldMessage(dead("TR-2", &sarama.RecordHeader{Key: []byte(HeaderReplayCount), Value: []byte("1")})).
+		YieldMessage(&sarama.ConsumerMessage{Topic: "transfer-events.dlq", Key: []byte("unknown")})
+	// Partition 1 is empty and must not be consumed.
+
+	producer := &MockProducer{}
+	r := newReplayer(consumer, fakeOffsets{0: {0, 3}, 1: {5, 5}}, producer, &logger.Logger{Log: zap.NewNop()})
+
+	result, err := r.Replay(context.Background(), "transfer-events.dlq", ReplayOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Replayed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, map[int32]int64{0: 3, 1: 5}, result.Next)
+
+	require.Len(t, producer.Messages, 2)
+	first := producer.Messages[0]
+	assert.Equal(t, "transfer-events", first.Topic)
+	assert.Equal(t, "evt-TR-1", producedHeader(first, IdempotencyKeyHeader))
+	assert.Equal(t, "1", producedHeader(first, HeaderReplayCount))
+	assert.Empty(t, producedHeader(first, HeaderRetryAttempt))
+	assert.Empty(t, producedHeader(first, HeaderError))
+	assert.Empty(t, producedHeader(first, HeaderOriginalTopic))
+	assert.Equal(t, "2", producedHeader(producer.Messages[1], HeaderReplayCount))
+
+	require.NoError(t, r.Close())
+}
+
+func TestReplayer_ResumeAndFilter(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"topup-events.dlq": {0}})
+
+	pc := consumer.ExpectConsumePartition("topup-events.dlq", 0, 1)
+	for _, key := range []string{"TOP-1", "TOP-2", "TOP-3"} {
+		pc.YieldMessage(&sarama.ConsumerMessage{
+			Topic:   "topup-events.dlq",
+			Key:     []byte(key),
+			Headers: []*sarama.RecordHeader{{Key: []byte(HeaderOriginalTopic), Value: []byte("topup-events")}},
+		})
+	}
+
+	producer := &MockProducer{}
+	r := newReplayer(consumer, fakeOffsets{0: {0, 3}}, producer, &logger.Logger{Log: zap.NewNop()})
+
+	result, err := r.Replay(context.Background(), "topup-events.dlq", ReplayOptions{
+		From:   map[int32]int64{0: 1},
+		Filter: func(msg *sarama.ConsumerMessage) bool { return string(msg.Key) != "TOP-2" },
+	})
+	require.NoError(t, err)
+
+	// The mock numbers yielded messages from the requested offset, so TOP-3 is
+	// past the newest offset taken at the start and is not read.
+	assert.Equal(t, 1, result.Replayed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, int64(3), result.Next[0])
+	require.NoError(t, r.Close())
+}
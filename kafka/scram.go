@@ -0,0 +1,36 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/xdg-go/scram"
+)
+
+var (
+	sha256Generator scram.HashGeneratorFcn = sha256.New
+	sha512Generator scram.HashGeneratorFcn = sha512.New
+)
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (s *scramClient) Begin(userName, password, authzID string) error {
+	client, err := s.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.conversation = client.NewConversation()
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.conversation.Step(challenge)
+}
+
+func (s *scramClient) Done() bool {
+	return s.conversation.Done()
+}
@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the kafka package.
+const instrumentationName = "github.com/MamangRust/monolith-payment-gateway-pkg/kafka"
+
+// ProducerMessageCarrier exposes the headers of a message being produced as a
+// propagation.TextMapCarrier, so a propagator can inject trace context into it.
+type ProducerMessageCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+// NewProducerMessageCarrier creates a carrier over the headers of msg.
+func NewProducerMessageCarrier(msg *sarama.ProducerMessage) ProducerMessageCarrier {
+	return ProducerMessageCarrier{msg: msg}
+}
+
+// Get returns the value of the named header, or an empty string.
+func (c ProducerMessageCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set sets the named header, replacing an existing one.
+func (c ProducerMessageCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys returns the names of the headers.
+func (c ProducerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+// ConsumerMessageCarrier exposes the headers of a consumed message as a
+// propagation.TextMapCarrier, so a propagator can extract trace context from it.
+type ConsumerMessageCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+// NewConsumerMessageCarrier creates a carrier over the headers of msg.
+func NewConsumerMessageCarrier(msg *sarama.ConsumerMessage) ConsumerMessageCarrier {
+	return ConsumerMessageCarrier{msg: msg}
+}
+
+// Get returns the value of the named header, or an empty string.
+func (c ConsumerMessageCarrier) Get(key string) string {
+	return header(c.msg, key)
+}
+
+// Set sets the named header, replacing an existing one.
+func (c ConsumerMessageCarrier) Set(key, value string) {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			h.Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys returns the names of the headers.
+func (c ConsumerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// Tracing creates spans for produced and consumed messages following the
+// OpenTelemetry messaging semantic conventions, and carries the trace context
+// between them in the message headers.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// TracingOption configures a Tracing.
+type TracingOption func(*tracingOptions)
+
+type tracingOptions struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// WithTracerProvider replaces the global TracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(o *tracingOptions) {
+		o.provider = provider
+	}
+}
+
+// WithPropagator replaces the global TextMapPropagator.
+func WithPropagator(propagator propagation.TextMapPropagator) TracingOption {
+	return func(o *tracingOptions) {
+		o.propagator = propagator
+	}
+}
+
+// NewTracing creates a Tracing. By default it uses the global TracerProvider and
+// TextMapPropagator, which otel_pkg.InitTracerProvider sets; until then no spans
+// are recorded.
+func NewTracing(opts ...TracingOption) *Tracing {
+	o := tracingOptions{
+		provider:   otel.GetTracerProvider(),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Tracing{
+		tracer:     o.provider.Tracer(instrumentationName),
+		propagator: o.propagator,
+	}
+}
+
+// orDefault returns t, or a Tracing using the globals when t is nil.
+func (t *Tracing) orDefault() *Tracing {
+	if t == nil {
+		return NewTracing()
+	}
+	return t
+}
+
+// StartProducer starts a "publish" span for msg as a child of ctx and injects
+// its context into the headers of msg. The span must be ended with EndProducer
+// once the message is acknowledged.
+func (t *Tracing) StartProducer(ctx context.Context, msg *sarama.ProducerMessage) (context.Context, trace.Span) {
+	t = t.orDefault()
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingOperationTypePublish,
+		semconv.MessagingOperationName("publish"),
+		semconv.MessagingDestinationName(msg.Topic),
+	}
+	if msg.Key != nil {
+		if key, err := msg.Key.Encode(); err == nil {
+			attrs = append(attrs, semconv.MessagingKafkaMessageKey(string(key)))
+		}
+	}
+	if msg.Value != nil {
+		attrs = append(attrs, semconv.MessagingMessageBodySize(msg.Value.Length()))
+	}
+
+	ctx, span := t.tracer.Start(ctx, "publish "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+	t.propagator.Inject(ctx, NewProducerMessageCarrier(msg))
+	return ctx, span
+}
+
+// EndProducer records the partition and offset msg was written to, or err, and
+// ends the span.
+func (t *Tracing) EndProducer(span trace.Span, msg *sarama.ProducerMessage, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(int(msg.Partition))),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		)
+	}
+	span.End()
+}
+
+// StartConsumer starts a "process" span for msg in the consumer group groupID.
+//
+// The span continues the trace of the producer: it is a child of the context
+// extracted from the headers of msg, unless ctx already holds a span, and links
+// to the producer span either way.
+func (t *Tracing) StartConsumer(ctx context.Context, msg *sarama.ConsumerMessage, groupID string) (context.Context, trace.Span) {
+	t = t.orDefault()
+
+	carrier := NewConsumerMessageCarrier(msg)
+	producer := trace.SpanContextFromContext(t.propagator.Extract(context.Background(), carrier))
+	parent := ctx
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		parent = t.propagator.Extract(ctx, carrier)
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingOperationName("process"),
+		semconv.MessagingDestinationName(msg.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(msg.Partition))),
+		semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		semconv.MessagingMessageBodySize(len(msg.Value)),
+	}
+	if msg.Key != nil {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(string(msg.Key)))
+	}
+	if groupID != "" {
+		attrs = append(attrs, semconv.MessagingKafkaConsumerGroup(groupID))
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	}
+	if producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+
+	return t.tracer.Start(parent, "process "+msg.Topic, opts...)
+}
+
+// Handler wraps next so that every message is handled inside a span started by
+// StartConsumer, which fails when next returns an error. It is usually the
+// outermost MessageHandler passed to NewIdempotentHandler, so retries forwarded
+// by NewRetryHandler are part of the trace.
+func (t *Tracing) Handler(next MessageHandler, groupID string) MessageHandler {
+	t = t.orDefault()
+
+	return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		ctx, span := t.StartConsumer(ctx, msg, groupID)
+		defer span.End()
+
+		err := next(ctx, msg)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// SetTracing replaces the Tracing used by k, which defaults to NewTracing().
+func (k *Kafka) SetTracing(tracing *Tracing) {
+	k.tracing = tracing
+}
+
+// TracingHandler is Tracing.Handler with the Tracing of k.
+func (k *Kafka) TracingHandler(next MessageHandler, groupID string) MessageHandler {
+	return k.tracing.Handler(next, groupID)
+}
@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func newTestTracing(t *testing.T) (*Tracing, *tracetest.SpanRecorder, trace.Tracer) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	tracing := NewTracing(WithTracerProvider(provider), WithPropagator(propagation.TraceContext{}))
+	return tracing, recorder, provider.Tracer("test")
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing_ProducerToConsumer(t *testing.T) {
+	tracing, recorder, tracer := newTestTracing(t)
+	producer := &MockProducer{}
+	k := &Kafka{producer: producer, logger: &logger.Logger{Log: zap.NewNop()}, tracing: tracing}
+
+	ctx, request := tracer.Start(context.Background(), "POST /api/topups")
+	require.NoError(t, k.SendMessageContext(ctx, "topup-events", "TOP-1", []byte("payload")))
+	request.End()
+
+	require.Len(t, producer.Messages, 1)
+	assert.NotEmpty(t, producedHeader(producer.Messages[0], "traceparent"))
+
+	var handled trace.SpanContext
+	handler := k.TracingHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		handled = trace.SpanContextFromContext(ctx)
+		return nil
+	}, "topup-group")
+	require.NoError(t, handler(context.Background(), toConsumed(producer.Messages[0], 12)))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	publish, process := spans[0], spans[2]
+
+	assert.Equal(t, "publish topup-events", publish.Name())
+	assert.Equal(t, trace.SpanKindProducer, publish.SpanKind())
+	assert.Equal(t, request.SpanContext().SpanID(), publish.Parent().SpanID())
+	assert.Equal(t, "kafka", spanAttr(publish, "messaging.system").AsString())
+	assert.Equal(t, "publish", spanAttr(publish, "messaging.operation.type").AsString())
+	assert.Equal(t, "topup-events", spanAttr(publish, "messaging.destination.name").AsString())
+	assert.Equal(t, "TOP-1", spanAttr(publish, "messaging.kafka.message.key").AsString())
+
+	assert.Equal(t, "process topup-events", process.Name())
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind())
+	assert.Equal(t, request.SpanContext().TraceID(), process.SpanContext().TraceID())
+	assert.Equal(t, publish.SpanContext().SpanID(), process.Parent().SpanID())
+	require.Len(t, process.Links(), 1)
+	assert.Equal(t, publish.SpanContext().SpanID(), process.Links()[0].SpanContext.SpanID())
+	assert.Equal(t, "topup-group", spanAttr(process, "messaging.kafka.consumer.group").AsString())
+	assert.Equal(t, int64(12), spanAttr(process, "messaging.kafka.message.offset").AsInt64())
+	assert.Equal(t, process.SpanContext(), handled)
+}
+
+func TestTracing_ConsumerWithParentAndError(t *testing.T) {
+	tracing, recorder, tracer := newTestTracing(t)
+
+	msg := &sarama.ProducerMessage{Topic: "transfer-events", Key: sarama.StringEncoder("TR-1"), Value: sarama.StringEncoder("payload")}
+	_, publish := tracing.StartProducer(context.Background(), msg)
+	tracing.EndProducer(publish, msg, nil)
+
+	ctx, batch := tracer.Start(context.Background(), "batch")
+	defer batch.End()
+
+	errSaldo := errors.New("saldo locked")
+	handler := tracing.Handler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errSaldo
+	}, "")
+	assert.ErrorIs(t, handler(ctx, toConsumed(msg, 0)), errSaldo)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	process := spans[1]
+	assert.Equal(t, batch.SpanContext().SpanID(), process.Parent().SpanID(), "a span in ctx stays the parent")
+	require.Len(t, process.Links(), 1)
+	assert.Equal(t, publish.SpanContext().SpanID(), process.Links()[0].SpanContext.SpanID())
+	assert.Equal(t, codes.Error, process.Status().Code)
+	assert.Equal(t, attribute.INVALID, spanAttr(process, "messaging.kafka.consumer.group").Type())
+}
+
+func TestTracing_SendContextFailure(t *testing.T) {
+	tracing, recorder, _ := newTestTracing(t)
+	k := &Kafka{producer: &MockProducer{ShouldFail: true}, tracing: tracing}
+
+	assert.ErrorIs(t, k.SendContext(context.Background(), &sarama.ProducerMessage{Topic: "withdraw-events"}), sarama.ErrUnknown)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestMessageCarriers(t *testing.T) {
+	produced := &sarama.ProducerMessage{Headers: []sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte("old")}}}
+	pc := NewProducerMessageCarrier(produced)
+	pc.Set("traceparent", "new")
+	pc.Set("tracestate", "rojo=1")
+	assert.Equal(t, "new", pc.Get("traceparent"))
+	assert.Equal(t, []string{"traceparent", "tracestate"}, pc.Keys())
+
+	consumed := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{nil, {Key: []byte("baggage"), Value: []byte("a=1")}}}
+	cc := NewConsumerMessageCarrier(consumed)
+	cc.Set("baggage", "a=2")
+	cc.Set("traceparent", "tp")
+	assert.Equal(t, "a=2", cc.Get("baggage"))
+	assert.Equal(t, []string{"baggage", "traceparent"}, cc.Keys())
+}
+
+func TestRetryHandler_ForwardsTraceContext(t *testing.T) {
+	tracing, recorder, _ := newTestTracing(t)
+	producer := &MockProducer{}
+	k := &Kafka{producer: producer, logger: &logger.Logger{Log: zap.NewNop()}, tracing: tracing}
+
+	source := &sarama.ProducerMessage{Topic: "topup-events", Key: sarama.StringEncoder("TOP-1"), Value: sarama.StringEncoder("payload")}
+	_, publish := tracing.StartProducer(context.Background(), source)
+	tracing.EndProducer(publish, source, nil)
+
+	handler := k.TracingHandler(k.RetryHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("saldo locked")
+	}, DefaultRetryPolicy()), "topup-group")
+	require.NoError(t, handler(context.Background(), toConsumed(source, 0)))
+
+	require.Len(t, producer.Messages, 1)
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	forward, process := spans[1], spans[2]
+
+	assert.Equal(t, "publish topup-events.retry.1m", forward.Name())
+	assert.Equal(t, process.SpanContext().SpanID(), forward.Parent().SpanID())
+	assert.Equal(t, publish.SpanContext().TraceID(), forward.SpanContext().TraceID())
+
+	retried := propagation.TraceContext{}.Extract(context.Background(), NewProducerMessageCarrier(producer.Messages[0]))
+	assert.Equal(t, forward.SpanContext().SpanID(), trace.SpanContextFromContext(retried).SpanID())
+}
+
+func TestAsyncPublisher_Tracing(t *testing.T) {
+	tracing, recorder, _ := newTestTracing(t)
+	p, producer := newMockPublisher(t, 0)
+	p.SetTracing(tracing)
+	ctx := context.Background()
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	require.NoError(t, p.Publish(ctx, "transactions", "tx-1", []byte("a"), nil))
+	require.NoError(t, p.Publish(ctx, "transactions", "tx-2", []byte("b"), nil))
+	require.NoError(t, p.Flush(ctx))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	statuses := map[string]codes.Code{}
+	for _, span := range spans {
+		statuses[spanAttr(span, "messaging.kafka.message.key").AsString()] = span.Status().Code
+	}
+	assert.Equal(t, map[string]codes.Code{"tx-1": codes.Unset, "tx-2": codes.Error}, statuses)
+
+	require.NoError(t, p.Close(ctx))
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-shared/domain/response"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// ApiKeyHeader is the request header carrying the merchant API key.
+	ApiKeyHeader = "X-Api-Key"
+
+	// MerchantKey is the echo context key under which MerchantApiKey stores the merchant.
+	MerchantKey = "auth_merchant"
+
+	// MerchantStatusActive is the status of merchants that may use their API key.
+	MerchantStatusActive = "active"
+
+	// ApiKeyKey is the echo context key under which MerchantScopedApiKey and
+	// MerchantSignature store the key.
+	ApiKeyKey = "auth_api_key"
+)
+
+// MerchantLookup finds a merchant by the stored hash of its API key.
+// It is implemented by *db.Queries.
+type MerchantLookup interface {
+	GetMerchantByApiKey(ctx context.Context, apiKey string) (*db.Merchant, error)
+}
+
+// MerchantApiKey returns an echo middleware that authenticates merchants with the
+// API key from the X-Api-Key header.
+//
+// The key is hashed with apikey.HashKey before the lookup, so merchants.api_key
+// only ever holds hashes. Keys created by apikey.GenerateApiKey keep working
+// once apikey.MigrateLegacyKeys has hashed them. Unknown or malformed keys are
+// rejected with 401, merchants whose status is not active with 403. On success
+// the merchant is stored in the echo context under MerchantKey.
+func MerchantApiKey(merchants MerchantLookup, logger logger.LoggerInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw := c.Request().Header.Get(ApiKeyHeader)
+			if raw == "" {
+				return unauthorizedApiKey(c, "missing_api_key", "Missing API key")
+			}
+
+			hash, err := apikey.HashKey(raw)
+			if err != nil {
+				return unauthorizedApiKey(c, "invalid_api_key", "Invalid API key")
+			}
+
+			merchant, err := merchants.GetMerchantByApiKey(c.Request().Context(), hash)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return unauthorizedApiKey(c, "invalid_api_key", "Invalid API key")
+				}
+
+				logger.Error("Failed to find merchant by api key", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
+					Status:  "error",
+					Message: "Failed to authenticate merchant",
+					Code:    http.StatusInternalServerError,
+				})
+			}
+
+			if merchant.Status != MerchantStatusActive {
+				logger.Debug("Rejected api key of inactive merchant",
+					zap.Int("merchant.id", int(merchant.MerchantID)),
+					zap.String("merchant.status", merchant.Status),
+				)
+				return forbidden(c, "Merchant is not active")
+			}
+
+			c.Set(MerchantKey, merchant)
+
+			return next(c)
+		}
+	}
+}
+
+// ApiKeyAuthenticator finds the merchant and the key for a full API key.
+// It is implemented by *apikey.Service.
+type ApiKeyAuthenticator interface {
+	Authenticate(ctx context.Context, raw string) (*db.Merchant, *apikey.MerchantKey, error)
+}
+
+// MerchantScopedApiKey returns an echo middleware that authenticates merchants
+// with one of their API keys from merchant_api_keys, sent in the X-Api-Key
+// header, and requires the key to carry every one of the given scopes.
+//
+// Unknown or malformed keys are rejected with 401, as are revoked and expired
+// keys. Merchants whose status is not active and keys missing a scope are
+// rejected with 403. On success the merchant is stored under MerchantKey and the
+// key under ApiKeyKey.
+func MerchantScopedApiKey(keys ApiKeyAuthenticator, logger logger.LoggerInterface, scopes ...apikey.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw := c.Request().Header.Get(ApiKeyHeader)
+			if raw == "" {
+				return unauthorizedApiKey(c, "missing_api_key", "Missing API key")
+			}
+
+			merchant, key, err := keys.Authenticate(c.Request().Context(), raw)
+			if err != nil {
+				switch {
+				case errors.Is(err, apikey.ErrInvalidKey):
+					return unauthorizedApiKey(c, "invalid_api_key", "Invalid API key")
+				case errors.Is(err, apikey.ErrKeyExpired):
+					return unauthorizedApiKey(c, "api_key_expired", "API key has expired")
+				case errors.Is(err, apikey.ErrKeyRevoked):
+					return unauthorizedApiKey(c, "api_key_revoked", "API key has been revoked")
+				default:
+					logger.Error("Failed to authenticate api key", zap.Error(err))
+					return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
+						Status:  "error",
+						Message: "Failed to authenticate merchant",
+						Code:    http.StatusInternalServerError,
+					})
+				}
+			}
+
+			if merchant.Status != MerchantStatusActive {
+				logger.Debug("Rejected api key of inactive merchant",
+					zap.Int("merchant.id", int(merchant.MerchantID)),
+					zap.String("merchant.status", merchant.Status),
+				)
+				return forbidden(c, "Merchant is not active")
+			}
+
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					return forbidden(c, "API key is missing the required scope")
+				}
+			}
+
+			c.Set(MerchantKey, merchant)
+			c.Set(ApiKeyKey, key)
+
+			return next(c)
+		}
+	}
+}
+
+// ApiKey returns the key stored by MerchantScopedApiKey or MerchantSignature.
+func ApiKey(c echo.Context) (*apikey.MerchantKey, bool) {
+	key, ok := c.Get(ApiKeyKey).(*apikey.MerchantKey)
+	return key, ok && key != nil
+}
+
+// Merchant returns the merchant stored by MerchantApiKey, MerchantScopedApiKey or
+// MerchantSignature.
+func Merchant(c echo.Context) (*db.Merchant, bool) {
+	merchant, ok := c.Get(MerchantKey).(*db.Merchant)
+	return merchant, ok && merchant != nil
+}
+
+func unauthorizedApiKey(c echo.Context, status, message string) error {
+	return c.JSON(http.StatusUnauthorized, response.ErrorResponse{
+		Status:  status,
+		Message: message,
+		Code:    http.StatusUnauthorized,
+	})
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type merchantLookupFunc func(ctx context.Context, apiKey string) (*db.Merchant, error)
+
+func (f merchantLookupFunc) GetMerchantByApiKey(ctx context.Context, apiKey string) (*db.Merchant, error) {
+	return f(ctx, apiKey)
+}
+
+func TestMerchantApiKey(t *testing.T) {
+	active, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	inactive, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	broken, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	legacy, err := apikey.GenerateApiKey()
+	require.NoError(t, err)
+	legacyHash, err := apikey.HashKey(legacy)
+	require.NoError(t, err)
+
+	merchants := map[string]*db.Merchant{
+		active.Hash():   {MerchantID: 1, ApiKey: active.Hash(), Status: "active"},
+		inactive.Hash(): {MerchantID: 2, ApiKey: inactive.Hash(), Status: "deactive"},
+		legacyHash:      {MerchantID: 3, ApiKey: legacyHash, Status: "active"},
+	}
+	lookup := merchantLookupFunc(func(ctx context.Context, hash string) (*db.Merchant, error) {
+		if hash == broken.Hash() {
+			return nil, errors.New("connection refused")
+		}
+		if m, ok := merchants[hash]; ok {
+			return m, nil
+		}
+		return nil, sql.ErrNoRows
+	})
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		merchant, ok := Merchant(c)
+		require.True(t, ok)
+		return c.JSON(http.StatusOK, merchant.MerchantID)
+	}, MerchantApiKey(lookup, &logger.Logger{Log: zap.NewNop()}))
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set(ApiKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(active.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "1", rec.Body.String())
+
+	rec = request(legacy)
+	assert.Equal(t, http.StatusOK, rec.Code, "keys migrated by MigrateLegacyKeys keep working")
+	assert.JSONEq(t, "3", rec.Body.String())
+
+	rec = request(legacyHash)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "the stored legacy hash must not authenticate")
+
+	rec = request("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "missing_api_key", decodeError(t, rec).Status)
+
+	rec = request(active.Hash())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "the stored hash must not authenticate")
+	assert.Equal(t, "invalid_api_key", decodeError(t, rec).Status)
+
+	unknown, _ := apikey.GenerateKey()
+	rec = request(unknown.String())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_api_key", decodeError(t, rec).Status)
+
+	rec = request(inactive.String())
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "forbidden", decodeError(t, rec).Status)
+
+	rec = request(broken.String())
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+type authenticatorFunc func(ctx context.Context, raw string) (*db.Merchant, *apikey.MerchantKey, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, raw string) (*db.Merchant, *apikey.MerchantKey, error) {
+	return f(ctx, raw)
+}
+
+func TestMerchantScopedApiKey(t *testing.T) {
+	merchant := &db.Merchant{MerchantID: 1, Status: "active"}
+	keys := authenticatorFunc(func(ctx context.Context, raw string) (*db.Merchant, *apikey.MerchantKey, error) {
+		switch raw {
+		case "payments":
+			return merchant, &apikey.MerchantKey{ID: 1, Scopes: []apikey.Scope{apikey.ScopeRead, apikey.ScopePayments}}, nil
+		case "read-only":
+			return merchant, &apikey.MerchantKey{ID: 2, Scopes: []apikey.Scope{apikey.ScopeRead}}, nil
+		case "expired":
+			return nil, nil, apikey.ErrKeyExpired
+		case "revoked":
+			return nil, nil, apikey.ErrKeyRevoked
+		default:
+			return nil, nil, apikey.ErrInvalidKey
+		}
+	})
+
+	e := echo.New()
+	e.POST("/payments", func(c echo.Context) error {
+		key, ok := ApiKey(c)
+		require.True(t, ok)
+		return c.JSON(http.StatusOK, key.ID)
+	}, MerchantScopedApiKey(keys, &logger.Logger{Log: zap.NewNop()}, apikey.ScopePayments))
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", nil)
+		req.Header.Set(ApiKeyHeader, key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("payments")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "1", rec.Body.String())
+
+	rec = request("read-only")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "forbidden", decodeError(t, rec).Status)
+
+	for raw, status := range map[string]string{
+		"expired": "api_key_expired",
+		"revoked": "api_key_revoked",
+		"unknown": "invalid_api_key",
+	} {
+		rec = request(raw)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, raw)
+		assert.Equal(t, status, decodeError(t, rec).Status, raw)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/MamangRust/monolith-payment-gateway-pkg/auth"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-shared/domain/response"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// ClaimsKey is the echo context key under which JWTAuth stores the token claims.
+const ClaimsKey = "auth_claims"
+
+// contextValidator is implemented by token managers that can use the request
+// context for validation, e.g. for revocation lookups.
+type contextValidator interface {
+	ValidateTokenContext(ctx context.Context, tokenString string) (*auth.Claims, error)
+}
+
+// JWTAuth returns an echo middleware that authenticates requests with the bearer
+// token from the Authorization header.
+//
+// On success the token claims are stored both in the echo context under ClaimsKey
+// and in the request context, see auth.ClaimsFromContext. On failure the request is
+// rejected with a 401 response.ErrorResponse.
+func JWTAuth(tokens auth.TokenManager, logger logger.LoggerInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenString, ok := bearerToken(c.Request())
+			if !ok {
+				return unauthorized(c, "missing_token", "Missing or malformed bearer token")
+			}
+
+			var (
+				claims *auth.Claims
+				err    error
+			)
+			if v, ok := tokens.(contextValidator); ok {
+				claims, err = v.ValidateTokenContext(c.Request().Context(), tokenString)
+			} else {
+				claims, err = tokens.ValidateToken(tokenString)
+			}
+
+			if err != nil {
+				switch {
+				case errors.Is(err, auth.ErrTokenExpired):
+					return unauthorized(c, "token_expired", "Token has expired")
+				case errors.Is(err, auth.ErrTokenRevoked):
+					return unauthorized(c, "token_revoked", "Token has been revoked")
+				default:
+					logger.Debug("Failed to validate token", zap.Error(err))
+					return unauthorized(c, "invalid_token", "Invalid token")
+				}
+			}
+
+			c.Set(ClaimsKey, claims)
+			c.SetRequest(c.Request().WithContext(auth.ContextWithClaims(c.Request().Context(), claims)))
+
+			return next(c)
+		}
+	}
+}
+
+// Claims returns the claims stored by JWTAuth.
+func Claims(c echo.Context) (*auth.Claims, bool) {
+	claims, ok := c.Get(ClaimsKey).(*auth.Claims)
+	return claims, ok && claims != nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get(echo.HeaderAuthorization)
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(c echo.Context, status, message string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	return c.JSON(http.StatusUnauthorized, response.ErrorResponse{
+		Status:  status,
+		Message: message,
+		Code:    http.StatusUnauthorized,
+	})
+}
+
+func forbidden(c echo.Context, message string) error {
+	return c.JSON(http.StatusForbidden, response.ErrorResponse{
+		Status:  "forbidden",
+		Message: message,
+		Code:    http.StatusForbidden,
+	})
+}
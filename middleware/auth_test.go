@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MamangRust/monolith-payment-gateway-pkg/auth"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/permission"
+	"github.com/MamangRust/monolith-payment-gateway-shared/domain/response"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestManager(t *testing.T) *auth.Manager {
+	t.Helper()
+
+	mgr, err := auth.NewManager("mySecretKey", auth.WithRevocationStore(auth.NewInMemoryRevocationStore()))
+	require.NoError(t, err)
+	return mgr
+}
+
+func serve(e *echo.Echo, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) response.ErrorResponse {
+	t.Helper()
+
+	var body response.ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return body
+}
+
+func TestJWTAuth(t *testing.T) {
+	mgr := newTestManager(t)
+	log := &logger.Logger{Log: zap.NewNop()}
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		claims, ok := Claims(c)
+		require.True(t, ok)
+
+		fromCtx, ok := auth.ClaimsFromContext(c.Request().Context())
+		require.True(t, ok)
+		assert.Equal(t, claims, fromCtx)
+
+		return c.String(http.StatusOK, claims.Subject)
+	}, JWTAuth(mgr, log))
+
+	tokenStr, err := mgr.GenerateToken(auth.NewClaims(21))
+	require.NoError(t, err)
+
+	rec := serve(e, tokenStr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "21", rec.Body.String())
+
+	rec = serve(e, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "missing_token", decodeError(t, rec).Status)
+
+	rec = serve(e, "not.a.token")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_token", decodeError(t, rec).Status)
+
+	claims, err := mgr.ValidateToken(tokenStr)
+	require.NoError(t, err)
+	require.NoError(t, mgr.Revoke(context.Background(), claims))
+
+	rec = serve(e, tokenStr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "token_revoked", decodeError(t, rec).Status)
+}
+
+func TestRequireRolesAndScopes(t *testing.T) {
+	mgr := newTestManager(t)
+	log := &logger.Logger{Log: zap.NewNop()}
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+
+	e := echo.New()
+	e.GET("/admin", ok, JWTAuth(mgr, log), RequireRoles("ROLE_ADMIN", "ROLE_SUPERADMIN"))
+	e.GET("/topup", ok, JWTAuth(mgr, log), RequireScopes("topup:read", "topup:write"))
+
+	admin := auth.NewClaims(1)
+	admin.Roles = []string{"ROLE_ADMIN"}
+	admin.Scopes = []string{"topup:read"}
+	adminToken, err := mgr.GenerateToken(admin)
+	require.NoError(t, err)
+
+	user := auth.NewClaims(2)
+	user.Roles = []string{"ROLE_USER"}
+	user.Scopes = []string{"topup:read", "topup:write"}
+	userToken, err := mgr.GenerateToken(user)
+	require.NoError(t, err)
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, request("/admin", adminToken).Code)
+
+	rec := request("/admin", userToken)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "forbidden", decodeError(t, rec).Status)
+
+	assert.Equal(t, http.StatusNoContent, request("/topup", userToken).Code)
+	assert.Equal(t, http.StatusForbidden, request("/topup", adminToken).Code)
+}
+
+// staticPermissions grants fixed permissions per user.
+type staticPermissions map[int]permission.Set
+
+func (s staticPermissions) Can(ctx context.Context, userID int, p permission.Permission) (bool, error) {
+	return s[userID].Has(p), nil
+}
+
+func TestRequirePermissions(t *testing.T) {
+	mgr := newTestManager(t)
+	log := &logger.Logger{Log: zap.NewNop()}
+
+	checker := staticPermissions{
+		1: permission.NewSet(permission.TopupRead, permission.TopupApprove),
+		2: permission.NewSet(permission.TopupRead),
+	}
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, JWTAuth(mgr, log), RequirePermissions(checker, log, permission.TopupRead, permission.TopupApprove))
+
+	adminToken, err := mgr.GenerateToken(auth.NewClaims(1))
+	require.NoError(t, err)
+	userToken, err := mgr.GenerateToken(auth.NewClaims(2))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, serve(e, adminToken).Code)
+
+	rec := serve(e, userToken)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "forbidden", decodeError(t, rec).Status)
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/permission"
+	"github.com/MamangRust/monolith-payment-gateway-shared/domain/response"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// RequireRoles returns an echo middleware that lets a request through only when
+// the claims stored by JWTAuth carry at least one of the given role names, as
+// assigned with AssignRoleToUser. It must be registered after JWTAuth.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := Claims(c)
+			if !ok {
+				return unauthorized(c, "missing_token", "Authentication required")
+			}
+
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					return next(c)
+				}
+			}
+
+			return forbidden(c, "You do not have the required role")
+		}
+	}
+}
+
+// RequireScopes returns an echo middleware that lets a request through only when
+// the claims stored by JWTAuth carry every one of the given scopes. It must be
+// registered after JWTAuth.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := Claims(c)
+			if !ok {
+				return unauthorized(c, "missing_token", "Authentication required")
+			}
+
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					return forbidden(c, "Token is missing the required scope")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// PermissionChecker resolves whether a user holds a permission.
+// It is implemented by *permission.Evaluator.
+type PermissionChecker interface {
+	Can(ctx context.Context, userID int, p permission.Permission) (bool, error)
+}
+
+// RequirePermissions returns an echo middleware that lets a request through only
+// when the user of the claims stored by JWTAuth holds every one of the given
+// permissions. Unlike RequireRoles the permissions are resolved from the current
+// roles of the user, not from the token. It must be registered after JWTAuth.
+//
+// Resource-level checks, such as reading only your own cards, need the loaded
+// resource and are done in the handler with permission.Evaluator.RequireAccess.
+func RequirePermissions(checker PermissionChecker, logger logger.LoggerInterface, perms ...permission.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := Claims(c)
+			if !ok {
+				return unauthorized(c, "missing_token", "Authentication required")
+			}
+
+			userID, err := claims.UserID()
+			if err != nil {
+				return unauthorized(c, "invalid_token", "Invalid token")
+			}
+
+			for _, p := range perms {
+				allowed, err := checker.Can(c.Request().Context(), userID, p)
+				if err != nil {
+					logger.Error("Failed to check permission",
+						zap.Int("user_id", userID),
+						zap.String("permission", string(p)),
+						zap.Error(err),
+					)
+					return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
+						Status:  "error",
+						Message: "Failed to check permissions",
+						Code:    http.StatusInternalServerError,
+					})
+				}
+				if !allowed {
+					return forbidden(c, "You do not have the required permission")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
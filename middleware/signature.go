@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/signature"
+	"github.com/MamangRust/monolith-payment-gateway-shared/domain/response"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// SigningKeyFinder finds the merchant, the key and the request signing key for
+// the key ID of a signed request. It is implemented by *apikey.Service.
+type SigningKeyFinder interface {
+	SigningKey(ctx context.Context, keyID string) (*db.Merchant, *apikey.MerchantKey, []byte, error)
+}
+
+// MerchantSignature returns an echo middleware that authenticates merchants by
+// requests signed with signature.Signer.
+//
+// The key ID header is looked up in merchant_api_keys and merchants.api_key and
+// the request is checked with the signing key stored for the key, never with
+// its hash. The verifier also rejects replayed nonces. Unknown, revoked and
+// expired keys and keys that cannot sign are rejected with 401, bodies over the
+// limit of the verifier with 413 and merchants whose status is not active with
+// 403. On success the merchant is stored in the echo
+// context under MerchantKey and the key under ApiKeyKey.
+func MerchantSignature(keys SigningKeyFinder, verifier *signature.Verifier, logger logger.LoggerInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			keyID, err := signature.KeyID(c.Request())
+			if err != nil {
+				return unauthorizedApiKey(c, "missing_signature", "Missing request signature")
+			}
+
+			merchant, key, signingKey, err := keys.SigningKey(c.Request().Context(), keyID)
+			if err != nil {
+				switch {
+				case errors.Is(err, apikey.ErrInvalidKey):
+					return unauthorizedApiKey(c, "invalid_signature", "Invalid request signature")
+				case errors.Is(err, apikey.ErrKeyExpired):
+					return unauthorizedApiKey(c, "api_key_expired", "API key has expired")
+				case errors.Is(err, apikey.ErrKeyRevoked):
+					return unauthorizedApiKey(c, "api_key_revoked", "API key has been revoked")
+				case errors.Is(err, apikey.ErrNoSigningKey):
+					return unauthorizedApiKey(c, "signing_key_missing", "API key cannot sign requests, create a new key")
+				default:
+					logger.Error("Failed to find request signing key", zap.Error(err))
+					return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
+						Status:  "error",
+						Message: "Failed to authenticate merchant",
+						Code:    http.StatusInternalServerError,
+					})
+				}
+			}
+
+			if err := verifier.Verify(c.Request(), signingKey); err != nil {
+				switch {
+				case errors.Is(err, signature.ErrMissingSignature):
+					return unauthorizedApiKey(c, "missing_signature", "Missing request signature")
+				case errors.Is(err, signature.ErrExpiredSignature):
+					return unauthorizedApiKey(c, "signature_expired", "Request signature has expired")
+				case errors.Is(err, signature.ErrReplayedNonce):
+					return unauthorizedApiKey(c, "replayed_request", "Request has already been processed")
+				case errors.Is(err, signature.ErrInvalidSignature):
+					return unauthorizedApiKey(c, "invalid_signature", "Invalid request signature")
+				case errors.Is(err, signature.ErrBodyTooLarge):
+					return c.JSON(http.StatusRequestEntityTooLarge, response.ErrorResponse{
+						Status:  "request_too_large",
+						Message: "Request body is too large",
+						Code:    http.StatusRequestEntityTooLarge,
+					})
+				default:
+					logger.Error("Failed to verify request signature", zap.Error(err))
+					return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
+						Status:  "error",
+						Message: "Failed to authenticate merchant",
+						Code:    http.StatusInternalServerError,
+					})
+				}
+			}
+
+			if merchant.Status != MerchantStatusActive {
+				logger.Debug("Rejected signed request of inactive merchant",
+					zap.Int("merchant.id", int(merchant.MerchantID)),
+					zap.String("merchant.status", merchant.Status),
+				)
+				return forbidden(c, "Merchant is not active")
+			}
+
+			c.Set(MerchantKey, merchant)
+			c.Set(ApiKeyKey, key)
+
+			return next(c)
+		}
+	}
+}
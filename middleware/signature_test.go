@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/signature"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type signingKeyFinderFunc func(ctx context.Context, keyID string) (*db.Merchant, *apikey.MerchantKey, []byte, error)
+
+func (f signingKeyFinderFunc) SigningKey(ctx context.Context, keyID string) (*db.Merchant, *apikey.MerchantKey, []byte, error) {
+	return f(ctx, keyID)
+}
+
+func TestMerchantSignature(t *testing.T) {
+	active, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	inactive, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	revoked, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	legacy, err := apikey.GenerateKey()
+	require.NoError(t, err)
+
+	merchants := map[string]*db.Merchant{
+		active.Prefix:   {MerchantID: 1, ApiKey: active.Hash(), Status: "active"},
+		inactive.Prefix: {MerchantID: 2, ApiKey: inactive.Hash(), Status: "deactive"},
+	}
+	keys := map[string]*apikey.Key{active.Prefix: active, inactive.Prefix: inactive}
+	lookup := signingKeyFinderFunc(func(ctx context.Context, keyID string) (*db.Merchant, *apikey.MerchantKey, []byte, error) {
+		switch keyID {
+		case revoked.Prefix:
+			return nil, nil, nil, apikey.ErrKeyRevoked
+		case legacy.Prefix:
+			return nil, nil, nil, apikey.ErrNoSigningKey
+		}
+		m, ok := merchants[keyID]
+		if !ok {
+			return nil, nil, nil, apikey.ErrInvalidKey
+		}
+		return m, &apikey.MerchantKey{MerchantID: int(m.MerchantID), Prefix: keyID}, keys[keyID].SigningKey(), nil
+	})
+
+	verifier := signature.NewVerifier(signature.NewInMemoryNonceStore(), 0, signature.WithMaxBodySize(64))
+
+	e := echo.New()
+	e.POST("/api/topups", func(c echo.Context) error {
+		merchant, ok := Merchant(c)
+		require.True(t, ok)
+		key, ok := ApiKey(c)
+		require.True(t, ok)
+		assert.Equal(t, int(merchant.MerchantID), key.MerchantID)
+
+		body, err := io.ReadAll(c.Request().Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"amount":50000}`, string(body))
+
+		return c.JSON(http.StatusCreated, merchant.MerchantID)
+	}, MerchantSignature(lookup, verifier, &logger.Logger{Log: zap.NewNop()}))
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	postBody := func(key *apikey.Key, body string) *http.Response {
+		t.Helper()
+
+		signer, err := signature.NewSigner(key.String(), nil)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: signer}
+		resp, err := client.Post(srv.URL+"/api/topups", echo.MIMEApplicationJSON, strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	post := func(key *apikey.Key) *http.Response {
+		t.Helper()
+		return postBody(key, `{"amount":50000}`)
+	}
+
+	assert.Equal(t, http.StatusCreated, post(active).StatusCode)
+	assert.Equal(t, http.StatusForbidden, post(inactive).StatusCode)
+
+	unknown, _ := apikey.GenerateKey()
+	assert.Equal(t, http.StatusUnauthorized, post(unknown).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, post(revoked).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, post(legacy).StatusCode)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postBody(active, `{"note":"`+strings.Repeat("x", 64)+`"}`).StatusCode)
+
+	resp, err := http.Post(srv.URL+"/api/topups", echo.MIMEApplicationJSON, strings.NewReader(`{"amount":50000}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
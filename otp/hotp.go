@@ -0,0 +1,56 @@
+package otp
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// HOTP generates and verifies RFC 4226 counter based codes.
+type HOTP struct {
+	cfg Config
+}
+
+// NewHOTP creates a HOTP with the given config. Zero fields take the values of DefaultConfig.
+func NewHOTP(cfg Config) *HOTP {
+	return &HOTP{cfg: cfg.withDefaults()}
+}
+
+// Generate returns the code for the given counter.
+func (h *HOTP) Generate(secret string, counter uint64) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return generate(key, counter, h.cfg.Digits, h.cfg.Algorithm)
+}
+
+// Verify checks the code against the counter and the lookahead counters after it,
+// since the authenticator may have generated codes that were never used. It
+// returns the counter to store for the next verification, which is one past the
+// matching counter, so the same code cannot be used twice.
+func (h *HOTP) Verify(secret, code string, counter uint64, lookahead int) (uint64, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return counter, err
+	}
+
+	for i := 0; i <= lookahead; i++ {
+		expected, err := generate(key, counter+uint64(i), h.cfg.Digits, h.cfg.Algorithm)
+		if err != nil {
+			return counter, err
+		}
+		if equalCodes(expected, code) {
+			return counter + uint64(i) + 1, nil
+		}
+	}
+
+	return counter, ErrInvalidCode
+}
+
+// ProvisioningURI returns the otpauth://hotp URI to enroll the secret in an
+// authenticator app, starting at the given counter.
+func (h *HOTP) ProvisioningURI(secret, account string, counter uint64) string {
+	return provisioningURI("hotp", h.cfg, secret, account, url.Values{
+		"counter": {strconv.FormatUint(counter, 10)},
+	})
+}
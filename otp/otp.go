@@ -0,0 +1,166 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCode is returned when a one-time code does not match.
+	ErrInvalidCode = errors.New("invalid one-time code")
+
+	// ErrInvalidSecret is returned when a secret is not valid base32.
+	ErrInvalidSecret = errors.New("invalid one-time password secret")
+
+	// ErrInvalidConfig is returned when a Config cannot produce codes.
+	ErrInvalidConfig = errors.New("invalid one-time password config")
+)
+
+// Algorithm is the HMAC hash used to compute codes.
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+// secretEncoding is the base32 alphabet used by authenticator apps, without padding.
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Config holds the parameters shared by the issuer and the authenticator app.
+// Most apps only support the defaults.
+type Config struct {
+	Issuer    string
+	Digits    int
+	Algorithm Algorithm
+	// Period is the lifetime of a TOTP code, at least a second.
+	Period time.Duration
+	// Skew is the number of periods before and after the current one whose
+	// codes are still accepted, to allow for clock drift.
+	Skew int
+}
+
+// DefaultConfig returns a Config with 6 digit SHA1 codes valid for 30 seconds,
+// accepting one period of drift either way.
+func DefaultConfig(issuer string) Config {
+	return Config{
+		Issuer:    issuer,
+		Digits:    6,
+		Algorithm: SHA1,
+		Period:    30 * time.Second,
+		Skew:      1,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	def := DefaultConfig(c.Issuer)
+	if c.Digits == 0 {
+		c.Digits = def.Digits
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = def.Algorithm
+	}
+	if c.Period == 0 {
+		c.Period = def.Period
+	}
+	if c.Skew < 0 {
+		c.Skew = 0
+	}
+	return c
+}
+
+// GenerateSecret returns a random 160 bit secret encoded in base32, the size
+// recommended by RFC 4226.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimRight(secret, "="), " ", ""))
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// generate computes the RFC 4226 code for the counter.
+func generate(key []byte, counter uint64, digits int, algorithm Algorithm) (string, error) {
+	var h func() hash.Hash
+	switch algorithm {
+	case SHA1:
+		h = sha1.New
+	case SHA256:
+		h = sha256.New
+	case SHA512:
+		h = sha512.New
+	default:
+		return "", fmt.Errorf("unsupported otp algorithm %q", algorithm)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(h, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
+
+func equalCodes(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// provisioningURI returns an otpauth:// URI as understood by authenticator apps.
+func provisioningURI(kind string, cfg Config, secret, account string, extra url.Values) string {
+	label := account
+	if cfg.Issuer != "" {
+		label = cfg.Issuer + ":" + account
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	if cfg.Issuer != "" {
+		params.Set("issuer", cfg.Issuer)
+	}
+	params.Set("algorithm", string(cfg.Algorithm))
+	params.Set("digits", strconv.Itoa(cfg.Digits))
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     kind,
+		Path:     "/" + label,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
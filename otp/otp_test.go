@@ -0,0 +1,109 @@
+package otp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"image/png"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the secret "12345678901234567890" used by the test vectors of
+// RFC 4226 and RFC 6238.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP_RFC4226(t *testing.T) {
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	hotp := NewHOTP(Config{})
+	for counter, want := range expected {
+		code, err := hotp.Generate(rfcSecret, uint64(counter))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "counter %d", counter)
+	}
+
+	next, err := hotp.Verify(rfcSecret, "969429", 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), next)
+
+	_, err = hotp.Verify(rfcSecret, "969429", 4, 3)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestTOTP_RFC6238(t *testing.T) {
+	totp, err := NewTOTP(Config{Digits: 8})
+	require.NoError(t, err)
+
+	for unix, want := range map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	} {
+		code, err := totp.Generate(rfcSecret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestNewTOTP_InvalidPeriod(t *testing.T) {
+	for _, period := range []time.Duration{time.Millisecond, 999 * time.Millisecond, -time.Second} {
+		_, err := NewTOTP(Config{Period: period})
+		assert.ErrorIs(t, err, ErrInvalidConfig, period)
+	}
+
+	_, err := NewTOTP(Config{Period: time.Second})
+	assert.NoError(t, err)
+}
+
+func TestTOTP_VerifyDrift(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	totp, err := NewTOTP(DefaultConfig("PaymentGateway"))
+	require.NoError(t, err)
+	totp.now = func() time.Time { return now }
+
+	previous, err := totp.Generate(secret, now.Add(-30*time.Second))
+	require.NoError(t, err)
+
+	step, err := totp.Verify(secret, previous)
+	require.NoError(t, err)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	stale, err := totp.Generate(secret, now.Add(-90*time.Second))
+	require.NoError(t, err)
+
+	_, err = totp.Verify(secret, stale)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	_, err = totp.Verify("not base32!", "123456")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestTOTP_ProvisioningURIAndQRCode(t *testing.T) {
+	totp, err := NewTOTP(DefaultConfig("Payment Gateway"))
+	require.NoError(t, err)
+	uri := totp.ProvisioningURI(rfcSecret, "budi@example.com")
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Payment Gateway:budi@example.com", u.Path)
+	assert.Equal(t, rfcSecret, u.Query().Get("secret"))
+	assert.Equal(t, "Payment Gateway", u.Query().Get("issuer"))
+	assert.Equal(t, "30", u.Query().Get("period"))
+
+	data, err := QRCodePNG(uri, 128)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+}
@@ -0,0 +1,11 @@
+package otp
+
+import (
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QRCodePNG renders the provisioning URI as a PNG image of size by size pixels,
+// ready to be scanned by an authenticator app.
+func QRCodePNG(uri string, size int) ([]byte, error) {
+	return qrcode.Encode(uri, qrcode.Medium, size)
+}
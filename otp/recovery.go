@@ -0,0 +1,97 @@
+package otp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// recoveryAlphabet leaves out characters that are easily confused when typed.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n random recovery codes of the form "xxxxx-xxxxx".
+// They are shown to the user once and only their hashes are stored.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+func randomRecoveryCode() (string, error) {
+	// Bytes past the largest multiple of the alphabet size are skipped so every
+	// character is equally likely.
+	limit := byte(256 - 256%len(recoveryAlphabet))
+	buf := make([]byte, 16)
+
+	var b strings.Builder
+	for n := 0; n < 10; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if c >= limit || n == 10 {
+				continue
+			}
+			if n == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+			n++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// NormalizeRecoveryCode lower cases the code and removes dashes and spaces, so
+// codes are accepted however the user typed them.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+// HashRecoveryCodes returns the hex encoded SHA-256 of each normalized code.
+// Recovery codes are random with about 50 bits of entropy, so a fast hash is
+// enough, and a wrong code at login costs no more than a TOTP check.
+func HashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(NormalizeRecoveryCode(code))
+	}
+	return hashes
+}
+
+// MatchRecoveryCode returns the index of the hash matching the code, or -1.
+// Every hash is compared in constant time.
+func MatchRecoveryCode(hashes []string, code string) int {
+	normalized := NormalizeRecoveryCode(code)
+	if normalized == "" {
+		return -1
+	}
+
+	computed := []byte(hashRecoveryCode(normalized))
+	match := -1
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare(computed, []byte(h)) == 1 && match < 0 {
+			match = i
+		}
+	}
+	return match
+}
+
+func hashRecoveryCode(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
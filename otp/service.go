@@ -0,0 +1,327 @@
+package otp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes issued to a user.
+	RecoveryCodeCount = 10
+
+	qrCodeSize = 256
+)
+
+var (
+	// ErrNotEnrolled is returned when the user has not enabled two-factor authentication.
+	ErrNotEnrolled = errors.New("two-factor authentication not enabled")
+
+	// ErrCodeReused is returned when a TOTP code that was already accepted is presented again.
+	ErrCodeReused = errors.New("one-time code already used")
+
+	// ErrAlreadyEnrolled is returned by Enroll and Confirm while two-factor
+	// authentication is enabled; it has to be disabled with a valid code first.
+	ErrAlreadyEnrolled = errors.New("two-factor authentication already enabled")
+)
+
+// Enrollment is what the user needs to add the secret to an authenticator app.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode []byte `json:"qr_code"`
+}
+
+// Service manages TOTP two-factor authentication of users, stored in
+// user_two_factors and user_recovery_codes.
+//
+// Accepted time steps are recorded per user so a code can only be used once,
+// and recovery codes are stored as SHA-256 hashes and marked used on login.
+type Service struct {
+	db      *sql.DB
+	queries *db.Queries
+	totp    *TOTP
+	logger  logger.LoggerInterface
+}
+
+// NewService creates a new Service.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - totp: The TOTP parameters shared with the authenticator apps (*TOTP)
+//   - logger: The logger used to report recovery code use (logger.LoggerInterface)
+//
+// Returns:
+//   - *Service: The initialized service
+func NewService(conn *sql.DB, queries *db.Queries, totp *TOTP, logger logger.LoggerInterface) *Service {
+	return &Service{
+		db:      conn,
+		queries: queries,
+		totp:    totp,
+		logger:  logger,
+	}
+}
+
+// Enroll generates a new secret for the user and returns its provisioning URI
+// and QR code. Two-factor authentication is only enabled once Confirm succeeds.
+// A pending enrollment is replaced, but ErrAlreadyEnrolled is returned while
+// two-factor authentication is enabled, so it cannot be turned off without a
+// code; Disable it first.
+func (s *Service) Enroll(ctx context.Context, userID int, accountName string) (*Enrollment, error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if _, err := s.queries.CreateUserTwoFactor(ctx, db.CreateUserTwoFactorParams{
+		UserID: int32(userID),
+		Secret: secret,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAlreadyEnrolled
+		}
+		return nil, fmt.Errorf("failed to store two-factor secret: %w", err)
+	}
+
+	uri := s.totp.ProvisioningURI(secret, accountName)
+	png, err := QRCodePNG(uri, qrCodeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render qr code: %w", err)
+	}
+
+	return &Enrollment{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// Confirm enables two-factor authentication once the user entered a valid code
+// from the newly enrolled authenticator, and returns fresh recovery codes.
+// ErrAlreadyEnrolled is returned once it is enabled, so the recovery codes are
+// only replaced through RegenerateRecoveryCodes.
+func (s *Service) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	var codes []string
+
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		tf, err := s.getTwoFactor(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		if tf.ConfirmedAt.Valid {
+			return ErrAlreadyEnrolled
+		}
+
+		if err := s.verifyTOTP(ctx, q, tf, code); err != nil {
+			return err
+		}
+
+		if err := q.ConfirmUserTwoFactor(ctx, int32(userID)); err != nil {
+			return fmt.Errorf("failed to confirm two-factor authentication: %w", err)
+		}
+
+		codes, err = s.replaceRecoveryCodes(ctx, q, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Enabled reports whether the user has confirmed two-factor authentication.
+func (s *Service) Enabled(ctx context.Context, userID int) (bool, error) {
+	tf, err := s.queries.GetUserTwoFactor(ctx, int32(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+	return tf.ConfirmedAt.Valid, nil
+}
+
+// Verify checks the second factor at login, after hash.ComparePassword accepted
+// the password. The code may be a TOTP code or one of the recovery codes.
+func (s *Service) Verify(ctx context.Context, userID int, code string) error {
+	tf, err := s.getTwoFactor(ctx, s.queries, userID)
+	if err != nil {
+		return err
+	}
+	if !tf.ConfirmedAt.Valid {
+		return ErrNotEnrolled
+	}
+
+	return s.verifyCode(ctx, s.queries, tf, code)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user once code,
+// a valid TOTP or recovery code, proves the second factor. ErrNotEnrolled is
+// returned unless two-factor authentication is enabled.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	var codes []string
+
+	err := s.withTx(ctx, func(q *db.Queries) error {
+		tf, err := s.getTwoFactor(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		if !tf.ConfirmedAt.Valid {
+			return ErrNotEnrolled
+		}
+		if err := s.verifyCode(ctx, q, tf, code); err != nil {
+			return err
+		}
+
+		codes, err = s.replaceRecoveryCodes(ctx, q, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable removes the secret and the recovery codes of the user. While
+// two-factor authentication is enabled, code must be a valid TOTP or recovery
+// code; a pending enrollment is removed without one.
+func (s *Service) Disable(ctx context.Context, userID int, code string) error {
+	return s.withTx(ctx, func(q *db.Queries) error {
+		tf, err := s.getTwoFactor(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		if tf.ConfirmedAt.Valid {
+			if err := s.verifyCode(ctx, q, tf, code); err != nil {
+				return err
+			}
+		}
+
+		if err := q.DeleteRecoveryCodes(ctx, int32(userID)); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if err := q.DeleteUserTwoFactor(ctx, int32(userID)); err != nil {
+			return fmt.Errorf("failed to delete two-factor authentication: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *Service) getTwoFactor(ctx context.Context, q *db.Queries, userID int) (*db.UserTwoFactor, error) {
+	tf, err := q.GetUserTwoFactor(ctx, int32(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotEnrolled
+		}
+		return nil, fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+	return tf, nil
+}
+
+// verifyTOTP checks the code against the stored secret and records its time step.
+func (s *Service) verifyTOTP(ctx context.Context, q *db.Queries, tf *db.UserTwoFactor, code string) error {
+	step, err := s.totp.Verify(tf.Secret, code)
+	if err != nil {
+		return err
+	}
+
+	updated, err := q.UpdateUserTwoFactorStep(ctx, db.UpdateUserTwoFactorStepParams{
+		UserID:       tf.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record one-time code: %w", err)
+	}
+	if updated == 0 {
+		return ErrCodeReused
+	}
+
+	return nil
+}
+
+// verifyCode accepts a TOTP code or, failing that, one of the recovery codes.
+func (s *Service) verifyCode(ctx context.Context, q *db.Queries, tf *db.UserTwoFactor, code string) error {
+	err := s.verifyTOTP(ctx, q, tf, code)
+	if !errors.Is(err, ErrInvalidCode) {
+		return err
+	}
+
+	return s.useRecoveryCode(ctx, q, int(tf.UserID), code)
+}
+
+func (s *Service) useRecoveryCode(ctx context.Context, q *db.Queries, userID int, code string) error {
+	stored, err := q.GetUnusedRecoveryCodes(ctx, int32(userID))
+	if err != nil {
+		return fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+
+	hashes := make([]string, len(stored))
+	for i, rc := range stored {
+		hashes[i] = rc.CodeHash
+	}
+
+	i := MatchRecoveryCode(hashes, code)
+	if i < 0 {
+		return ErrInvalidCode
+	}
+
+	used, err := q.UseRecoveryCode(ctx, stored[i].RecoveryCodeID)
+	if err != nil {
+		return fmt.Errorf("failed to mark recovery code used: %w", err)
+	}
+	if used == 0 {
+		return ErrCodeReused
+	}
+
+	s.logger.Info("Recovery code used",
+		zap.Int("user_id", userID),
+		zap.Int("remaining", len(stored)-1),
+	)
+
+	return nil
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, q *db.Queries, userID int) ([]string, error) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+
+	hashes := HashRecoveryCodes(codes)
+
+	if err := q.DeleteRecoveryCodes(ctx, int32(userID)); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, h := range hashes {
+		if err := q.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			UserID:   int32(userID),
+			CodeHash: h,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	return codes, nil
+}
+
+func (s *Service) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
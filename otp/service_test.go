@@ -0,0 +1,282 @@
+package otp
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var twoFactorColumns = []string{"user_id", "secret", "confirmed_at", "last_used_step", "created_at", "updated_at"}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	totp, err := NewTOTP(DefaultConfig("PaymentGateway"))
+	require.NoError(t, err)
+
+	svc := NewService(conn, db.New(conn), totp, &logger.Logger{Log: zap.NewNop()})
+	return svc, mock
+}
+
+func TestService_VerifyTOTP(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := svc.totp.Generate(secret, time.Now())
+	require.NoError(t, err)
+	step := svc.totp.Step(time.Now())
+
+	expectTwoFactor := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors\nWHERE user_id = $1")).
+			WithArgs(int32(3)).
+			WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, time.Now(), 0, nil, nil))
+	}
+
+	expectTwoFactor()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_two_factors\nSET last_used_step = $2")).
+		WithArgs(int32(3), step).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, svc.Verify(context.Background(), 3, code))
+
+	// The same code again: the step is no longer after last_used_step.
+	expectTwoFactor()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_two_factors\nSET last_used_step = $2")).
+		WithArgs(int32(3), step).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, svc.Verify(context.Background(), 3, code), ErrCodeReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_VerifyRecoveryCode(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	codes, err := GenerateRecoveryCodes(2)
+	require.NoError(t, err)
+	hashes := HashRecoveryCodes(codes)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, time.Now(), 0, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"recovery_code_id", "user_id", "code_hash", "used_at", "created_at"}).
+			AddRow(10, 3, hashes[0], nil, nil).
+			AddRow(11, 3, hashes[1], nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_recovery_codes\nSET used_at = current_timestamp")).
+		WithArgs(int32(11)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Recovery codes are accepted in upper case and without the dash.
+	typed := NormalizeRecoveryCode(codes[1])
+	require.NoError(t, svc.Verify(context.Background(), 3, strings.ToUpper(typed[:5])+" "+typed[5:]))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_VerifyNotEnrolled(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnError(sql.ErrNoRows)
+	assert.ErrorIs(t, svc.Verify(context.Background(), 3, "123456"), ErrNotEnrolled)
+
+	secret, _ := GenerateSecret()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, nil, 0, nil, nil))
+	assert.ErrorIs(t, svc.Verify(context.Background(), 3, "123456"), ErrNotEnrolled)
+}
+
+func TestService_Confirm(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := svc.totp.Generate(secret, time.Now())
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, nil, 0, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET last_used_step = $2")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET confirmed_at = current_timestamp")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < RecoveryCodeCount; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_recovery_codes")).
+			WithArgs(int32(3), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+
+	codes, err := svc.Confirm(context.Background(), 3, code)
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, codes[0])
+
+	hashes := HashRecoveryCodes(codes)
+	assert.Equal(t, 3, MatchRecoveryCode(hashes, codes[3]))
+	assert.Equal(t, -1, MatchRecoveryCode(hashes, "aaaaa-aaaaa"))
+	assert.Equal(t, -1, MatchRecoveryCode(hashes, ""))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_EnrollWhileEnabled(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	// The upsert leaves a confirmed enrollment alone and returns no row.
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_two_factors.confirmed_at IS NULL")).
+		WithArgs(int32(3), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(twoFactorColumns))
+
+	_, err := svc.Enroll(context.Background(), 3, "budi@example.com")
+	assert.ErrorIs(t, err, ErrAlreadyEnrolled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_Disable(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := svc.totp.Generate(secret, time.Now())
+	require.NoError(t, err)
+
+	expectTwoFactor := func(confirmedAt any) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+			WithArgs(int32(3)).
+			WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, confirmedAt, 0, nil, nil))
+	}
+
+	// A wrong code keeps two-factor authentication enabled.
+	expectTwoFactor(time.Now())
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"recovery_code_id", "user_id", "code_hash", "used_at", "created_at"}))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, svc.Disable(context.Background(), 3, "000000"), ErrInvalidCode)
+
+	expectTwoFactor(time.Now())
+	mock.ExpectExec(regexp.QuoteMeta("SET last_used_step = $2")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, svc.Disable(context.Background(), 3, code))
+
+	// A pending enrollment is removed without a code.
+	expectTwoFactor(nil)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, svc.Disable(context.Background(), 3, ""))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_ConfirmWhileEnabled(t *testing.T) {
+	svc, mock := newTestService(t)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := svc.totp.Generate(secret, time.Now())
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, time.Now(), 0, nil, nil))
+	mock.ExpectRollback()
+
+	_, err = svc.Confirm(context.Background(), 3, code)
+	assert.ErrorIs(t, err, ErrAlreadyEnrolled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_RegenerateRecoveryCodes(t *testing.T) {
+	svc, mock := newTestService(t)
+	ctx := context.Background()
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := svc.totp.Generate(secret, time.Now())
+	require.NoError(t, err)
+
+	expectTwoFactor := func(confirmedAt any) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_two_factors")).
+			WithArgs(int32(3)).
+			WillReturnRows(sqlmock.NewRows(twoFactorColumns).AddRow(3, secret, confirmedAt, 0, nil, nil))
+	}
+
+	// A pending enrollment has no recovery codes to replace.
+	expectTwoFactor(nil)
+	mock.ExpectRollback()
+
+	_, err = svc.RegenerateRecoveryCodes(ctx, 3, code)
+	assert.ErrorIs(t, err, ErrNotEnrolled)
+
+	// A wrong code keeps the recovery codes.
+	expectTwoFactor(time.Now())
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"recovery_code_id", "user_id", "code_hash", "used_at", "created_at"}))
+	mock.ExpectRollback()
+
+	_, err = svc.RegenerateRecoveryCodes(ctx, 3, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	expectTwoFactor(time.Now())
+	mock.ExpectExec(regexp.QuoteMeta("SET last_used_step = $2")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_recovery_codes")).
+		WithArgs(int32(3)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	for i := 0; i < RecoveryCodeCount; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_recovery_codes")).
+			WithArgs(int32(3), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+
+	codes, err := svc.RegenerateRecoveryCodes(ctx, 3, code)
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
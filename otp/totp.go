@@ -0,0 +1,75 @@
+package otp
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TOTP generates and verifies RFC 6238 time based codes.
+type TOTP struct {
+	cfg Config
+	now func() time.Time
+}
+
+// NewTOTP creates a TOTP with the given config. Zero fields take the values of
+// DefaultConfig. A period under a second is rejected with ErrInvalidConfig,
+// since codes are counted in whole seconds.
+func NewTOTP(cfg Config) (*TOTP, error) {
+	cfg = cfg.withDefaults()
+	if cfg.Period < time.Second {
+		return nil, fmt.Errorf("%w: period %s is under a second", ErrInvalidConfig, cfg.Period)
+	}
+	return &TOTP{cfg: cfg, now: time.Now}, nil
+}
+
+// Step returns the time step the given time falls in.
+func (t *TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.cfg.Period/time.Second)
+}
+
+// Generate returns the code for the given time.
+func (t *TOTP) Generate(secret string, at time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return generate(key, uint64(t.Step(at)), t.cfg.Digits, t.cfg.Algorithm)
+}
+
+// Verify checks the code against the current time step and Skew steps either
+// way. It returns the matching step; callers must reject steps at or before
+// the last accepted one to prevent a code from being replayed.
+func (t *TOTP) Verify(secret, code string) (int64, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	current := t.Step(t.now())
+	for i := -t.cfg.Skew; i <= t.cfg.Skew; i++ {
+		step := current + int64(i)
+		if step < 0 {
+			continue
+		}
+
+		expected, err := generate(key, uint64(step), t.cfg.Digits, t.cfg.Algorithm)
+		if err != nil {
+			return 0, err
+		}
+		if equalCodes(expected, code) {
+			return step, nil
+		}
+	}
+
+	return 0, ErrInvalidCode
+}
+
+// ProvisioningURI returns the otpauth://totp URI to enroll the secret in an
+// authenticator app.
+func (t *TOTP) ProvisioningURI(secret, account string) string {
+	return provisioningURI("totp", t.cfg, secret, account, url.Values{
+		"period": {strconv.Itoa(int(t.cfg.Period / time.Second))},
+	})
+}
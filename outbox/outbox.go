@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// W3C trace context headers stored with each event, see Write.
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// ErrInvalidEvent is returned when an event has no topic.
+var ErrInvalidEvent = errors.New("invalid outbox event")
+
+// Event is a domain event to be published to a Kafka topic.
+type Event struct {
+	Topic   string
+	Key     string
+	Payload []byte
+}
+
+// NewEvent creates an event with v encoded as JSON.
+func NewEvent(topic, key string, v any) (Event, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+	return Event{Topic: topic, Key: key, Payload: payload}, nil
+}
+
+// Write stores events in outbox_events using q, which must be bound to the
+// transaction of the business write with Queries.WithTx. The events are
+// published by a Relay once the transaction commits, and discarded with it when
+// it rolls back.
+//
+// The trace context of ctx, as injected by the global TextMapPropagator, is
+// stored with the events, so the relay publishes them within the trace of the
+// request that wrote them.
+func Write(ctx context.Context, q *db.Queries, events ...Event) error {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	for _, event := range events {
+		if event.Topic == "" {
+			return fmt.Errorf("%w: missing topic", ErrInvalidEvent)
+		}
+
+		_, err := q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+			Topic:       event.Topic,
+			EventKey:    event.Key,
+			Payload:     event.Payload,
+			Traceparent: nullString(carrier.Get(traceparentHeader)),
+			Tracestate:  nullString(carrier.Get(tracestateHeader)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,316 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/kafka"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var outboxColumns = []string{"outbox_id", "topic", "event_key", "payload", "attempts", "last_error", "available_at", "sent_at", "created_at", "traceparent", "tracestate"}
+
+type sentMessage struct {
+	topic, key string
+	value      []byte
+}
+
+type fakePublisher struct {
+	mu     sync.Mutex
+	fail   map[string]error
+	sent   []sentMessage
+	traces []trace.SpanContext
+}
+
+func (p *fakePublisher) SendMessageContext(ctx context.Context, topic string, key string, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.fail[key]; err != nil {
+		return err
+	}
+	p.sent = append(p.sent, sentMessage{topic, key, value})
+	p.traces = append(p.traces, trace.SpanContextFromContext(ctx))
+	return nil
+}
+
+// useTraceContext installs the W3C propagator for the duration of the test.
+func useTraceContext(t *testing.T) {
+	t.Helper()
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+}
+
+func (p *fakePublisher) messages() []sentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]sentMessage(nil), p.sent...)
+}
+
+func newTestRelay(t *testing.T, publisher Publisher, opts ...RelayOption) (*Relay, sqlmock.Sqlmock, time.Time) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts = append([]RelayOption{WithBackoff(kafka.Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2})}, opts...)
+	relay := NewRelay(conn, db.New(conn), publisher, &logger.Logger{Log: zap.NewNop()}, opts...)
+	relay.now = func() time.Time { return now }
+	return relay, mock, now
+}
+
+func TestWrite(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	event, err := NewEvent("topup-events", "TOP-1", map[string]int{"amount": 50000})
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO outbox_events")).
+		WithArgs("topup-events", "TOP-1", []byte(`{"amount":50000}`), nil, nil).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "topup-events", "TOP-1", []byte(`{"amount":50000}`), 0, nil, time.Now(), nil, time.Now(), nil, nil))
+	mock.ExpectCommit()
+
+	tx, err := conn.Begin()
+	require.NoError(t, err)
+	require.NoError(t, Write(context.Background(), db.New(conn).WithTx(tx), event))
+	require.NoError(t, tx.Commit())
+
+	err = Write(context.Background(), db.New(conn), Event{Key: "TOP-2"})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWrite_TraceContext(t *testing.T) {
+	useTraceContext(t)
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("rojo=00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO outbox_events")).
+		WithArgs("topup-events", "TOP-1", []byte("a"), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "rojo=00f067aa0ba902b7").
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "topup-events", "TOP-1", []byte("a"), 0, nil, time.Now(), nil, time.Now(), nil, nil))
+
+	require.NoError(t, Write(ctx, db.New(conn), Event{Topic: "topup-events", Key: "TOP-1", Payload: []byte("a")}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_ProcessBatch_TraceContext(t *testing.T) {
+	useTraceContext(t)
+	publisher := &fakePublisher{}
+	relay, mock, now := newTestRelay(t, publisher)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(DefaultBatchSize).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "topup-events", "TOP-1", []byte("a"), 0, nil, now, nil, now, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "rojo=1").
+			AddRow(2, "topup-events", "TOP-2", []byte("b"), 0, nil, now, nil, now, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := relay.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, publisher.traces, 2)
+
+	traced := publisher.traces[0]
+	assert.True(t, traced.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traced.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", traced.SpanID().String())
+	assert.Equal(t, "rojo=1", traced.TraceState().String())
+	assert.False(t, publisher.traces[1].IsValid())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_ProcessBatch(t *testing.T) {
+	errKafka := errors.New("leader not available")
+	publisher := &fakePublisher{fail: map[string]error{"TR-2": errKafka}}
+	relay, mock, now := newTestRelay(t, publisher, WithBatchSize(10))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "transfer-events", "TR-1", []byte("a"), 0, nil, now, nil, now, nil, nil).
+			AddRow(2, "transfer-events", "TR-2", []byte("b"), 2, "timeout", now, nil, now, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1")).
+		WithArgs(2, errKafka.Error(), now.Add(4*time.Second)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	claimed, err := relay.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.Equal(t, []sentMessage{{"transfer-events", "TR-1", []byte("a")}}, publisher.messages())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_ProcessBatch_KeepsKeyOrder(t *testing.T) {
+	errKafka := errors.New("leader not available")
+	publisher := &fakePublisher{fail: map[string]error{"TR-2": errKafka}}
+	relay, mock, now := newTestRelay(t, publisher, WithBatchSize(10))
+
+	// TR-2 fails, so its later event stays pending behind the retry while the
+	// events of other keys are still published.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "transfer-events", "TR-2", []byte("a"), 0, nil, now, nil, now, nil, nil).
+			AddRow(2, "transfer-events", "TR-2", []byte("b"), 0, nil, now, nil, now, nil, nil).
+			AddRow(3, "transfer-events", "TR-3", []byte("c"), 0, nil, now, nil, now, nil, nil).
+			AddRow(4, "topup-events", "TR-2", []byte("d"), 0, nil, now, nil, now, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1")).
+		WithArgs(1, errKafka.Error(), now.Add(time.Second)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1")).
+		WithArgs(4, errKafka.Error(), now.Add(time.Second)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	claimed, err := relay.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, claimed)
+	assert.Equal(t, []sentMessage{{"transfer-events", "TR-3", []byte("c")}}, publisher.messages())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_ProcessBatch_RollsBackOnError(t *testing.T) {
+	publisher := &fakePublisher{}
+	relay, mock, now := newTestRelay(t, publisher)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(DefaultBatchSize).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "transfer-events", "TR-1", []byte("a"), 0, nil, now, nil, now, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(1).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err := relay.ProcessBatch(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_Run(t *testing.T) {
+	publisher := &fakePublisher{}
+	relay, mock, now := newTestRelay(t, publisher, WithBatchSize(1), WithPollInterval(time.Hour))
+
+	// A full batch is followed by the next one right away; the empty batch
+	// after it makes the relay wait for the poll interval.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "topup-events", "TOP-1", []byte("a"), 0, nil, now, nil, now, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET sent_at = current_timestamp")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(outboxColumns))
+	mock.ExpectCommit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return mock.ExpectationsWereMet() == nil
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Len(t, publisher.messages(), 1)
+}
+
+func TestRelay_Run_ClosedNotifications(t *testing.T) {
+	notify := make(chan *pq.Notification)
+	close(notify)
+	relay, mock, _ := newTestRelay(t, &fakePublisher{}, WithPollInterval(time.Hour), WithNotifications(notify))
+
+	core, logs := observer.New(zap.ErrorLevel)
+	relay.logger = &logger.Logger{Log: zap.New(core)}
+
+	// Only the first poll runs: the closed channel must not wake the relay.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(DefaultBatchSize).
+		WillReturnRows(sqlmock.NewRows(outboxColumns))
+	mock.ExpectCommit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return mock.ExpectationsWereMet() == nil
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, logs.FilterMessage("Outbox notification channel closed, falling back to polling").Len())
+	assert.Zero(t, logs.FilterMessage("Failed to relay outbox events").Len())
+}
+
+func TestRelay_Purge(t *testing.T) {
+	relay, mock, now := newTestRelay(t, &fakePublisher{})
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM outbox_events")).
+		WithArgs(now.Add(-24 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+
+	deleted, err := relay.Purge(context.Background(), 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
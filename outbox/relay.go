@@ -0,0 +1,285 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/kafka"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultBatchSize is the number of events a relay claims per transaction.
+	DefaultBatchSize = 100
+
+	// DefaultPollInterval is how long a relay waits before looking for new
+	// events when the previous batch was not full.
+	DefaultPollInterval = time.Second
+
+	// NotifyChannel is the channel a trigger on outbox_events can notify, see
+	// WithNotifications.
+	NotifyChannel = "outbox_events"
+)
+
+// Publisher sends one message to Kafka within the trace of ctx and returns
+// once it is acknowledged. It is implemented by *kafka.Kafka.
+type Publisher interface {
+	SendMessageContext(ctx context.Context, topic string, key string, value []byte) error
+}
+
+// RelayOption configures a Relay.
+type RelayOption func(*Relay)
+
+// WithBatchSize sets how many events are claimed per transaction.
+func WithBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithPollInterval sets how long the relay waits for new events.
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		if interval > 0 {
+			r.pollInterval = interval
+		}
+	}
+}
+
+// WithBackoff sets the delay before an event that failed to publish is retried.
+// Backoff.MaxRetries is ignored: events are retried until they are published.
+func WithBackoff(backoff kafka.Backoff) RelayOption {
+	return func(r *Relay) {
+		r.backoff = backoff
+	}
+}
+
+// WithNotifications wakes the relay as soon as a notification arrives instead
+// of at the next poll, typically the Notify channel of a pq.Listener listening
+// on NotifyChannel. Polling continues as a fallback, and is all that is left
+// once the channel is closed.
+func WithNotifications(notify <-chan *pq.Notification) RelayOption {
+	return func(r *Relay) {
+		r.notify = notify
+	}
+}
+
+// Relay publishes the events stored by Write to Kafka.
+//
+// Each batch is claimed with FOR UPDATE SKIP LOCKED inside a transaction, sent,
+// and marked sent or failed before the transaction commits, so several relays
+// can share the table. An event is sent at least once: if the relay stops after
+// Kafka acknowledged an event but before the commit, it is sent again.
+//
+// Events with the same topic and key are published in the order they were
+// written: while an event waits for a retry, the later events of its key are
+// held back. Each event is sent within the trace context stored by Write, so
+// the producer span joins the trace of the request that wrote it.
+type Relay struct {
+	db           *sql.DB
+	queries      *db.Queries
+	publisher    Publisher
+	logger       logger.LoggerInterface
+	batchSize    int
+	pollInterval time.Duration
+	backoff      kafka.Backoff
+	notify       <-chan *pq.Notification
+	now          func() time.Time
+}
+
+// NewRelay creates a new Relay.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - publisher: The producer events are sent with, such as *kafka.Kafka (Publisher)
+//   - logger: The logger used to report failed events (logger.LoggerInterface)
+//   - opts: Options overriding DefaultBatchSize, DefaultPollInterval and kafka.DefaultBackoff
+//
+// Returns:
+//   - *Relay: The initialized relay
+func NewRelay(conn *sql.DB, queries *db.Queries, publisher Publisher, logger logger.LoggerInterface, opts ...RelayOption) *Relay {
+	r := &Relay{
+		db:           conn,
+		queries:      queries,
+		publisher:    publisher,
+		logger:       logger,
+		batchSize:    DefaultBatchSize,
+		pollInterval: DefaultPollInterval,
+		backoff:      kafka.DefaultBackoff(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run publishes events until ctx is done. Full batches are followed by the next
+// one right away; otherwise the relay waits for the poll interval or a
+// notification. Errors are logged and the batch is retried at the next poll.
+func (r *Relay) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	notify := r.notify
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		case _, ok := <-notify:
+			if !ok {
+				r.logger.Error("Outbox notification channel closed, falling back to polling")
+				notify = nil
+				continue
+			}
+		}
+
+		wait := r.pollInterval
+		sent, err := r.ProcessBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			r.logger.Error("Failed to relay outbox events", zap.Error(err))
+		} else if sent == r.batchSize {
+			wait = 0
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// ProcessBatch claims up to the batch size of pending events and publishes
+// them. It returns the number of claimed events, including those that failed
+// and were scheduled for a retry.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	var claimed int
+
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		events, err := q.GetPendingOutboxEvents(ctx, int32(r.batchSize))
+		if err != nil {
+			return fmt.Errorf("failed to get outbox events: %w", err)
+		}
+		claimed = len(events)
+
+		// blocked holds the keys whose earlier event failed in this batch.
+		blocked := make(map[eventKey]bool)
+		for _, event := range events {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key := eventKey{event.Topic, event.EventKey}
+			if blocked[key] {
+				continue
+			}
+			sent, err := r.publish(ctx, q, event)
+			if err != nil {
+				return err
+			}
+			if !sent {
+				blocked[key] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return claimed, nil
+}
+
+// Purge deletes events that were published more than olderThan ago.
+func (r *Relay) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	deleted, err := r.queries.DeleteSentOutboxEvents(ctx, sql.NullTime{
+		Time:  r.now().Add(-olderThan),
+		Valid: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox events: %w", err)
+	}
+	return deleted, nil
+}
+
+// eventKey identifies the events that must be published in order.
+type eventKey struct {
+	topic, key string
+}
+
+// eventContext returns ctx carrying the trace context stored with event.
+func eventContext(ctx context.Context, event *db.OutboxEvent) context.Context {
+	carrier := propagation.MapCarrier{}
+	if event.Traceparent.Valid {
+		carrier.Set(traceparentHeader, event.Traceparent.String)
+	}
+	if event.Tracestate.Valid {
+		carrier.Set(tracestateHeader, event.Tracestate.String)
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// publish sends event and reports whether Kafka acknowledged it. A failed event
+// is scheduled for a retry.
+func (r *Relay) publish(ctx context.Context, q *db.Queries, event *db.OutboxEvent) (bool, error) {
+	sendErr := r.publisher.SendMessageContext(eventContext(ctx, event), event.Topic, event.EventKey, event.Payload)
+	if sendErr == nil {
+		if err := q.MarkOutboxEventSent(ctx, event.OutboxID); err != nil {
+			return false, fmt.Errorf("failed to mark outbox event sent: %w", err)
+		}
+		return true, nil
+	}
+
+	attempt := int(event.Attempts) + 1
+	retryAt := r.now().Add(r.backoff.Delay(attempt))
+
+	r.logger.Error("Failed to publish outbox event",
+		zap.Int64("outbox.id", event.OutboxID),
+		zap.String("topic", event.Topic),
+		zap.Int("attempt", attempt),
+		zap.Time("retry_at", retryAt),
+		zap.Error(sendErr),
+	)
+
+	err := q.MarkOutboxEventFailed(ctx, db.MarkOutboxEventFailedParams{
+		OutboxID:    event.OutboxID,
+		LastError:   sql.NullString{String: sendErr.Error(), Valid: true},
+		AvailableAt: retryAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	return false, nil
+}
+
+func (r *Relay) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(r.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache keeps the resolved permissions of users so that GetUserRoles is not
+// queried on every check.
+type Cache interface {
+	// Get returns the cached permissions of the user, or false when there are none.
+	Get(ctx context.Context, userID int) ([]Permission, bool, error)
+	// Set caches the permissions of the user for ttl.
+	Set(ctx context.Context, userID int, perms []Permission, ttl time.Duration) error
+	// Delete removes the cached permissions of the user.
+	Delete(ctx context.Context, userID int) error
+}
+
+// InMemoryCache is a Cache kept in process memory. Every instance has its own
+// copy, so role changes only reach other instances after the TTL.
+type InMemoryCache struct {
+	mu      sync.Mutex
+	entries map[int]cacheEntry
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	perms     []Permission
+	expiresAt time.Time
+}
+
+// NewInMemoryCache creates an empty InMemoryCache.
+func NewInMemoryCache() *InMemoryCache {
+	return &InMemoryCache{
+		entries: make(map[int]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached permissions of the user, or false when there are none.
+func (c *InMemoryCache) Get(ctx context.Context, userID int) ([]Permission, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[userID]
+	if !ok || !e.expiresAt.After(c.now()) {
+		delete(c.entries, userID)
+		return nil, false, nil
+	}
+	return e.perms, true, nil
+}
+
+// Set caches the permissions of the user for ttl.
+func (c *InMemoryCache) Set(ctx context.Context, userID int, perms []Permission, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[userID] = cacheEntry{perms: perms, expiresAt: c.now().Add(ttl)}
+	return nil
+}
+
+// Delete removes the cached permissions of the user.
+func (c *InMemoryCache) Delete(ctx context.Context, userID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	return nil
+}
+
+// RedisCache is a Cache backed by Redis, shared by every instance so that
+// Invalidate takes effect everywhere at once.
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache creates a RedisCache. The client is usually the Client of a
+// redisclient connection.
+func NewRedisCache(client redis.UniversalClient) *RedisCache {
+	return &RedisCache{
+		client: client,
+		prefix: "permission:user:",
+	}
+}
+
+// Get returns the cached permissions of the user, or false when there are none.
+// The value holds the permissions separated by commas and is empty for users
+// without permissions.
+func (c *RedisCache) Get(ctx context.Context, userID int) ([]Permission, bool, error) {
+	value, err := c.client.Get(ctx, c.key(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	if value == "" {
+		return []Permission{}, true, nil
+	}
+
+	parts := strings.Split(value, ",")
+	perms := make([]Permission, 0, len(parts))
+	for _, p := range parts {
+		perms = append(perms, Permission(p))
+	}
+	return perms, true, nil
+}
+
+// Set caches the permissions of the user for ttl.
+func (c *RedisCache) Set(ctx context.Context, userID int, perms []Permission, ttl time.Duration) error {
+	parts := make([]string, 0, len(perms))
+	for _, p := range perms {
+		parts = append(parts, string(p))
+	}
+
+	return c.client.Set(ctx, c.key(userID), strings.Join(parts, ","), ttl).Err()
+}
+
+// Delete removes the cached permissions of the user.
+func (c *RedisCache) Delete(ctx context.Context, userID int) error {
+	return c.client.Del(ctx, c.key(userID)).Err()
+}
+
+func (c *RedisCache) key(userID int) string {
+	return c.prefix + strconv.Itoa(userID)
+}
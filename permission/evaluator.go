@@ -0,0 +1,168 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ErrForbidden is returned by Require and RequireAccess when the user lacks the permission.
+var ErrForbidden = errors.New("permission denied")
+
+// DefaultCacheTTL is how long resolved permissions are cached unless WithCache
+// sets another TTL.
+const DefaultCacheTTL = 5 * time.Minute
+
+// RoleLoader loads the roles assigned to a user. *db.Queries implements it.
+type RoleLoader interface {
+	GetUserRoles(ctx context.Context, userID int32) ([]*db.Role, error)
+}
+
+// Option configures an Evaluator.
+type Option func(*Evaluator)
+
+// WithCache replaces the default in-memory cache, e.g. with a RedisCache shared
+// by every instance. A ttl of zero or less disables caching.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(e *Evaluator) {
+		e.cache = cache
+		e.ttl = ttl
+	}
+}
+
+// Evaluator resolves the effective permissions of users from their roles and
+// answers permission checks.
+//
+// Permissions are cached per user; call Invalidate after AssignRoleToUser,
+// RemoveRoleFromUser or any other change to the roles of a user. Cache errors
+// are logged and the roles are loaded from the database instead.
+type Evaluator struct {
+	roles   RoleLoader
+	mapping Mapping
+	cache   Cache
+	ttl     time.Duration
+	logger  logger.LoggerInterface
+}
+
+// NewEvaluator creates a new Evaluator.
+//
+// Parameters:
+//   - roles: Loads the roles of a user, usually the generated queries (RoleLoader)
+//   - mapping: The permissions granted by each role name (Mapping)
+//   - logger: The logger used to report cache failures (logger.LoggerInterface)
+//   - opts: Optional settings such as WithCache (...Option)
+//
+// Returns:
+//   - *Evaluator: The initialized evaluator
+func NewEvaluator(roles RoleLoader, mapping Mapping, logger logger.LoggerInterface, opts ...Option) *Evaluator {
+	e := &Evaluator{
+		roles:   roles,
+		mapping: mapping,
+		cache:   NewInMemoryCache(),
+		ttl:     DefaultCacheTTL,
+		logger:  logger,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Permissions returns the effective permissions of the user. Roles that have
+// been trashed grant nothing.
+func (e *Evaluator) Permissions(ctx context.Context, userID int) (Set, error) {
+	if e.caching() {
+		perms, ok, err := e.cache.Get(ctx, userID)
+		if err != nil {
+			e.logger.Error("Failed to get cached permissions", zap.Int("user_id", userID), zap.Error(err))
+		} else if ok {
+			return NewSet(perms...), nil
+		}
+	}
+
+	roles, err := e.roles.GetUserRoles(ctx, int32(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !role.DeletedAt.Valid {
+			names = append(names, role.RoleName)
+		}
+	}
+	set := e.mapping.Resolve(names...)
+
+	if e.caching() {
+		if err := e.cache.Set(ctx, userID, set.List(), e.ttl); err != nil {
+			e.logger.Error("Failed to cache permissions", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}
+
+	return set, nil
+}
+
+// Can reports whether the user has the permission on every resource of its kind.
+func (e *Evaluator) Can(ctx context.Context, userID int, p Permission) (bool, error) {
+	set, err := e.Permissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return set.Has(p), nil
+}
+
+// CanAccess reports whether the user has the permission on a resource owned by
+// ownerID, e.g. cards.user_id of the card being read. It is granted by p itself
+// or, when ownerID is the user, by p.Own().
+func (e *Evaluator) CanAccess(ctx context.Context, userID int, p Permission, ownerID int) (bool, error) {
+	set, err := e.Permissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return set.Has(p) || (ownerID == userID && set.Has(p.Own())), nil
+}
+
+// Require is like Can but returns ErrForbidden when the permission is missing.
+func (e *Evaluator) Require(ctx context.Context, userID int, p Permission) error {
+	ok, err := e.Can(ctx, userID, p)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrForbidden, p)
+	}
+	return nil
+}
+
+// RequireAccess is like CanAccess but returns ErrForbidden when access is denied.
+func (e *Evaluator) RequireAccess(ctx context.Context, userID int, p Permission, ownerID int) error {
+	ok, err := e.CanAccess(ctx, userID, p, ownerID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrForbidden, p)
+	}
+	return nil
+}
+
+// Invalidate drops the cached permissions of the user so the next check loads
+// the current roles.
+func (e *Evaluator) Invalidate(ctx context.Context, userID int) error {
+	if e.cache == nil {
+		return nil
+	}
+	if err := e.cache.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to invalidate permissions: %w", err)
+	}
+	return nil
+}
+
+func (e *Evaluator) caching() bool {
+	return e.cache != nil && e.ttl > 0
+}
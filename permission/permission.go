@@ -0,0 +1,137 @@
+package permission
+
+import (
+	"slices"
+	"strings"
+)
+
+// Permission names an action on a kind of resource, written as
+// "resource:action", for example "merchant:write". A permission with the ":own"
+// suffix, see Own, only grants the action on resources owned by the user.
+type Permission string
+
+// Wildcard grants every permission. "resource:*" grants every action on one resource.
+const Wildcard Permission = "*"
+
+const ownSuffix = ":own"
+
+// Permissions checked by the payment gateway services.
+const (
+	UserRead        Permission = "user:read"
+	UserWrite       Permission = "user:write"
+	RoleRead        Permission = "role:read"
+	RoleWrite       Permission = "role:write"
+	CardRead        Permission = "card:read"
+	CardWrite       Permission = "card:write"
+	SaldoRead       Permission = "saldo:read"
+	SaldoWrite      Permission = "saldo:write"
+	MerchantRead    Permission = "merchant:read"
+	MerchantWrite   Permission = "merchant:write"
+	TopupRead       Permission = "topup:read"
+	TopupCreate     Permission = "topup:create"
+	TopupApprove    Permission = "topup:approve"
+	TransferRead    Permission = "transfer:read"
+	TransferWrite   Permission = "transfer:write"
+	WithdrawRead    Permission = "withdraw:read"
+	WithdrawWrite   Permission = "withdraw:write"
+	TransactionRead Permission = "transaction:read"
+)
+
+// Own returns the permission restricted to resources owned by the user, e.g.
+// "card:read:own" for CardRead.
+func (p Permission) Own() Permission {
+	if p.IsOwn() {
+		return p
+	}
+	return p + ownSuffix
+}
+
+// IsOwn reports whether the permission is restricted to owned resources.
+func (p Permission) IsOwn() bool {
+	return strings.HasSuffix(string(p), ownSuffix)
+}
+
+// Resource returns the resource part of the permission, e.g. "card" for CardRead.
+func (p Permission) Resource() string {
+	resource, _, _ := strings.Cut(string(p), ":")
+	return resource
+}
+
+// Set is a set of permissions, as resolved for a user by an Evaluator.
+type Set map[Permission]struct{}
+
+// NewSet returns a Set holding the given permissions.
+func NewSet(perms ...Permission) Set {
+	s := make(Set, len(perms))
+	for _, p := range perms {
+		s[p] = struct{}{}
+	}
+	return s
+}
+
+// Has reports whether the set grants p, either directly, through
+// "resource:*" or through Wildcard. A ":own" variant is also granted by anything
+// granting the unrestricted permission, including "resource:*"; the reverse
+// never holds.
+func (s Set) Has(p Permission) bool {
+	if _, ok := s[p]; ok {
+		return true
+	}
+	if _, ok := s[Wildcard]; ok {
+		return true
+	}
+	if p.IsOwn() {
+		return s.Has(Permission(strings.TrimSuffix(string(p), ownSuffix)))
+	}
+	_, ok := s[Permission(p.Resource()+":*")]
+	return ok
+}
+
+// List returns the permissions of the set in sorted order.
+func (s Set) List() []Permission {
+	perms := make([]Permission, 0, len(s))
+	for p := range s {
+		perms = append(perms, p)
+	}
+	slices.Sort(perms)
+	return perms
+}
+
+// Mapping maps role names, as stored in roles.role_name, to the permissions
+// granted by the role.
+type Mapping map[string][]Permission
+
+// DefaultMapping returns the mapping for the roles used across the payment gateway.
+func DefaultMapping() Mapping {
+	return Mapping{
+		"ROLE_SUPERADMIN": {Wildcard},
+		"ROLE_ADMIN": {
+			UserRead, UserWrite, RoleRead,
+			CardRead, CardWrite, SaldoRead, SaldoWrite,
+			MerchantRead, MerchantWrite,
+			TopupRead, TopupApprove, TransferRead, WithdrawRead, TransactionRead,
+		},
+		"ROLE_MERCHANT": {
+			MerchantRead.Own(), MerchantWrite.Own(), TransactionRead.Own(),
+		},
+		"ROLE_USER": {
+			UserRead.Own(), UserWrite.Own(),
+			CardRead.Own(), CardWrite.Own(), SaldoRead.Own(),
+			TopupRead.Own(), TopupCreate,
+			TransferRead.Own(), TransferWrite,
+			WithdrawRead.Own(), WithdrawWrite,
+			TransactionRead.Own(),
+		},
+	}
+}
+
+// Resolve returns the permissions granted by the given roles. Unknown roles grant nothing.
+func (m Mapping) Resolve(roles ...string) Set {
+	s := make(Set)
+	for _, role := range roles {
+		for _, p := range m[role] {
+			s[p] = struct{}{}
+		}
+	}
+	return s
+}
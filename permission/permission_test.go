@@ -0,0 +1,194 @@
+package permission
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeRoles returns fixed roles per user and counts the lookups.
+type fakeRoles struct {
+	roles map[int32][]*db.Role
+	calls int
+	err   error
+}
+
+func (f *fakeRoles) GetUserRoles(ctx context.Context, userID int32) ([]*db.Role, error) {
+	f.calls++
+	return f.roles[userID], f.err
+}
+
+func role(name string) *db.Role {
+	return &db.Role{RoleName: name}
+}
+
+func newTestEvaluator(opts ...Option) (*Evaluator, *fakeRoles) {
+	roles := &fakeRoles{roles: map[int32][]*db.Role{
+		1: {role("ROLE_ADMIN")},
+		2: {role("ROLE_USER")},
+		3: {role("ROLE_SUPERADMIN")},
+		4: {role("ROLE_USER"), {RoleName: "ROLE_ADMIN", DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}}},
+	}}
+	return NewEvaluator(roles, DefaultMapping(), &logger.Logger{Log: zap.NewNop()}, opts...), roles
+}
+
+func TestSet_Has(t *testing.T) {
+	s := NewSet(CardRead.Own(), "topup:*")
+
+	assert.True(t, s.Has(CardRead.Own()))
+	assert.False(t, s.Has(CardRead))
+	assert.True(t, s.Has(TopupApprove))
+	assert.True(t, s.Has(TopupRead.Own()))
+	assert.False(t, s.Has(MerchantRead))
+
+	assert.True(t, NewSet(CardRead).Has(CardRead.Own()))
+	assert.True(t, NewSet(Wildcard).Has(MerchantWrite))
+	assert.Equal(t, CardRead.Own(), CardRead.Own().Own())
+	assert.Equal(t, "card", CardRead.Own().Resource())
+}
+
+func TestSet_HasOwnVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		set  Set
+		perm Permission
+		want bool
+	}{
+		{"exact own", NewSet(CardRead.Own()), CardRead.Own(), true},
+		{"unrestricted grants own", NewSet(CardRead), CardRead.Own(), true},
+		{"resource wildcard grants own", NewSet("card:*"), CardWrite.Own(), true},
+		{"wildcard grants own", NewSet(Wildcard), CardWrite.Own(), true},
+		{"own does not grant unrestricted", NewSet(CardRead.Own()), CardRead, false},
+		{"own does not grant other actions", NewSet(CardRead.Own()), CardWrite.Own(), false},
+		{"resource wildcard is per resource", NewSet("card:*"), SaldoRead.Own(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.set.Has(tt.perm))
+		})
+	}
+}
+
+func TestEvaluator_Can(t *testing.T) {
+	ev, _ := newTestEvaluator()
+	ctx := context.Background()
+
+	ok, err := ev.Can(ctx, 1, TopupApprove)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = ev.Can(ctx, 2, TopupApprove)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = ev.Can(ctx, 3, RoleWrite)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The trashed admin role grants nothing.
+	assert.ErrorIs(t, ev.Require(ctx, 4, MerchantWrite), ErrForbidden)
+	assert.NoError(t, ev.Require(ctx, 4, TopupCreate))
+}
+
+func TestEvaluator_CanAccess(t *testing.T) {
+	ev, _ := newTestEvaluator()
+	ctx := context.Background()
+
+	// A user may only read their own cards, an admin reads every card.
+	assert.NoError(t, ev.RequireAccess(ctx, 2, CardRead, 2))
+	assert.ErrorIs(t, ev.RequireAccess(ctx, 2, CardRead, 7), ErrForbidden)
+	assert.NoError(t, ev.RequireAccess(ctx, 1, CardRead, 7))
+
+	// Without any variant of the permission, ownership does not help.
+	ok, err := ev.CanAccess(ctx, 2, MerchantWrite, 2)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestEvaluator_Cache(t *testing.T) {
+	ev, roles := newTestEvaluator()
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := ev.Can(ctx, 2, CardRead)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, roles.calls)
+
+	// Promote the user; the cached permissions stay until invalidated.
+	roles.roles[2] = []*db.Role{role("ROLE_ADMIN")}
+	ok, _ := ev.Can(ctx, 2, CardRead)
+	assert.False(t, ok)
+
+	require.NoError(t, ev.Invalidate(ctx, 2))
+	ok, _ = ev.Can(ctx, 2, CardRead)
+	assert.True(t, ok)
+	assert.Equal(t, 2, roles.calls)
+}
+
+func TestEvaluator_CacheExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewInMemoryCache()
+	cache.now = func() time.Time { return now }
+
+	ev, roles := newTestEvaluator(WithCache(cache, time.Minute))
+	ctx := context.Background()
+
+	_, err := ev.Permissions(ctx, 1)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = ev.Permissions(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, roles.calls)
+}
+
+func TestEvaluator_RoleLookupError(t *testing.T) {
+	ev, roles := newTestEvaluator()
+	roles.err = errors.New("connection refused")
+
+	_, err := ev.Can(context.Background(), 1, CardRead)
+	assert.ErrorIs(t, err, roles.err)
+}
+
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	_, ok, err := cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, 1, []Permission{CardRead, TopupApprove}, time.Minute))
+	require.NoError(t, cache.Set(ctx, 2, []Permission{}, time.Minute))
+
+	perms, ok, err := cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Permission{CardRead, TopupApprove}, perms)
+
+	perms, ok, err = cache.Get(ctx, 2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, perms)
+
+	mr.FastForward(2 * time.Minute)
+	_, ok, _ = cache.Get(ctx, 1)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, 1, []Permission{CardRead}, time.Minute))
+	require.NoError(t, cache.Delete(ctx, 1))
+	_, ok, _ = cache.Get(ctx, 1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,61 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InMemoryNonceStore is a NonceStore kept in process memory. It is meant for tests
+// and single instance deployments.
+type InMemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewInMemoryNonceStore creates an empty InMemoryNonceStore.
+func NewInMemoryNonceStore() *InMemoryNonceStore {
+	return &InMemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Claim records the nonce for ttl and reports whether it was not seen before.
+func (s *InMemoryNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, n)
+		}
+	}
+
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+
+	return true, nil
+}
+
+// RedisNonceStore is a NonceStore backed by Redis, shared by every gateway instance.
+type RedisNonceStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisNonceStore creates a RedisNonceStore. The client is usually the Client
+// of a redisclient connection.
+func NewRedisNonceStore(client redis.UniversalClient) *RedisNonceStore {
+	return &RedisNonceStore{
+		client: client,
+		prefix: "signature:nonce:",
+	}
+}
+
+// Claim records the nonce for ttl and reports whether it was not seen before.
+func (s *RedisNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+}
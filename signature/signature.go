@@ -0,0 +1,218 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+)
+
+const (
+	// HeaderKeyID carries the public prefix of the merchant API key.
+	HeaderKeyID = "X-Key-Id"
+	// HeaderTimestamp carries the signing time in Unix seconds.
+	HeaderTimestamp = "X-Timestamp"
+	// HeaderNonce carries a random value that may be used only once.
+	HeaderNonce = "X-Nonce"
+	// HeaderSignature carries the hex encoded HMAC-SHA256 of the canonical request.
+	HeaderSignature = "X-Signature"
+
+	// DefaultWindow is how far the signing time may differ from the verifier clock.
+	DefaultWindow = 5 * time.Minute
+
+	// DefaultMaxBodySize is the largest body a verifier reads, see WithMaxBodySize.
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	// ErrMissingSignature is returned when a request lacks one of the signature headers.
+	ErrMissingSignature = errors.New("missing request signature")
+
+	// ErrInvalidSignature is returned when the signature does not match the request.
+	ErrInvalidSignature = errors.New("invalid request signature")
+
+	// ErrExpiredSignature is returned when the signing time is outside the replay window.
+	ErrExpiredSignature = errors.New("request signature outside replay window")
+
+	// ErrReplayedNonce is returned when the nonce of a request has been seen before.
+	ErrReplayedNonce = errors.New("request nonce already used")
+
+	// ErrBodyTooLarge is returned when the body of a request exceeds the limit
+	// of the verifier.
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// KeyFromApiKey returns the key ID and the signing key for a full merchant API
+// key. The gateway finds the same signing key by the key ID with
+// apikey.Service.SigningKey.
+func KeyFromApiKey(raw string) (string, []byte, error) {
+	key, err := apikey.ParseKey(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	return key.Prefix, key.SigningKey(), nil
+}
+
+// CanonicalRequest returns the string that is signed for a request:
+//
+//	METHOD \n PATH \n QUERY \n TIMESTAMP \n NONCE \n hex(sha256(body))
+//
+// The query is re-encoded with its keys sorted so that parameter order does not
+// affect the signature.
+func CanonicalRequest(r *http.Request, body []byte, timestamp, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		strings.ToUpper(r.Method),
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the canonical request.
+func Sign(key []byte, canonical string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verifier checks signed requests on the gateway side.
+type Verifier struct {
+	nonces      NonceStore
+	window      time.Duration
+	maxBodySize int64
+	now         func() time.Time
+}
+
+// VerifierOption configures a Verifier.
+type VerifierOption func(*Verifier)
+
+// WithMaxBodySize sets the largest body the verifier reads. The body has to be
+// read before the signature can be checked, so the limit keeps unauthenticated
+// clients from making the gateway buffer arbitrarily large bodies.
+func WithMaxBodySize(size int64) VerifierOption {
+	return func(v *Verifier) {
+		if size > 0 {
+			v.maxBodySize = size
+		}
+	}
+}
+
+// NewVerifier creates a Verifier that accepts requests signed within window of
+// the current time and claims their nonces in the given store. A zero window
+// means DefaultWindow; bodies are limited to DefaultMaxBodySize unless
+// WithMaxBodySize is given.
+func NewVerifier(nonces NonceStore, window time.Duration, opts ...VerifierOption) *Verifier {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	v := &Verifier{
+		nonces:      nonces,
+		window:      window,
+		maxBodySize: DefaultMaxBodySize,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// KeyID returns the key ID of a signed request, or ErrMissingSignature.
+func KeyID(r *http.Request) (string, error) {
+	keyID := r.Header.Get(HeaderKeyID)
+	if keyID == "" {
+		return "", ErrMissingSignature
+	}
+	return keyID, nil
+}
+
+// Verify checks the signature of the request with the given key. The body is
+// read and replaced so handlers can still consume it; bodies over the limit of
+// the verifier return ErrBodyTooLarge.
+//
+// The nonce is only claimed once the signature is valid, so unsigned traffic
+// cannot fill the nonce store.
+func (v *Verifier) Verify(r *http.Request, key []byte) error {
+	keyID := r.Header.Get(HeaderKeyID)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	skew := v.now().Sub(time.Unix(unix, 0))
+	if skew > v.window || skew < -v.window {
+		return ErrExpiredSignature
+	}
+
+	body, err := readBody(r, v.maxBodySize)
+	if err != nil {
+		return err
+	}
+
+	expected := Sign(key, CanonicalRequest(r, body, timestamp, nonce))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrInvalidSignature
+	}
+
+	// A nonce must outlive every timestamp that is still accepted with it.
+	fresh, err := v.nonces.Claim(r.Context(), keyID+":"+nonce, 2*v.window)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrReplayedNonce
+	}
+
+	return nil
+}
+
+// readBody reads and replaces the body of r. A limit of zero reads it whole.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	reader := r.Body
+	if limit > 0 {
+		reader = http.MaxBytesReader(nil, r.Body, limit)
+	}
+
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// NonceStore remembers the nonces of verified requests.
+type NonceStore interface {
+	// Claim records the nonce for ttl and reports whether it was not seen before.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
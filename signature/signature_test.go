@@ -0,0 +1,132 @@
+package signature
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apikey "github.com/MamangRust/monolith-payment-gateway-pkg/api-key"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTransport captures the signed request instead of sending it.
+type recordingTransport struct {
+	req  *http.Request
+	body string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	t.req = req.Clone(req.Context())
+	t.body = string(body)
+	t.req.Body = io.NopCloser(strings.NewReader(t.body))
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func signRequest(t *testing.T, key *apikey.Key, method, target, body string) *http.Request {
+	t.Helper()
+
+	transport := &recordingTransport{}
+	signer, err := NewSigner(key.String(), transport)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: signer}
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	require.NoError(t, err)
+
+	_, err = client.Do(req)
+	require.NoError(t, err)
+
+	// Rebuild the request as the server sees it.
+	received := httptest.NewRequest(method, transport.req.URL.RequestURI(), strings.NewReader(transport.body))
+	received.Header = transport.req.Header
+	return received
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	signingKey := key.SigningKey()
+
+	verifier := NewVerifier(NewInMemoryNonceStore(), time.Minute)
+
+	req := signRequest(t, key, http.MethodPost, "http://gateway/api/topups?b=2&a=1", `{"amount":50000}`)
+	assert.Equal(t, key.Prefix, req.Header.Get(HeaderKeyID))
+
+	require.NoError(t, verifier.Verify(req, signingKey))
+	assert.ErrorIs(t, verifier.Verify(req, signingKey), ErrReplayedNonce)
+
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, `{"amount":50000}`, string(body), "the body must still be readable")
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	key, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	signingKey := key.SigningKey()
+
+	verifier := NewVerifier(NewInMemoryNonceStore(), time.Minute)
+
+	tampered := signRequest(t, key, http.MethodPost, "http://gateway/api/topups", `{"amount":50000}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"amount":9950000}`))
+	assert.ErrorIs(t, verifier.Verify(tampered, signingKey), ErrInvalidSignature)
+
+	otherPath := signRequest(t, key, http.MethodGet, "http://gateway/api/topups", "")
+	otherPath.URL.Path = "/api/withdraws"
+	assert.ErrorIs(t, verifier.Verify(otherPath, signingKey), ErrInvalidSignature)
+
+	other, _ := apikey.GenerateKey()
+	wrongKey := signRequest(t, other, http.MethodGet, "http://gateway/api/topups", "")
+	assert.ErrorIs(t, verifier.Verify(wrongKey, signingKey), ErrInvalidSignature)
+
+	unsigned := httptest.NewRequest(http.MethodGet, "/api/topups", nil)
+	assert.ErrorIs(t, verifier.Verify(unsigned, signingKey), ErrMissingSignature)
+
+	expired := signRequest(t, key, http.MethodGet, "http://gateway/api/topups", "")
+	verifier.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.ErrorIs(t, verifier.Verify(expired, signingKey), ErrExpiredSignature)
+}
+
+func TestVerifyRejectsOversizedBody(t *testing.T) {
+	key, err := apikey.GenerateKey()
+	require.NoError(t, err)
+	signingKey := key.SigningKey()
+
+	verifier := NewVerifier(NewInMemoryNonceStore(), time.Minute, WithMaxBodySize(16))
+
+	exact := signRequest(t, key, http.MethodPost, "http://gateway/api/topups", `{"amount":50000}`)
+	require.NoError(t, verifier.Verify(exact, signingKey))
+
+	oversized := signRequest(t, key, http.MethodPost, "http://gateway/api/topups", `{"amount":500000}`)
+	assert.ErrorIs(t, verifier.Verify(oversized, signingKey), ErrBodyTooLarge)
+}
+
+func TestRedisNonceStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	store := NewRedisNonceStore(client)
+	ctx := context.Background()
+
+	fresh, err := store.Claim(ctx, "mk_00112233:nonce", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = store.Claim(ctx, "mk_00112233:nonce", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	mr.FastForward(2 * time.Minute)
+
+	fresh, err = store.Claim(ctx, "mk_00112233:nonce", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+}
@@ -0,0 +1,75 @@
+package signature
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signer is an http.RoundTripper that signs every outgoing request with a
+// merchant API key before passing it to the base transport.
+type Signer struct {
+	keyID string
+	key   []byte
+	base  http.RoundTripper
+	now   func() time.Time
+}
+
+// NewSigner creates a Signer for the given full merchant API key. A nil base
+// means http.DefaultTransport.
+//
+// Example:
+//
+//	signer, err := signature.NewSigner(apiKey, nil)
+//	client := &http.Client{Transport: signer}
+func NewSigner(apiKey string, base http.RoundTripper) (*Signer, error) {
+	keyID, key, err := KeyFromApiKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Signer{
+		keyID: keyID,
+		key:   key,
+		base:  base,
+		now:   time.Now,
+	}, nil
+}
+
+// RoundTrip signs a clone of the request and sends it with the base transport.
+func (s *Signer) RoundTrip(req *http.Request) (*http.Response, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	signed := req.Clone(req.Context())
+	// Outgoing bodies are the merchant's own, so they are not limited.
+	body, err := readBody(signed, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	signed.Header.Set(HeaderKeyID, s.keyID)
+	signed.Header.Set(HeaderTimestamp, timestamp)
+	signed.Header.Set(HeaderNonce, nonce)
+	signed.Header.Set(HeaderSignature, Sign(s.key, CanonicalRequest(signed, body, timestamp, nonce)))
+
+	return s.base.RoundTrip(signed)
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,42 @@
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// EventType identifies what happened to a login attempt.
+type EventType string
+
+const (
+	// EventLoginFailed is emitted for every failed login, once per key.
+	EventLoginFailed EventType = "login_failed"
+	// EventLoginBlocked is emitted when Check rejects an attempt.
+	EventLoginBlocked EventType = "login_blocked"
+	// EventLockedOut is emitted when a key reaches MaxFailures.
+	EventLockedOut EventType = "locked_out"
+	// EventUnlocked is emitted when Unlock lifts a lockout.
+	EventUnlocked EventType = "unlocked"
+)
+
+// KeyKind tells whether an event concerns the email address or the client IP.
+type KeyKind string
+
+const (
+	KeyEmail KeyKind = "email"
+	KeyIP    KeyKind = "ip"
+)
+
+// Event describes a throttling decision, ready to be written to an audit log.
+type Event struct {
+	Type       EventType     `json:"type"`
+	Email      string        `json:"email,omitempty"`
+	IP         string        `json:"ip,omitempty"`
+	Key        KeyKind       `json:"key,omitempty"`
+	Failures   int           `json:"failures,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+	Time       time.Time     `json:"time"`
+}
+
+// EventHandler receives throttling events.
+type EventHandler func(ctx context.Context, event Event)
@@ -0,0 +1,176 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps failure counters and blocks per key.
+type Store interface {
+	// Fail increments the failure counter of the key and returns the new count.
+	// The counter expires window after the first failure.
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Block blocks the key until the given time. locked tells a lockout from a backoff delay.
+	Block(ctx context.Context, key string, until time.Time, locked bool) error
+	// BlockedUntil returns the end of the current block of the key, or the zero time.
+	BlockedUntil(ctx context.Context, key string) (time.Time, bool, error)
+	// Reset clears the failure counter and the block of the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// InMemoryStore is a Store kept in process memory. It is meant for tests and
+// single instance deployments.
+type InMemoryStore struct {
+	mu       sync.Mutex
+	failures map[string]counter
+	blocks   map[string]block
+	now      func() time.Time
+}
+
+type counter struct {
+	count     int
+	expiresAt time.Time
+}
+
+type block struct {
+	until  time.Time
+	locked bool
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		failures: make(map[string]counter),
+		blocks:   make(map[string]block),
+		now:      time.Now,
+	}
+}
+
+// Fail increments the failure counter of the key and returns the new count.
+func (s *InMemoryStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	c := s.failures[key]
+	if !c.expiresAt.After(now) {
+		c = counter{expiresAt: now.Add(window)}
+	}
+	c.count++
+	s.failures[key] = c
+
+	return c.count, nil
+}
+
+// Block blocks the key until the given time.
+func (s *InMemoryStore) Block(ctx context.Context, key string, until time.Time, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocks[key] = block{until: until, locked: locked}
+	return nil
+}
+
+// BlockedUntil returns the end of the current block of the key, or the zero time.
+func (s *InMemoryStore) BlockedUntil(ctx context.Context, key string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.blocks[key]
+	if !ok || !b.until.After(s.now()) {
+		delete(s.blocks, key)
+		return time.Time{}, false, nil
+	}
+	return b.until, b.locked, nil
+}
+
+// Reset clears the failure counter and the block of the key.
+func (s *InMemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.blocks, key)
+	return nil
+}
+
+// RedisStore is a Store backed by Redis, shared by every instance handling logins.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore. The client is usually the Client of a
+// redisclient connection.
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: "throttle:login:",
+	}
+}
+
+// Fail increments the failure counter of the key and returns the new count.
+//
+// The counter is created with its expiry and incremented in one MULTI
+// transaction, so it can never be left without a TTL.
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	k := s.prefix + "failures:" + key
+
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, k, 0, window)
+		incr = pipe.Incr(ctx, k)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(incr.Val()), nil
+}
+
+// Block blocks the key until the given time. The value holds the end of the
+// block in Unix nanoseconds, prefixed with "L" for lockouts.
+func (s *RedisStore) Block(ctx context.Context, key string, until time.Time, locked bool) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+
+	value := strconv.FormatInt(until.UnixNano(), 10)
+	if locked {
+		value = "L" + value
+	}
+
+	return s.client.Set(ctx, s.prefix+"block:"+key, value, ttl).Err()
+}
+
+// BlockedUntil returns the end of the current block of the key, or the zero time.
+func (s *RedisStore) BlockedUntil(ctx context.Context, key string) (time.Time, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+"block:"+key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+
+	locked := strings.HasPrefix(value, "L")
+	nanos, err := strconv.ParseInt(strings.TrimPrefix(value, "L"), 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return time.Unix(0, nanos), locked, nil
+}
+
+// Reset clears the failure counter and the block of the key.
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+"failures:"+key, s.prefix+"block:"+key).Err()
+}
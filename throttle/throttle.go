@@ -0,0 +1,257 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrThrottled is matched by every *ThrottledError, so callers can use
+// errors.Is(err, ErrThrottled) before extracting the retry time.
+var ErrThrottled = errors.New("too many failed login attempts")
+
+// ThrottledError is returned by Check while a login is blocked.
+type ThrottledError struct {
+	// RetryAfter is how long the client has to wait before trying again.
+	RetryAfter time.Duration
+	// Locked is true when the block is a lockout after too many failures rather
+	// than the backoff delay after a single failure.
+	Locked bool
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrThrottled, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrThrottled.
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+// Limits describes how failed attempts of one key are throttled.
+type Limits struct {
+	// MaxFailures is the number of failures within Window that locks the key
+	// for Lockout. Zero disables the lockout.
+	MaxFailures int
+	// Window is how long failures are counted after the first one.
+	Window time.Duration
+	// BaseDelay is the wait after the first failure. It doubles on every
+	// following failure up to MaxDelay. Zero disables the backoff.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Lockout is how long the key is blocked once MaxFailures is reached.
+	Lockout time.Duration
+}
+
+// Config holds the limits per email address and per client IP. The IP limits are
+// usually looser, since many users may share an address.
+type Config struct {
+	Email Limits
+	IP    Limits
+}
+
+// DefaultConfig locks an email address for 15 minutes after 5 failures and an IP
+// address after 50, with a backoff from 1 second up to 30 seconds in between.
+func DefaultConfig() Config {
+	return Config{
+		Email: Limits{
+			MaxFailures: 5,
+			Window:      15 * time.Minute,
+			BaseDelay:   time.Second,
+			MaxDelay:    30 * time.Second,
+			Lockout:     15 * time.Minute,
+		},
+		IP: Limits{
+			MaxFailures: 50,
+			Window:      15 * time.Minute,
+			Lockout:     15 * time.Minute,
+		},
+	}
+}
+
+// Option configures a Throttler.
+type Option func(*Throttler)
+
+// WithEventHandler registers a handler called for every Event, for example to
+// write the audit log. Handlers run synchronously and should not block.
+func WithEventHandler(handler EventHandler) Option {
+	return func(t *Throttler) {
+		t.handlers = append(t.handlers, handler)
+	}
+}
+
+// Throttler limits repeated failed logins per email address and per client IP.
+//
+// Check must be called before the password is compared, and Failure or Success
+// after. Every failure blocks further attempts for an exponentially growing
+// delay, and MaxFailures failures lock the key for Lockout.
+type Throttler struct {
+	store    Store
+	cfg      Config
+	handlers []EventHandler
+	now      func() time.Time
+}
+
+// New creates a Throttler that keeps its state in the given store.
+func New(store Store, cfg Config, opts ...Option) *Throttler {
+	t := &Throttler{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Check returns a *ThrottledError when the email address or the IP is currently
+// blocked. An empty email or IP is not checked.
+func (t *Throttler) Check(ctx context.Context, email, ip string) error {
+	now := t.now()
+
+	var blocked *ThrottledError
+	for _, key := range t.keys(email, ip) {
+		until, locked, err := t.store.BlockedUntil(ctx, key.name)
+		if err != nil {
+			return fmt.Errorf("failed to check login throttle: %w", err)
+		}
+
+		if retry := until.Sub(now); retry > 0 && (blocked == nil || retry > blocked.RetryAfter) {
+			blocked = &ThrottledError{RetryAfter: retry, Locked: locked}
+		}
+	}
+
+	if blocked != nil {
+		t.emit(ctx, Event{
+			Type:       EventLoginBlocked,
+			Email:      email,
+			IP:         ip,
+			RetryAfter: blocked.RetryAfter,
+			Time:       now,
+		})
+		return blocked
+	}
+
+	return nil
+}
+
+// Failure records a failed login and blocks the email address and IP for the
+// backoff delay, or locks them when they reached MaxFailures.
+func (t *Throttler) Failure(ctx context.Context, email, ip string) error {
+	now := t.now()
+
+	for _, key := range t.keys(email, ip) {
+		failures, err := t.store.Fail(ctx, key.name, key.limits.Window)
+		if err != nil {
+			return fmt.Errorf("failed to record login failure: %w", err)
+		}
+
+		event := Event{
+			Type:     EventLoginFailed,
+			Email:    email,
+			IP:       ip,
+			Key:      key.kind,
+			Failures: failures,
+			Time:     now,
+		}
+
+		locked := key.limits.MaxFailures > 0 && failures >= key.limits.MaxFailures
+		delay := key.limits.Lockout
+		if !locked {
+			delay = backoff(key.limits, failures)
+		}
+
+		if delay > 0 {
+			if err := t.store.Block(ctx, key.name, now.Add(delay), locked); err != nil {
+				return fmt.Errorf("failed to block login: %w", err)
+			}
+			event.RetryAfter = delay
+		}
+
+		t.emit(ctx, event)
+
+		if locked {
+			event.Type = EventLockedOut
+			t.emit(ctx, event)
+		}
+	}
+
+	return nil
+}
+
+// Success resets the failures of the email address after a successful login.
+// The IP is not reset, so one valid account cannot be used to keep guessing the
+// passwords of others from the same address.
+func (t *Throttler) Success(ctx context.Context, email, ip string) error {
+	if email == "" {
+		return nil
+	}
+	if err := t.store.Reset(ctx, emailKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+	return nil
+}
+
+// Unlock lifts the lockout of an email address, for example by an administrator.
+func (t *Throttler) Unlock(ctx context.Context, email string) error {
+	if err := t.store.Reset(ctx, emailKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+
+	t.emit(ctx, Event{
+		Type:  EventUnlocked,
+		Email: email,
+		Key:   KeyEmail,
+		Time:  t.now(),
+	})
+	return nil
+}
+
+// backoff returns BaseDelay doubled for every failure after the first, capped at MaxDelay.
+func backoff(limits Limits, failures int) time.Duration {
+	if limits.BaseDelay <= 0 || failures <= 0 {
+		return 0
+	}
+
+	delay := limits.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if limits.MaxDelay > 0 && delay >= limits.MaxDelay {
+			return limits.MaxDelay
+		}
+	}
+	if limits.MaxDelay > 0 && delay > limits.MaxDelay {
+		return limits.MaxDelay
+	}
+	return delay
+}
+
+type throttleKey struct {
+	name   string
+	kind   KeyKind
+	limits Limits
+}
+
+func (t *Throttler) keys(email, ip string) []throttleKey {
+	keys := make([]throttleKey, 0, 2)
+	if email != "" {
+		keys = append(keys, throttleKey{name: emailKey(email), kind: KeyEmail, limits: t.cfg.Email})
+	}
+	if ip != "" {
+		keys = append(keys, throttleKey{name: "ip:" + ip, kind: KeyIP, limits: t.cfg.IP})
+	}
+	return keys
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (t *Throttler) emit(ctx context.Context, event Event) {
+	for _, handler := range t.handlers {
+		handler(ctx, event)
+	}
+}
@@ -0,0 +1,213 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a settable time source shared by the throttler and the memory store.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestThrottler(cfg Config, opts ...Option) (*Throttler, *clock) {
+	c := &clock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	store := NewInMemoryStore()
+	store.now = c.now
+
+	th := New(store, cfg, opts...)
+	th.now = c.now
+	return th, c
+}
+
+func TestBackoff(t *testing.T) {
+	limits := Limits{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	assert.Equal(t, time.Duration(0), backoff(limits, 0))
+	assert.Equal(t, time.Second, backoff(limits, 1))
+	assert.Equal(t, 2*time.Second, backoff(limits, 2))
+	assert.Equal(t, 8*time.Second, backoff(limits, 4))
+	assert.Equal(t, 10*time.Second, backoff(limits, 5))
+	assert.Equal(t, 10*time.Second, backoff(limits, 64))
+	assert.Equal(t, time.Duration(0), backoff(Limits{}, 3))
+}
+
+func TestThrottler_BackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	th, c := newTestThrottler(DefaultConfig())
+
+	require.NoError(t, th.Check(ctx, "user@example.com", "10.0.0.1"))
+	require.NoError(t, th.Failure(ctx, "user@example.com", "10.0.0.1"))
+
+	err := th.Check(ctx, "user@example.com", "10.0.0.1")
+	var throttled *ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.False(t, throttled.Locked)
+	assert.Equal(t, time.Second, throttled.RetryAfter)
+
+	c.t = c.t.Add(time.Second)
+	require.NoError(t, th.Check(ctx, "USER@example.com ", "10.0.0.1"))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, th.Failure(ctx, "user@example.com", "10.0.0.1"))
+	}
+
+	err = th.Check(ctx, "user@example.com", "")
+	require.ErrorAs(t, err, &throttled)
+	assert.True(t, throttled.Locked)
+	assert.Equal(t, 15*time.Minute, throttled.RetryAfter)
+
+	// The IP only saw a short backoff and another account is not affected.
+	c.t = c.t.Add(time.Minute)
+	require.NoError(t, th.Check(ctx, "other@example.com", "10.0.0.1"))
+
+	c.t = c.t.Add(15 * time.Minute)
+	require.NoError(t, th.Check(ctx, "user@example.com", "10.0.0.1"))
+}
+
+func TestThrottler_IPLockout(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.IP.MaxFailures = 3
+	th, _ := newTestThrottler(cfg)
+
+	th.Failure(ctx, "a@example.com", "10.0.0.1")
+	th.Failure(ctx, "b@example.com", "10.0.0.1")
+	th.Failure(ctx, "c@example.com", "10.0.0.1")
+
+	var throttled *ThrottledError
+	require.ErrorAs(t, th.Check(ctx, "d@example.com", "10.0.0.1"), &throttled)
+	assert.True(t, throttled.Locked)
+
+	require.NoError(t, th.Check(ctx, "d@example.com", "10.0.0.2"))
+}
+
+func TestThrottler_SuccessResetsEmailOnly(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.IP.MaxFailures = 2
+	th, c := newTestThrottler(cfg)
+
+	require.NoError(t, th.Failure(ctx, "user@example.com", "10.0.0.1"))
+	require.NoError(t, th.Success(ctx, "user@example.com", "10.0.0.1"))
+	require.NoError(t, th.Check(ctx, "user@example.com", ""))
+
+	c.t = c.t.Add(time.Minute)
+	require.NoError(t, th.Failure(ctx, "other@example.com", "10.0.0.1"))
+	assert.ErrorIs(t, th.Check(ctx, "", "10.0.0.1"), ErrThrottled)
+}
+
+func TestThrottler_Events(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.Email.MaxFailures = 2
+
+	var events []Event
+	th, _ := newTestThrottler(cfg, WithEventHandler(func(ctx context.Context, e Event) {
+		events = append(events, e)
+	}))
+
+	require.NoError(t, th.Failure(ctx, "user@example.com", ""))
+	require.NoError(t, th.Failure(ctx, "user@example.com", ""))
+	require.Error(t, th.Check(ctx, "user@example.com", ""))
+	require.NoError(t, th.Unlock(ctx, "user@example.com"))
+	require.NoError(t, th.Check(ctx, "user@example.com", ""))
+
+	types := make([]EventType, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	assert.Equal(t, []EventType{
+		EventLoginFailed,
+		EventLoginFailed,
+		EventLockedOut,
+		EventLoginBlocked,
+		EventUnlocked,
+	}, types)
+
+	assert.Equal(t, KeyEmail, events[2].Key)
+	assert.Equal(t, 2, events[2].Failures)
+	assert.Equal(t, 15*time.Minute, events[2].RetryAfter)
+}
+
+func TestInMemoryStore_WindowExpires(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Now()}
+	store := NewInMemoryStore()
+	store.now = c.now
+
+	n, _ := store.Fail(ctx, "email:a", time.Minute)
+	assert.Equal(t, 1, n)
+	n, _ = store.Fail(ctx, "email:a", time.Minute)
+	assert.Equal(t, 2, n)
+
+	c.t = c.t.Add(time.Minute)
+	n, _ = store.Fail(ctx, "email:a", time.Minute)
+	assert.Equal(t, 1, n)
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	store := NewRedisStore(client)
+	ctx := context.Background()
+
+	n, err := store.Fail(ctx, "email:a", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = store.Fail(ctx, "email:a", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, time.Minute, mr.TTL("throttle:login:failures:email:a"), "later failures keep the window")
+
+	mr.FastForward(time.Minute)
+	n, err = store.Fail(ctx, "email:a", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	require.NoError(t, store.Block(ctx, "email:a", until, true))
+
+	got, locked, err := store.BlockedUntil(ctx, "email:a")
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.True(t, until.Equal(got))
+
+	require.NoError(t, store.Reset(ctx, "email:a"))
+	got, locked, err = store.BlockedUntil(ctx, "email:a")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.True(t, got.IsZero())
+	assert.False(t, mr.Exists("throttle:login:failures:email:a"))
+}
+
+func TestThrottler_RedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	th := New(NewRedisStore(client), DefaultConfig())
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, th.Failure(ctx, "user@example.com", "10.0.0.1"))
+	}
+
+	var throttled *ThrottledError
+	require.ErrorAs(t, th.Check(ctx, "user@example.com", ""), &throttled)
+	assert.True(t, throttled.Locked)
+
+	mr.FastForward(16 * time.Minute)
+	require.NoError(t, th.Check(ctx, "user@example.com", ""))
+}
@@ -0,0 +1,295 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/MamangRust/monolith-payment-gateway-pkg/auth"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/email"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/hash"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+)
+
+// Service issues and consumes email verification codes, kept in
+// users.verification_code, and password reset codes, kept in reset_tokens.
+//
+// Only SHA-256 hashes of the codes are stored. Verification codes expire after
+// VerificationTTL and are cleared when used; reset codes expire after ResetTTL,
+// are deleted after MaxAttempts wrong guesses and are consumed in the same
+// transaction that changes the password.
+type Service struct {
+	db          *sql.DB
+	queries     *db.Queries
+	hasher      hash.HashPassword
+	revocations auth.RevocationStore
+	sender      email.Sender
+	cfg         Config
+	logger      logger.LoggerInterface
+	now         func() time.Time
+}
+
+// NewService creates a new Service.
+//
+// Parameters:
+//   - conn: The database connection used to open transactions (*sql.DB)
+//   - queries: The generated queries bound to conn (*db.Queries)
+//   - hasher: The hasher used for new passwords (hash.HashPassword)
+//   - revocations: The store the access tokens of a user are revoked in on reset, or nil to skip it (auth.RevocationStore)
+//   - sender: The sender delivering the emails (email.Sender)
+//   - cfg: The code lengths, lifetimes and links (Config)
+//   - logger: The logger used to report unknown addresses (logger.LoggerInterface)
+//
+// Returns:
+//   - *Service: The initialized service
+func NewService(conn *sql.DB, queries *db.Queries, hasher hash.HashPassword, revocations auth.RevocationStore, sender email.Sender, cfg Config, logger logger.LoggerInterface) *Service {
+	return &Service{
+		db:          conn,
+		queries:     queries,
+		hasher:      hasher,
+		revocations: revocations,
+		sender:      sender,
+		cfg:         cfg,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// SendVerification replaces the verification code of the user and emails a
+// link to verify the address.
+func (s *Service) SendVerification(ctx context.Context, userID int) error {
+	user, err := s.queries.GetUserByID(ctx, int32(userID))
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.IsVerified.Valid && user.IsVerified.Bool {
+		return ErrAlreadyVerified
+	}
+
+	code, codeHash, err := GenerateCode(s.cfg.VerificationCodeLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	if err := s.queries.UpdateUserVerificationCode(ctx, db.UpdateUserVerificationCodeParams{
+		UserID:                user.UserID,
+		VerificationCode:      codeHash,
+		VerificationExpiresAt: sql.NullTime{Time: s.now().Add(s.cfg.VerificationTTL), Valid: true},
+	}); err != nil {
+		return fmt.Errorf("failed to store verification code: %w", err)
+	}
+
+	return s.send(ctx, user.Email, map[string]string{
+		"Title":   "Verify your email",
+		"Subject": "Verify your email address",
+		"Message": fmt.Sprintf("Hi %s, please confirm your email address to activate your account.", user.Firstname),
+		"Button":  "Verify Email",
+		"Link":    link(s.cfg.VerifyURL, url.Values{"code": {code}}),
+	})
+}
+
+// Verify marks the user owning the code as verified and clears the code.
+// Expired codes are rejected with ErrInvalidCode.
+func (s *Service) Verify(ctx context.Context, code string) (*db.User, error) {
+	if code == "" {
+		return nil, ErrInvalidCode
+	}
+
+	user, err := s.queries.VerifyUserByCode(ctx, db.VerifyUserByCodeParams{
+		VerificationCode:      HashCode(code),
+		VerificationExpiresAt: sql.NullTime{Time: s.now(), Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCode
+		}
+		return nil, fmt.Errorf("failed to verify user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SendPasswordReset replaces the reset code of the user with the given email
+// address and emails it. Nothing is sent to unknown addresses, so the response
+// does not reveal which addresses have an account.
+func (s *Service) SendPasswordReset(ctx context.Context, address string) error {
+	user, err := s.queries.GetUserByEmail(ctx, address)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Debug("Password reset requested for unknown email")
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	code, codeHash, err := GenerateCode(s.cfg.ResetCodeLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate reset code: %w", err)
+	}
+
+	err = s.withTx(ctx, func(q *db.Queries) error {
+		if err := q.DeleteResetToken(ctx, int64(user.UserID)); err != nil {
+			return fmt.Errorf("failed to delete reset token: %w", err)
+		}
+
+		if _, err := q.CreateResetToken(ctx, db.CreateResetTokenParams{
+			UserID:     int64(user.UserID),
+			Token:      codeHash,
+			ExpiryDate: s.now().Add(s.cfg.ResetTTL),
+		}); err != nil {
+			return fmt.Errorf("failed to store reset token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user.Email, map[string]string{
+		"Title":   "Reset your password",
+		"Subject": "Password reset code",
+		"Message": fmt.Sprintf("Hi %s, your password reset code is %s. It expires in %d minutes.", user.Firstname, code, int(s.cfg.ResetTTL.Minutes())),
+		"Button":  "Reset Password",
+		"Link":    link(s.cfg.ResetURL, url.Values{"email": {user.Email}, "code": {code}}),
+	})
+}
+
+// ResetPassword checks the reset code of the user with the given email address
+// and replaces the password. The code is consumed, the refresh tokens of the user
+// are deleted, the sessions ended and the access tokens issued so far revoked in
+// the same transaction, unless the service has no revocation store. The new
+// password is only hashed once the code is valid.
+//
+// A wrong code counts as an attempt; once MaxAttempts is reached, or the code
+// has expired, the code is deleted and ErrTooManyAttempts or ErrCodeExpired is returned.
+func (s *Service) ResetPassword(ctx context.Context, address, code, password string) error {
+	user, err := s.queries.GetUserByEmail(ctx, address)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCode
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Failed attempts are committed, so the result is kept apart from the
+	// transaction error.
+	var result error
+
+	err = s.withTx(ctx, func(q *db.Queries) error {
+		token, err := q.GetResetTokenByUserID(ctx, int64(user.UserID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				result = ErrInvalidCode
+				return nil
+			}
+			return fmt.Errorf("failed to get reset token: %w", err)
+		}
+
+		result, err = s.checkResetToken(ctx, q, token, code)
+		if err != nil || result != nil {
+			return err
+		}
+
+		consumed, err := q.ConsumeResetToken(ctx, token.ID)
+		if err != nil {
+			return fmt.Errorf("failed to consume reset token: %w", err)
+		}
+		if consumed == 0 {
+			result = ErrInvalidCode
+			return nil
+		}
+
+		hashed, err := s.hasher.HashPassword(password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		if _, err := q.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+			UserID:   user.UserID,
+			Password: hashed,
+		}); err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		if err := q.DeleteRefreshTokenByUserId(ctx, user.UserID); err != nil {
+			return fmt.Errorf("failed to delete refresh tokens: %w", err)
+		}
+		if _, err := q.RevokeUserSessions(ctx, db.RevokeUserSessionsParams{UserID: user.UserID}); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+
+		// Revoked last, so a failure rolls the reset back; revoking without a
+		// password change only logs the user out.
+		if s.revocations == nil {
+			return nil
+		}
+		if err := s.revocations.RevokeUserBefore(ctx, int(user.UserID), s.now()); err != nil {
+			return fmt.Errorf("failed to revoke access tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+// checkResetToken returns the reason a reset token cannot be used with the code,
+// recording the attempt or deleting the token as needed.
+func (s *Service) checkResetToken(ctx context.Context, q *db.Queries, token *db.ResetToken, code string) (reason error, err error) {
+	switch {
+	case !s.now().Before(token.ExpiryDate):
+		reason = ErrCodeExpired
+	case int(token.Attempts) >= s.cfg.MaxAttempts:
+		reason = ErrTooManyAttempts
+	case matchCode(code, token.Token):
+		return nil, nil
+	default:
+		attempts, err := q.IncrementResetTokenAttempts(ctx, token.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record reset attempt: %w", err)
+		}
+		if int(attempts) < s.cfg.MaxAttempts {
+			return ErrInvalidCode, nil
+		}
+		reason = ErrTooManyAttempts
+	}
+
+	if _, err := q.ConsumeResetToken(ctx, token.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete reset token: %w", err)
+	}
+	return reason, nil
+}
+
+func (s *Service) send(ctx context.Context, to string, data map[string]string) error {
+	if err := s.sender.Send(ctx, email.Message{
+		To:      []string{to},
+		Subject: data["Subject"],
+		HTML:    email.GenerateEmailHTML(data),
+	}); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
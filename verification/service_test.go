@@ -0,0 +1,317 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/auth"
+	db "github.com/MamangRust/monolith-payment-gateway-pkg/database/schema"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/email"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/hash"
+	"github.com/MamangRust/monolith-payment-gateway-pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	userColumns       = []string{"user_id", "firstname", "lastname", "email", "password", "verification_code", "is_verified", "created_at", "updated_at", "deleted_at", "verification_expires_at"}
+	resetTokenColumns = []string{"id", "user_id", "token", "expiry_date", "attempts"}
+)
+
+// recordingSender keeps the messages instead of sending them.
+type recordingSender struct {
+	messages []email.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg email.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func newTestService(t *testing.T) (*Service, sqlmock.Sqlmock, *recordingSender) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	hasher, err := hash.NewHashing(hash.Config{Algorithm: hash.Bcrypt, BcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+
+	sender := &recordingSender{}
+	cfg := DefaultConfig("https://app.example.com/verify", "https://app.example.com/reset")
+	svc := NewService(conn, db.New(conn), hasher, auth.NewInMemoryRevocationStore(), sender, cfg, &logger.Logger{Log: zap.NewNop()})
+	return svc, mock, sender
+}
+
+func userRow(verified bool) *sqlmock.Rows {
+	return namedUserRow("Jane", verified)
+}
+
+func namedUserRow(firstname string, verified bool) *sqlmock.Rows {
+	return sqlmock.NewRows(userColumns).
+		AddRow(7, firstname, "Doe", "jane@example.com", "hash", "", verified, nil, nil, nil, nil)
+}
+
+// codeFromLink extracts the code query parameter from the link in an email.
+func codeFromLink(t *testing.T, html string) string {
+	t.Helper()
+
+	m := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(html)
+	require.Len(t, m, 2)
+	u, err := url.Parse(strings.ReplaceAll(m[1], "&amp;", "&"))
+	require.NoError(t, err)
+	return u.Query().Get("code")
+}
+
+func TestHashCode(t *testing.T) {
+	code, codeHash, err := GenerateCode(8)
+	require.NoError(t, err)
+
+	assert.Len(t, code, 8)
+	assert.Len(t, codeHash, 64)
+	assert.True(t, matchCode(code, codeHash))
+	assert.False(t, matchCode(strings.ToLower(code)+"x", codeHash))
+}
+
+func TestService_Verification(t *testing.T) {
+	svc, mock, sender := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE user_id = $1")).
+		WithArgs(int32(7)).
+		WillReturnRows(userRow(false))
+	mock.ExpectExec(regexp.QuoteMeta("verification_code = $2")).
+		WithArgs(int32(7), sqlmock.AnyArg(), sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, svc.SendVerification(ctx, 7))
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, []string{"jane@example.com"}, sender.messages[0].To)
+
+	code := codeFromLink(t, sender.messages[0].HTML)
+	require.Len(t, code, 32)
+
+	mock.ExpectQuery(regexp.QuoteMeta("verification_expires_at > $2")).
+		WithArgs(HashCode(code), sql.NullTime{Time: now, Valid: true}).
+		WillReturnRows(userRow(true))
+
+	user, err := svc.Verify(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), user.UserID)
+
+	// The code was cleared, so the second use matches no row. Expired codes
+	// match no row either.
+	mock.ExpectQuery(regexp.QuoteMeta("verification_expires_at > $2")).
+		WithArgs(HashCode(code), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	_, err = svc.Verify(ctx, code)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_SendVerificationEscapesName(t *testing.T) {
+	svc, mock, sender := newTestService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE user_id = $1")).
+		WithArgs(int32(7)).
+		WillReturnRows(namedUserRow(`<a href="https://evil.example.com">Jane</a>`, false))
+	mock.ExpectExec(regexp.QuoteMeta("verification_code = $2")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, svc.SendVerification(context.Background(), 7))
+	require.Len(t, sender.messages, 1)
+	assert.NotContains(t, sender.messages[0].HTML, "evil.example.com\"")
+	assert.Contains(t, sender.messages[0].HTML, "&lt;a href=")
+}
+
+func TestService_SendVerificationAlreadyVerified(t *testing.T) {
+	svc, mock, sender := newTestService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE user_id = $1")).
+		WithArgs(int32(7)).
+		WillReturnRows(userRow(true))
+
+	assert.ErrorIs(t, svc.SendVerification(context.Background(), 7), ErrAlreadyVerified)
+	assert.Empty(t, sender.messages)
+}
+
+func TestService_PasswordReset(t *testing.T) {
+	svc, mock, sender := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).
+		WithArgs("jane@example.com").
+		WillReturnRows(userRow(true))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM reset_tokens\nWHERE user_id = $1")).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO reset_tokens")).
+		WithArgs(int64(7), sqlmock.AnyArg(), now.Add(30*time.Minute)).
+		WillReturnRows(sqlmock.NewRows(resetTokenColumns).AddRow(1, 7, "hash", now.Add(30*time.Minute), 0))
+	mock.ExpectCommit()
+
+	require.NoError(t, svc.SendPasswordReset(ctx, "jane@example.com"))
+	require.Len(t, sender.messages, 1)
+
+	code := codeFromLink(t, sender.messages[0].HTML)
+	require.Len(t, code, 8)
+	assert.Contains(t, sender.messages[0].HTML, code)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).
+		WithArgs("jane@example.com").
+		WillReturnRows(userRow(true))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(resetTokenColumns).AddRow(1, 7, HashCode(code), now.Add(time.Minute), 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM reset_tokens\nWHERE id = $1")).
+		WithArgs(int32(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("password = $2")).
+		WithArgs(int32(7), sqlmock.AnyArg()).
+		WillReturnRows(userRow(true))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM refresh_tokens")).
+		WithArgs(int32(7)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE sessions")).
+		WithArgs(int32(7), "").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow("session-1"))
+	mock.ExpectCommit()
+
+	require.NoError(t, svc.ResetPassword(ctx, "jane@example.com", code, "N3w-Password"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Access tokens issued before the reset are revoked.
+	before, err := svc.revocations.RevokedBefore(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, now, before)
+}
+
+func TestService_ResetPasswordWithoutRevocationStore(t *testing.T) {
+	svc, mock, _ := newTestService(t)
+	svc.revocations = nil
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).
+		WithArgs("jane@example.com").
+		WillReturnRows(userRow(true))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(resetTokenColumns).AddRow(1, 7, HashCode("GoodCode"), time.Now().Add(time.Minute), 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM reset_tokens\nWHERE id = $1")).
+		WithArgs(int32(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("password = $2")).
+		WithArgs(int32(7), sqlmock.AnyArg()).
+		WillReturnRows(userRow(true))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM refresh_tokens")).
+		WithArgs(int32(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE sessions")).
+		WithArgs(int32(7), "").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}))
+	mock.ExpectCommit()
+
+	// Without a store the reset still succeeds and only skips the revocation.
+	require.NoError(t, svc.ResetPassword(context.Background(), "jane@example.com", "GoodCode", "N3w-Password"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestService_SendPasswordResetUnknownEmail(t *testing.T) {
+	svc, mock, sender := newTestService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).
+		WithArgs("nobody@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	require.NoError(t, svc.SendPasswordReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, sender.messages)
+}
+
+func TestService_ResetPasswordRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		expiry   time.Duration
+		attempts int
+		wantErr  error
+		expect   func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:     "wrong code",
+			expiry:   time.Minute,
+			attempts: 1,
+			wantErr:  ErrInvalidCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SET attempts = attempts + 1")).
+					WithArgs(int32(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(2))
+			},
+		},
+		{
+			name:     "last attempt",
+			expiry:   time.Minute,
+			attempts: 4,
+			wantErr:  ErrTooManyAttempts,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SET attempts = attempts + 1")).
+					WithArgs(int32(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(5))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM reset_tokens\nWHERE id = $1")).
+					WithArgs(int32(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "expired",
+			expiry:   -time.Second,
+			attempts: 0,
+			wantErr:  ErrCodeExpired,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM reset_tokens\nWHERE id = $1")).
+					WithArgs(int32(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, mock, _ := newTestService(t)
+
+			mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).
+				WithArgs("jane@example.com").
+				WillReturnRows(userRow(true))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).
+				WithArgs(int64(7)).
+				WillReturnRows(sqlmock.NewRows(resetTokenColumns).
+					AddRow(1, 7, HashCode("GoodCode"), time.Now().Add(tt.expiry), tt.attempts))
+			tt.expect(mock)
+			// Attempts and deletions are committed even though the reset fails.
+			mock.ExpectCommit()
+
+			err := svc.ResetPassword(context.Background(), "jane@example.com", "BadCode1", "N3w-Password")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			before, err := svc.revocations.RevokedBefore(context.Background(), 7)
+			require.NoError(t, err)
+			assert.True(t, before.IsZero())
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package verification
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	randomstring "github.com/MamangRust/monolith-payment-gateway-pkg/random_string"
+)
+
+var (
+	// ErrInvalidCode is returned when a verification or reset code does not match.
+	ErrInvalidCode = errors.New("invalid verification code")
+
+	// ErrCodeExpired is returned when a reset code is used after its expiry date.
+	// Expired verification codes are rejected with ErrInvalidCode.
+	ErrCodeExpired = errors.New("verification code expired")
+
+	// ErrTooManyAttempts is returned once a reset code was entered wrongly too often.
+	// The code is deleted and a new one has to be requested.
+	ErrTooManyAttempts = errors.New("too many invalid attempts")
+
+	// ErrAlreadyVerified is returned when a verification email is requested for a
+	// user who is already verified.
+	ErrAlreadyVerified = errors.New("user already verified")
+)
+
+// Config configures the codes and the links sent by email.
+type Config struct {
+	// VerifyURL is the page that verifies an email address. The code is added
+	// as the "code" query parameter.
+	VerifyURL string
+	// ResetURL is the page where a new password is entered. The email address
+	// and the code are added as the "email" and "code" query parameters.
+	ResetURL string
+
+	// VerificationCodeLength is the length of email verification codes. They
+	// are only sent as links, so they can be long.
+	VerificationCodeLength int
+	// VerificationTTL is how long a verification code stays valid.
+	VerificationTTL time.Duration
+	// ResetCodeLength is the length of password reset codes, which users may
+	// have to type.
+	ResetCodeLength int
+	// ResetTTL is how long a reset code stays valid.
+	ResetTTL time.Duration
+	// MaxAttempts is the number of wrong codes after which a reset code is deleted.
+	MaxAttempts int
+}
+
+// DefaultConfig returns a Config with 32 character verification codes valid
+// for 24 hours and 8 character reset codes valid for 30 minutes and 5 attempts.
+func DefaultConfig(verifyURL, resetURL string) Config {
+	return Config{
+		VerifyURL:              verifyURL,
+		ResetURL:               resetURL,
+		VerificationCodeLength: 32,
+		VerificationTTL:        24 * time.Hour,
+		ResetCodeLength:        8,
+		ResetTTL:               30 * time.Minute,
+		MaxAttempts:            5,
+	}
+}
+
+// GenerateCode returns a random alphanumeric code and the hash to store for it.
+func GenerateCode(length int) (string, string, error) {
+	code, err := randomstring.GenerateRandomString(length)
+	if err != nil {
+		return "", "", err
+	}
+	return code, HashCode(code), nil
+}
+
+// HashCode returns the hex encoded SHA-256 hash of the code. Codes are random,
+// so a fast hash is enough and allows looking them up by hash.
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// matchCode compares the code with a stored hash in constant time.
+func matchCode(code, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashCode(code)), []byte(hash)) == 1
+}
+
+// link adds the query parameters to base.
+func link(base string, params url.Values) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?" + params.Encode()
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}